@@ -16,6 +16,7 @@
 
 #define MQTT_BROKER "112.6.224.25" // 定义要连接的代理的ip地址，localhost指连接本地的ip
 #define MQTT_TOPIC "image_topic/0610"
+#define MQTT_STATUS_TOPIC "device/0610/status" // 在线状态主题，上线时发布保留消息online，遗嘱消息为offline
 #define MQTT_PORT 20042            // 指代理监听的端口号，这也是连接的入口
 #define MQTT_QOS 1                 // 消息服务等级
 
@@ -39,6 +40,8 @@ void on_connect(struct mosquitto *mosq, void *obj, int reason_code)
     }
     printf("Connected to MQTT broker.\n");
     mosquitto_subscribe(mosq, NULL, MQTT_TOPIC, 1); // 订阅主题
+    // 每次（重新）连接后发布保留的在线状态，覆盖之前的遗嘱消息
+    mosquitto_publish(mosq, NULL, MQTT_STATUS_TOPIC, strlen("online"), "online", MQTT_QOS, true);
 }
 
 int main()
@@ -114,6 +117,9 @@ int main()
     // 设置回调函数
     mosquitto_connect_callback_set(mosq, on_connect);
 
+    // 设置遗嘱消息，异常断开时由代理发布保留的离线状态
+    mosquitto_will_set(mosq, MQTT_STATUS_TOPIC, strlen("offline"), "offline", MQTT_QOS, true);
+
     // 连接到MQTT代理
     ret = mosquitto_connect(mosq, MQTT_BROKER, MQTT_PORT, 60);
     if (ret != MOSQ_ERR_SUCCESS)
@@ -161,6 +167,10 @@ int main()
 
     // 清理资源--------------------------------------------------------
     printf("successful out\n");
+    // 正常退出时不会触发遗嘱消息，主动发布离线状态后再断开
+    mosquitto_publish(mosq, NULL, MQTT_STATUS_TOPIC, strlen("offline"), "offline", MQTT_QOS, true);
+    mosquitto_disconnect(mosq);
+    mosquitto_loop_stop(mosq, false);
     mosquitto_destroy(mosq);
     mosquitto_lib_cleanup();
 
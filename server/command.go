@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+	"video-platform/internal/storage"
+)
+
+// 子命令，通过 ./video-platform <命令> [参数] 调用，不带命令时启动HTTP服务
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"migrate-layout": migrateLayoutCommand,
+	"migrate-names":  migrateNamesCommand,
+	"reindex":        reindexCommand,
+	"replay":         replayCommand,
+	"simulate":       simulateCommand,
+}
+
+// 执行子命令
+func runCommand(ctx context.Context, name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		names := make([]string, 0, len(commands))
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("未知命令 '%s'，可用命令: %s", name, strings.Join(names, ", "))
+	}
+	return cmd(ctx, args)
+}
+
+// 将旧格式（秒级）的帧文件名迁移为毫秒加序号的新格式
+func migrateNamesCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate-names", flag.ExitOnError)
+	dir := fs.String("dir", "", "本地图像根目录，默认使用 storage 配置的存储")
+	device := fs.String("device", "", "只迁移指定设备，默认迁移全部设备")
+	dryRun := fs.Bool("dry-run", false, "只统计需要迁移的文件，不实际重命名")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		st  storage.Storage
+		err error
+	)
+	if *dir != "" {
+		st, err = storage.NewLocal(*dir)
+	} else {
+		st, err = service.LoadStorage(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	var deviceIds []string
+	if *device != "" {
+		deviceIds = []string{*device}
+	} else {
+		if deviceIds, err = listStorageDevices(ctx, st); err != nil {
+			return fmt.Errorf("读取图像存储失败: %v", err)
+		}
+	}
+
+	action := "已迁移"
+	if *dryRun {
+		action = "需要迁移"
+	}
+	total := 0
+	for _, deviceId := range deviceIds {
+		count, err := model.MigrateFrameNames(ctx, st, deviceId, *dryRun)
+		total += count
+		if err != nil {
+			return fmt.Errorf("迁移设备 %s 失败（已处理 %d 个文件）: %v", deviceId, count, err)
+		}
+		log.Printf("设备 %s: %d 个文件%s", deviceId, count, action)
+	}
+	log.Printf("共 %d 个文件%s", total, action)
+	if total > 0 && !*dryRun {
+		log.Printf("帧的对象键已改变，请执行 reindex -prune 更新图像索引")
+	}
+	return nil
+}
+
+// 将平铺在设备目录下的帧移动到按小时分区的目录，并更新图像索引。
+// 可在服务运行时执行，中断后重新执行会从未迁移的帧继续
+func migrateLayoutCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate-layout", flag.ExitOnError)
+	device := fs.String("device", "", "只迁移指定设备，默认迁移全部设备")
+	dryRun := fs.Bool("dry-run", false, "只统计需要迁移的帧，不实际移动")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	st, err := service.LoadStorage(ctx)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		if err := initDatabase(); err != nil {
+			return fmt.Errorf("创建数据库失败: %v", err)
+		}
+		if err := initTables(ctx); err != nil {
+			return err
+		}
+	}
+
+	var deviceIds []string
+	if *device != "" {
+		deviceIds = []string{*device}
+	} else if deviceIds, err = listStorageDevices(ctx, st); err != nil {
+		return fmt.Errorf("读取图像存储失败: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	action := "已迁移"
+	if *dryRun {
+		action = "需要迁移"
+	}
+	total := 0
+	for _, deviceId := range deviceIds {
+		moved := func(from string, to string) error {
+			if err := model.Image.RenameKey(ctx, from, to); err != nil {
+				return fmt.Errorf("更新帧 %s 的索引失败: %v", from, err)
+			}
+			return nil
+		}
+		count, err := model.MigrateFrameLayout(ctx, st, deviceId, *dryRun, moved)
+		total += count
+		if err != nil {
+			return fmt.Errorf("迁移设备 %s 失败（已处理 %d 帧），重新执行可继续迁移: %v", deviceId, count, err)
+		}
+		if !*dryRun {
+			// 上次中断在移动帧与更新索引之间时，补建新位置的索引并删除旧位置的索引
+			stats, err := service.ReindexImages(ctx, st, deviceId, service.ReindexOptions{Prune: true})
+			if err != nil {
+				return err
+			}
+			if stats.Indexed > 0 || stats.Pruned > 0 {
+				log.Printf("设备 %s: 补建索引 %d，删除失效索引 %d", deviceId, stats.Indexed, stats.Pruned)
+			}
+		}
+		log.Printf("设备 %s: %d 帧%s", deviceId, count, action)
+	}
+	log.Printf("共 %d 帧%s", total, action)
+	return nil
+}
+
+// 扫描图像存储，为缺少索引的帧写入图像索引，用于升级后为已有的帧建立索引
+func reindexCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("reindex", flag.ExitOnError)
+	device := fs.String("device", "", "只处理指定设备，默认处理全部设备")
+	full := fs.Bool("full", false, "重新索引全部帧，默认跳过已索引的帧")
+	prune := fs.Bool("prune", false, "删除存储中已不存在的帧的索引")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := initDatabase(); err != nil {
+		return fmt.Errorf("创建数据库失败: %v", err)
+	}
+	if err := initTables(ctx); err != nil {
+		return err
+	}
+	st, err := service.LoadStorage(ctx)
+	if err != nil {
+		return err
+	}
+
+	var deviceIds []string
+	if *device != "" {
+		deviceIds = []string{*device}
+	} else if deviceIds, err = listStorageDevices(ctx, st); err != nil {
+		return fmt.Errorf("读取图像存储失败: %v", err)
+	}
+
+	var total service.ReindexStats
+	for _, deviceId := range deviceIds {
+		stats, err := service.ReindexImages(ctx, st, deviceId, service.ReindexOptions{Full: *full, Prune: *prune})
+		if err != nil {
+			return err
+		}
+		log.Printf("设备 %s: %d 帧，索引 %d，跳过 %d，失败 %d，删除失效索引 %d",
+			deviceId, stats.Frames, stats.Indexed, stats.Skipped, stats.Failed, stats.Pruned)
+		total.Frames += stats.Frames
+		total.Indexed += stats.Indexed
+		total.Skipped += stats.Skipped
+		total.Failed += stats.Failed
+		total.Pruned += stats.Pruned
+	}
+	log.Printf("共 %d 台设备、%d 帧，索引 %d，跳过 %d，失败 %d，删除失效索引 %d",
+		len(deviceIds), total.Frames, total.Indexed, total.Skipped, total.Failed, total.Pruned)
+	if total.Failed > 0 {
+		return fmt.Errorf("%d 帧索引失败", total.Failed)
+	}
+	return nil
+}
+
+// 列出图像存储中的设备，即根下第一级目录；只读取目录名，不遍历其中的帧
+func listStorageDevices(ctx context.Context, st storage.Storage) ([]string, error) {
+	return st.ListDirs(ctx)
+}
+
+// 回放录制的MQTT消息，默认直接送入接收管道，-publish 时发布到MQTT服务器
+func replayCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	file := fs.String("file", "", "录制文件或录制目录，默认使用 recorder.dir 配置")
+	speed := fs.Float64("speed", 1, "回放速度：1 为原始速度，大于1时加速，0 表示不等待")
+	publish := fs.Bool("publish", false, "发布到MQTT服务器，由正在运行的服务接收，默认直接送入本进程的接收管道")
+	broker := fs.String("broker", "", "-publish 时使用的MQTT服务器地址，默认使用 mqtt.broker 配置")
+	filter := fs.String("filter", "", "只回放匹配的主题，可使用 + 和 #")
+	originalTime := fs.Bool("original-time", false, "使用录制时的接收时间，默认使用回放时的当前时间")
+	maxGap := fs.Duration("max-gap", 0, "两条消息之间的最长等待时间，例如 10s，0 表示不限制")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" {
+		cfg, err := service.LoadRecorderConfig(ctx)
+		if err != nil {
+			return err
+		}
+		*file = cfg.Dir
+	}
+
+	var (
+		replayer *service.Replayer
+		err      error
+	)
+	if *publish {
+		replayer, err = service.NewPublishReplayer(ctx, *broker)
+	} else {
+		if err := initDatabase(); err != nil {
+			return fmt.Errorf("创建数据库失败: %v", err)
+		}
+		if err := initTables(ctx); err != nil {
+			return err
+		}
+		replayer, err = service.NewIngestReplayer(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	stats, err := replayer.Replay(*file, service.ReplayOptions{
+		Speed:    *speed,
+		KeepTime: *originalTime,
+		Filter:   *filter,
+		MaxGap:   *maxGap,
+	})
+	replayer.Close()
+	if err != nil {
+		return err
+	}
+	log.Printf("回放完成: %d 个文件，读取 %d 条消息，回放 %d 条，跳过 %d 条，失败 %d 条，耗时 %s",
+		stats.Files, stats.Total, stats.Replayed, stats.Skipped, stats.Failed, stats.Elapsed.Round(time.Millisecond))
+	return nil
+}
+
+// 模拟多台摄像头向MQTT服务器发布图像，用于压力测试，结束时报告发布延迟和丢失率
+func simulateCommand(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	var opts service.SimulatorOptions
+	var qos int
+	fs.StringVar(&opts.Broker, "broker", "", "MQTT服务器地址，默认使用 mqtt.broker 配置")
+	fs.IntVar(&opts.Devices, "devices", 10, "虚拟摄像头数量")
+	fs.StringVar(&opts.DevicePrefix, "device-prefix", "sim", "设备ID前缀，设备ID为前缀加4位序号")
+	fs.StringVar(&opts.ImageDir, "images", "images/0610", "图像目录，循环发布其中的 JPEG")
+	fs.IntVar(&opts.MaxImages, "max-images", 50, "最多加载的图像数，0 表示不限制")
+	fs.StringVar(&opts.Topic, "topic", "device/{deviceId}/image", "主题模板，{deviceId} 替换为设备ID")
+	fs.Float64Var(&opts.Rate, "rate", 0.5, "每台设备每秒发布的帧数")
+	fs.Float64Var(&opts.Jitter, "jitter", 0.1, "发布间隔的随机抖动比例，0-1")
+	fs.IntVar(&qos, "qos", 1, "发布使用的QoS")
+	fs.BoolVar(&opts.Raw, "raw", false, "发布裸 JPEG，与现有固件相同，默认使用带序号和采集时间的信封格式")
+	fs.DurationVar(&opts.Duration, "duration", time.Minute, "运行时长，0 表示一直运行到 Ctrl+C")
+	fs.IntVar(&opts.Count, "count", 0, "每台设备发布的帧数，0 表示不限制")
+	fs.BoolVar(&opts.Verify, "verify", false, "同时订阅发布的主题，统计丢失率和端到端延迟")
+	fs.DurationVar(&opts.Report, "report", 5*time.Second, "周期报告间隔，0 表示只在结束时报告")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if qos < 0 || qos > 2 {
+		return fmt.Errorf("QoS 必须为 0、1 或 2")
+	}
+	opts.Qos = byte(qos)
+
+	sim, err := service.NewSimulator(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer sim.Close()
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	log.Printf("开始模拟 %d 台设备，每台 %.2f 帧/秒，QoS %d", opts.Devices, opts.Rate, opts.Qos)
+	report := sim.Run(ctx)
+
+	seconds := report.Elapsed.Seconds()
+	log.Printf("模拟结束，耗时 %s", report.Elapsed.Round(time.Millisecond))
+	log.Printf("发布成功 %d 条，失败 %d 条，吞吐 %.1f 条/秒，%.2f MB/秒",
+		report.Published, report.Failed, float64(report.Published)/seconds, float64(report.Bytes)/seconds/(1<<20))
+	log.Printf("发布延迟: %s", report.PublishLatency)
+	if opts.Verify {
+		log.Printf("校验收到 %d 条，丢失率 %.2f%%", report.Received, report.Loss*100)
+		log.Printf("端到端延迟: %s", report.EndToEnd)
+	} else {
+		log.Printf("丢失率（仅发布失败）: %.2f%%", report.Loss*100)
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+// Package avi 以 MJPEG 编码写出 AVI 文件：每帧直接存放原始 JPEG，不转码。
+// 文件格式为 AVI 1.0（RIFF 大小为32位），附带 idx1 索引以便播放器定位。
+package avi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// AVI 1.0 的文件大小上限，超出后部分播放器无法打开
+const MaxFileSize = 1<<31 - 1
+
+// 文件头的长度：RIFF、hdrl 列表（avih、strl）和 movi 列表头
+const headerSize = 224
+
+// movi 列表的 fourcc 在文件中的位置，idx1 中的偏移相对于此处
+const moviOffset = headerSize - 4
+
+// ErrTooLarge 文件超过 MaxFileSize
+var ErrTooLarge = errors.New("AVI 文件超过 2GB 上限")
+
+type indexEntry struct {
+	offset uint32
+	size   uint32
+}
+
+// 写入 frames 帧、JPEG 共 bytes 字节时的文件大小上限（每帧都按需要填充一个字节计算），
+// 用于在读取帧之前判断是否会超过 MaxFileSize
+func FileSize(frames int, bytes int64) int64 {
+	n := int64(frames)
+	return headerSize + bytes + n*(8+1) + 8 + n*16
+}
+
+// Writer MJPEG AVI 写入器，写完全部帧后调用 Close 写出索引并回填文件头
+type Writer struct {
+	w        io.WriteSeeker
+	width    int
+	height   int
+	fps      float64
+	frames   int
+	moviSize int64 // movi 列表的大小，包括 fourcc
+	maxChunk uint32
+	index    []indexEntry
+	closed   bool
+}
+
+// 创建写入器并写出文件头，width、height 为视频尺寸，fps 为帧率
+func NewWriter(w io.WriteSeeker, width int, height int, fps float64) (*Writer, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("视频尺寸无效: %dx%d", width, height)
+	}
+	if fps <= 0 || math.IsInf(fps, 0) || math.IsNaN(fps) {
+		return nil, fmt.Errorf("帧率无效: %v", fps)
+	}
+	aw := &Writer{w: w, width: width, height: height, fps: fps, moviSize: 4}
+	if _, err := w.Write(aw.header()); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// 写入一帧 JPEG
+func (aw *Writer) WriteFrame(jpeg []byte) error {
+	if aw.closed {
+		return errors.New("写入器已关闭")
+	}
+	size := int64(len(jpeg))
+	padded := size + size%2
+	// 预留 idx1 的空间
+	if headerSize+aw.moviSize+8+padded+8+int64(len(aw.index)+1)*16 > MaxFileSize {
+		return ErrTooLarge
+	}
+	chunk := make([]byte, 8, 8+padded)
+	copy(chunk, "00dc")
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(size))
+	chunk = append(chunk, jpeg...)
+	if size%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	if _, err := aw.w.Write(chunk); err != nil {
+		return err
+	}
+	aw.index = append(aw.index, indexEntry{offset: uint32(aw.moviSize), size: uint32(size)})
+	aw.moviSize += 8 + padded
+	aw.frames++
+	if uint32(size) > aw.maxChunk {
+		aw.maxChunk = uint32(size)
+	}
+	return nil
+}
+
+// 已写入的帧数
+func (aw *Writer) Frames() int {
+	return aw.frames
+}
+
+// 写出 idx1 索引并回填文件头中的帧数和大小，不关闭底层的 io.WriteSeeker
+func (aw *Writer) Close() error {
+	if aw.closed {
+		return nil
+	}
+	aw.closed = true
+
+	idx := make([]byte, 8+16*len(aw.index))
+	copy(idx, "idx1")
+	binary.LittleEndian.PutUint32(idx[4:], uint32(16*len(aw.index)))
+	for i, entry := range aw.index {
+		e := idx[8+16*i:]
+		copy(e, "00dc")
+		binary.LittleEndian.PutUint32(e[4:], 0x10) // AVIIF_KEYFRAME
+		binary.LittleEndian.PutUint32(e[8:], entry.offset)
+		binary.LittleEndian.PutUint32(e[12:], entry.size)
+	}
+	if _, err := aw.w.Write(idx); err != nil {
+		return err
+	}
+	end, err := aw.w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := aw.w.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	header := aw.header()
+	binary.LittleEndian.PutUint32(header[4:], uint32(end-8))
+	if _, err := aw.w.Write(header); err != nil {
+		return err
+	}
+	_, err = aw.w.Seek(end, io.SeekStart)
+	return err
+}
+
+// 生成文件头，帧数和大小使用当前的值
+func (aw *Writer) header() []byte {
+	b := make([]byte, 0, headerSize)
+	u32 := func(v uint32) { b = binary.LittleEndian.AppendUint32(b, v) }
+	u16 := func(v uint16) { b = binary.LittleEndian.AppendUint16(b, v) }
+	fourcc := func(s string) { b = append(b, s...) }
+
+	microSecPerFrame := uint32(math.Round(1e6 / aw.fps))
+	rate := uint32(math.Round(aw.fps * 1000))
+	maxBytesPerSec := uint32(math.Min(float64(aw.maxChunk)*aw.fps, math.MaxUint32))
+
+	fourcc("RIFF")
+	u32(0) // 文件大小，Close 时回填
+	fourcc("AVI ")
+
+	fourcc("LIST")
+	u32(192)
+	fourcc("hdrl")
+
+	// MainAVIHeader
+	fourcc("avih")
+	u32(56)
+	u32(microSecPerFrame)
+	u32(maxBytesPerSec)
+	u32(0)    // PaddingGranularity
+	u32(0x10) // AVIF_HASINDEX
+	u32(uint32(aw.frames))
+	u32(0) // InitialFrames
+	u32(1) // Streams
+	u32(aw.maxChunk)
+	u32(uint32(aw.width))
+	u32(uint32(aw.height))
+	u32(0)
+	u32(0)
+	u32(0)
+	u32(0)
+
+	fourcc("LIST")
+	u32(116)
+	fourcc("strl")
+
+	// AVIStreamHeader
+	fourcc("strh")
+	u32(56)
+	fourcc("vids")
+	fourcc("MJPG")
+	u32(0)    // Flags
+	u16(0)    // Priority
+	u16(0)    // Language
+	u32(0)    // InitialFrames
+	u32(1000) // Scale，帧率为 Rate/Scale
+	u32(rate)
+	u32(0) // Start
+	u32(uint32(aw.frames))
+	u32(aw.maxChunk)
+	u32(0xFFFFFFFF) // Quality，-1 表示默认
+	u32(0)          // SampleSize
+	u16(0)
+	u16(0)
+	u16(uint16(aw.width))
+	u16(uint16(aw.height))
+
+	// BITMAPINFOHEADER
+	fourcc("strf")
+	u32(40)
+	u32(40)
+	u32(uint32(aw.width))
+	u32(uint32(aw.height))
+	u16(1)  // Planes
+	u16(24) // BitCount
+	fourcc("MJPG")
+	u32(uint32(aw.width * aw.height * 3))
+	u32(0)
+	u32(0)
+	u32(0)
+	u32(0)
+
+	fourcc("LIST")
+	u32(uint32(aw.moviSize))
+	fourcc("movi")
+	return b
+}
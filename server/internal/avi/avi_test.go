@@ -0,0 +1,267 @@
+package avi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 写出 AVI 并返回文件内容
+func writeAVI(t *testing.T, width int, height int, fps float64, frames [][]byte) []byte {
+	t.Helper()
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.avi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, width, height, fps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range frames {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if w.Frames() != len(frames) {
+		t.Fatalf("Frames() = %d，应为 %d", w.Frames(), len(frames))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Close 后写入位置应当在文件末尾
+	end, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if end != int64(len(data)) {
+		t.Fatalf("Close 后的写入位置为 %d，文件长度为 %d", end, len(data))
+	}
+	return data
+}
+
+func u32At(data []byte, off int) uint32 {
+	return binary.LittleEndian.Uint32(data[off:])
+}
+
+func u16At(data []byte, off int) uint16 {
+	return binary.LittleEndian.Uint16(data[off:])
+}
+
+func expectFourcc(t *testing.T, data []byte, off int, want string) {
+	t.Helper()
+	if off+4 > len(data) {
+		t.Fatalf("偏移 %d 处应为 %q，文件长度只有 %d", off, want, len(data))
+	}
+	if got := string(data[off : off+4]); got != want {
+		t.Fatalf("偏移 %d 处为 %q，应为 %q", off, got, want)
+	}
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"没有帧", nil},
+		{"偶数长度", [][]byte{{1, 2, 3, 4}, {5, 6}}},
+		{"奇数长度需要填充", [][]byte{{1, 2, 3}, {4}}},
+		{"奇偶混合", [][]byte{{1, 2, 3, 4, 5}, {6, 7, 8, 9, 10, 11}, {12}, {13, 14}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const width, height = 640, 480
+			data := writeAVI(t, width, height, 2.5, tt.frames)
+
+			// FileSize 按每帧都需要填充计算，偶数长度的帧少一个字节
+			var total int64
+			even := 0
+			for _, frame := range tt.frames {
+				total += int64(len(frame))
+				if len(frame)%2 == 0 {
+					even++
+				}
+			}
+			if want := FileSize(len(tt.frames), total) - int64(even); int64(len(data)) != want {
+				t.Errorf("文件大小为 %d，FileSize 减去无需填充的帧数为 %d", len(data), want)
+			}
+
+			expectFourcc(t, data, 0, "RIFF")
+			if got := u32At(data, 4); int(got) != len(data)-8 {
+				t.Errorf("RIFF 大小为 %d，应为 %d", got, len(data)-8)
+			}
+			expectFourcc(t, data, 8, "AVI ")
+
+			// hdrl 列表
+			expectFourcc(t, data, 12, "LIST")
+			hdrlEnd := 20 + int(u32At(data, 16))
+			if got := u32At(data, 16); got != 192 {
+				t.Errorf("hdrl 大小为 %d，应为 192", got)
+			}
+			expectFourcc(t, data, 20, "hdrl")
+
+			expectFourcc(t, data, 24, "avih")
+			if got := u32At(data, 28); got != 56 {
+				t.Errorf("avih 大小为 %d，应为 56", got)
+			}
+			if got := u32At(data, 32); got != 400000 {
+				t.Errorf("MicroSecPerFrame 为 %d，应为 400000", got)
+			}
+			if got := u32At(data, 48); int(got) != len(tt.frames) {
+				t.Errorf("avih TotalFrames 为 %d，应为 %d", got, len(tt.frames))
+			}
+			maxChunk := 0
+			for _, frame := range tt.frames {
+				if len(frame) > maxChunk {
+					maxChunk = len(frame)
+				}
+			}
+			if got := u32At(data, 60); int(got) != maxChunk {
+				t.Errorf("avih SuggestedBufferSize 为 %d，应为 %d", got, maxChunk)
+			}
+			if w, h := u32At(data, 64), u32At(data, 68); w != width || h != height {
+				t.Errorf("avih 尺寸为 %dx%d，应为 %dx%d", w, h, width, height)
+			}
+
+			// strl 列表紧跟在 avih 之后，并在 hdrl 结尾处结束
+			expectFourcc(t, data, 88, "LIST")
+			if got := u32At(data, 92); got != 116 {
+				t.Errorf("strl 大小为 %d，应为 116", got)
+			}
+			if end := 96 + int(u32At(data, 92)); end != hdrlEnd {
+				t.Errorf("strl 结束于 %d，hdrl 结束于 %d", end, hdrlEnd)
+			}
+			expectFourcc(t, data, 96, "strl")
+			expectFourcc(t, data, 100, "strh")
+			if got := u32At(data, 104); got != 56 {
+				t.Errorf("strh 大小为 %d，应为 56", got)
+			}
+			expectFourcc(t, data, 108, "vids")
+			expectFourcc(t, data, 112, "MJPG")
+			if scale, rate := u32At(data, 128), u32At(data, 132); scale != 1000 || rate != 2500 {
+				t.Errorf("strh Scale/Rate 为 %d/%d，应为 1000/2500", scale, rate)
+			}
+			if got := u32At(data, 140); int(got) != len(tt.frames) {
+				t.Errorf("strh Length 为 %d，应为 %d", got, len(tt.frames))
+			}
+			if w, h := u16At(data, 160), u16At(data, 162); w != width || h != height {
+				t.Errorf("strh 画面区域为 %dx%d，应为 %dx%d", w, h, width, height)
+			}
+			expectFourcc(t, data, 164, "strf")
+			if got := u32At(data, 168); got != 40 {
+				t.Errorf("strf 大小为 %d，应为 40", got)
+			}
+
+			// movi 列表从 hdrl 结尾开始，帧数据从 headerSize 开始
+			if hdrlEnd+12 != headerSize {
+				t.Fatalf("movi 数据开始于 %d，应为 %d", hdrlEnd+12, headerSize)
+			}
+			expectFourcc(t, data, hdrlEnd, "LIST")
+			moviSize := int(u32At(data, hdrlEnd+4))
+			expectFourcc(t, data, moviOffset, "movi")
+
+			type chunk struct {
+				offset int
+				size   int
+			}
+			var chunks []chunk
+			pos := headerSize
+			for i, frame := range tt.frames {
+				expectFourcc(t, data, pos, "00dc")
+				size := int(u32At(data, pos+4))
+				if size != len(frame) {
+					t.Fatalf("第 %d 帧的块大小为 %d，应为 %d", i, size, len(frame))
+				}
+				if !bytes.Equal(data[pos+8:pos+8+size], frame) {
+					t.Errorf("第 %d 帧的数据不一致", i)
+				}
+				chunks = append(chunks, chunk{offset: pos - moviOffset, size: size})
+				pos += 8 + size
+				if size%2 == 1 {
+					if data[pos] != 0 {
+						t.Errorf("第 %d 帧的填充字节为 %d，应为 0", i, data[pos])
+					}
+					pos++
+				}
+			}
+			if pos != moviOffset+moviSize {
+				t.Fatalf("movi 结束于 %d，列表大小表示结束于 %d", pos, moviOffset+moviSize)
+			}
+
+			// idx1 中的偏移相对于 movi 的 fourcc，第一帧为 4
+			expectFourcc(t, data, pos, "idx1")
+			if got := u32At(data, pos+4); int(got) != 16*len(tt.frames) {
+				t.Errorf("idx1 大小为 %d，应为 %d", got, 16*len(tt.frames))
+			}
+			if len(chunks) > 0 && chunks[0].offset != 4 {
+				t.Errorf("第一帧相对 movi 的偏移为 %d，应为 4", chunks[0].offset)
+			}
+			for i, c := range chunks {
+				e := pos + 8 + 16*i
+				expectFourcc(t, data, e, "00dc")
+				if got := u32At(data, e+4); got != 0x10 {
+					t.Errorf("第 %d 条索引的标志为 %#x，应为 0x10", i, got)
+				}
+				if got := u32At(data, e+8); int(got) != c.offset {
+					t.Errorf("第 %d 条索引的偏移为 %d，应为 %d", i, got, c.offset)
+				}
+				if got := u32At(data, e+12); int(got) != c.size {
+					t.Errorf("第 %d 条索引的大小为 %d，应为 %d", i, got, c.size)
+				}
+			}
+			if end := pos + 8 + 16*len(tt.frames); end != len(data) {
+				t.Errorf("idx1 结束于 %d，文件长度为 %d", end, len(data))
+			}
+		})
+	}
+}
+
+func TestNewWriterInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		fps           float64
+	}{
+		{"宽度为0", 0, 480, 10},
+		{"高度为负数", 640, -1, 10},
+		{"帧率为0", 640, 480, 0},
+		{"帧率为负数", 640, 480, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "test.avi"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := NewWriter(f, tt.width, tt.height, tt.fps); err == nil {
+				t.Errorf("NewWriter(%d, %d, %v) 应当返回错误", tt.width, tt.height, tt.fps)
+			}
+		})
+	}
+}
+
+func TestWriteFrameAfterClose(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "test.avi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w, err := NewWriter(f, 16, 16, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame([]byte{1}); err == nil {
+		t.Error("关闭后写入帧应当返回错误")
+	}
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var CommandController = new(commandController)
+
+type commandController struct{}
+
+// 向设备下发命令
+func (c *commandController) Send(ctx context.Context, req *model.CommandSendReq) (res *model.CommandRes, err error) {
+	log.Printf("向设备 %s 下发命令: %s", req.DeviceId, req.Name)
+	r := g.RequestFromCtx(ctx)
+	cmd, err := service.GetMQTTService().SendCommand(ctx, req.DeviceId, req.Name, req.Params, req.Timeout)
+	if err != nil {
+		log.Printf("下发命令失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("下发命令失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    cmd,
+	})
+	return nil, nil
+}
+
+// 获取设备命令历史
+func (c *commandController) List(ctx context.Context, req *model.CommandListReq) (res *model.CommandRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 50
+	}
+	cmds, err := model.Command.List(ctx, req.DeviceId, req.Limit)
+	if err != nil {
+		log.Printf("获取命令历史失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取命令历史失败: %v", err),
+			"data":    []interface{}{},
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    cmds,
+	})
+	return nil, nil
+}
+
+// 获取命令详情
+func (c *commandController) Get(ctx context.Context, req *model.CommandGetReq) (res *model.CommandRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	cmd, err := model.Command.Get(ctx, req.DeviceId, req.CommandId)
+	if err != nil || cmd == nil {
+		message := "命令不存在"
+		if err != nil {
+			message = fmt.Sprintf("获取命令失败: %v", err)
+		}
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": message,
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    cmd,
+	})
+	return nil, nil
+}
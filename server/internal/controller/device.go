@@ -6,6 +6,7 @@ import (
 	"log"
 	"time"
 	"video-platform/internal/model"
+	"video-platform/internal/service"
 
 	"github.com/gogf/gf/v2/frame/g"
 )
@@ -70,10 +71,14 @@ func (c *deviceController) Add(ctx context.Context, req *model.DeviceAddReq) (re
 	}
 
 	device := &model.DeviceModel{
-		Id:         req.Id,
-		Name:       req.Name,
-		Status:     "offline",
-		LastActive: time.Now(),
+		Id:                 req.Id,
+		Name:               req.Name,
+		Status:             model.DeviceOffline,
+		OfflineTimeout:     req.OfflineTimeout,
+		RetentionDays:      req.RetentionDays,
+		RetentionMaxBytes:  req.RetentionMaxBytes,
+		RetentionMaxFrames: req.RetentionMaxFrames,
+		LastActive:         time.Now(),
 	}
 	
 	if err = model.Device.Add(ctx, device); err != nil {
@@ -89,8 +94,17 @@ func (c *deviceController) Update(ctx context.Context, req *model.DeviceUpdateRe
 	data := g.Map{
 		"name": req.Name,
 	}
-	if req.Status != "" {
-		data["status"] = req.Status
+	if req.OfflineTimeout != nil {
+		data["offline_timeout"] = *req.OfflineTimeout
+	}
+	if req.RetentionDays != nil {
+		data["retention_days"] = *req.RetentionDays
+	}
+	if req.RetentionMaxBytes != nil {
+		data["retention_max_bytes"] = *req.RetentionMaxBytes
+	}
+	if req.RetentionMaxFrames != nil {
+		data["retention_max_frames"] = *req.RetentionMaxFrames
 	}
 	
 	if err = model.Device.Update(ctx, req.DeviceId, data); err != nil {
@@ -101,8 +115,11 @@ func (c *deviceController) Update(ctx context.Context, req *model.DeviceUpdateRe
 	if err != nil {
 		return nil, err
 	}
-	*res = model.DeviceUpdateRes(*device)
-	return
+	if device == nil {
+		return nil, fmt.Errorf("设备不存在")
+	}
+	result := model.DeviceUpdateRes(*device)
+	return &result, nil
 }
 
 // 删除设备
@@ -111,6 +128,19 @@ func (c *deviceController) Delete(ctx context.Context, req *model.DeviceDeleteRe
 	if err = model.Device.Delete(ctx, req.DeviceId); err != nil {
 		return nil, err
 	}
+	if err := service.GetMQTTService().DeleteShadow(ctx, req.DeviceId); err != nil {
+		log.Printf("删除设备影子失败: %v", err)
+	}
+	if err := model.StatusHistory.Delete(ctx, req.DeviceId); err != nil {
+		log.Printf("删除设备状态历史失败: %v", err)
+	}
+	if err := model.Telemetry.Delete(ctx, req.DeviceId); err != nil {
+		log.Printf("删除设备遥测数据失败: %v", err)
+	}
+	// 帧文件保留在存储中，只删除索引，以免保留策略、历史图像和导出接口继续返回已删除设备的帧
+	if err := model.Image.DeleteDevice(ctx, req.DeviceId); err != nil {
+		log.Printf("删除设备图像索引失败: %v", err)
+	}
 	res = &model.DeviceDeleteRes{Success: true}
 	return
 }
@@ -161,6 +191,63 @@ func (c *deviceController) GetStatus(ctx context.Context, req *model.DeviceStatu
 	return nil, nil
 }
 
+// 获取设备状态变化历史及在线率
+func (c *deviceController) GetStatusHistory(ctx context.Context, req *model.DeviceStatusHistoryReq) (res *model.DeviceStatusHistoryRes, err error) {
+	log.Printf("获取设备状态历史: %s, 时间范围: %s - %s", req.DeviceId, req.StartTime, req.EndTime)
+	r := g.RequestFromCtx(ctx)
+	fail := func(message string) {
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": message,
+			"data":    nil,
+		})
+	}
+
+	end := time.Now()
+	start := end.Add(-24 * time.Hour)
+	if req.EndTime != "" {
+		if end, err = time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local); err != nil {
+			fail(fmt.Sprintf("解析结束时间失败: %v", err))
+			return nil, nil
+		}
+		if req.StartTime == "" {
+			start = end.Add(-24 * time.Hour)
+		}
+	}
+	if req.StartTime != "" {
+		if start, err = time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local); err != nil {
+			fail(fmt.Sprintf("解析开始时间失败: %v", err))
+			return nil, nil
+		}
+	}
+	if !start.Before(end) {
+		fail("开始时间必须早于结束时间")
+		return nil, nil
+	}
+
+	device, err := model.Device.Get(ctx, req.DeviceId)
+	if err != nil {
+		fail(fmt.Sprintf("获取设备信息失败: %v", err))
+		return nil, nil
+	}
+	if device == nil {
+		fail("设备不存在")
+		return nil, nil
+	}
+	report, err := service.DeviceStatusReport(ctx, device, start, end)
+	if err != nil {
+		log.Printf("获取设备状态历史失败: %v", err)
+		fail(fmt.Sprintf("获取设备状态历史失败: %v", err))
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    report,
+	})
+	return nil, nil
+}
+
 // 获取设备实时图像
 func (c *deviceController) GetRealtimeImage(ctx context.Context, req *model.DeviceRealtimeImageReq) (res *model.DeviceRealtimeImageRes, err error) {
 	log.Printf("获取设备实时图像: %s", req.DeviceId)
@@ -197,7 +284,7 @@ func (c *deviceController) GetHistoryImages(ctx context.Context, req *model.Devi
 	log.Printf("获取设备历史图像: %s, 时间范围: %s - %s", req.DeviceId, req.StartTime, req.EndTime)
 	
 	// 获取历史图像列表
-	images, err := model.Device.GetHistoryImages(ctx, req.DeviceId, req.StartTime, req.EndTime)
+	images, err := model.Device.GetHistoryImages(ctx, req.DeviceId, req.StartTime, req.EndTime, !req.NoData)
 	if err != nil {
 		log.Printf("获取历史图像失败: %v", err)
 		r := g.RequestFromCtx(ctx)
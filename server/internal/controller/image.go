@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+var ImageController = new(imageController)
+
+type imageController struct{}
+
+// 获取图像缩略图，成功时直接返回 JPEG
+func (c *imageController) Thumbnail(ctx context.Context, req *model.ImageThumbnailReq) (res *model.ImageRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	image, err := findImage(ctx, req.DeviceId, req.ImageId)
+	if err != nil {
+		writeImageError(r, "获取缩略图失败", err)
+		return nil, nil
+	}
+	data, err := service.GetMQTTService().Thumbnail(ctx, image.StorageKey, req.Size)
+	if err != nil {
+		log.Printf("获取设备 %s 的帧 %s 的缩略图失败: %v", req.DeviceId, image.StorageKey, err)
+		writeImageError(r, "获取缩略图失败", err)
+		return nil, nil
+	}
+	writeImage(r, data, "image/jpeg", req.ImageId != "latest")
+	return nil, nil
+}
+
+// 按指定尺寸、裁剪区域和格式渲染图像，成功时直接返回图像
+func (c *imageController) Render(ctx context.Context, req *model.ImageRenderReq) (res *model.ImageRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	crop, err := service.ParseCrop(req.Crop)
+	if err != nil {
+		writeImageError(r, "渲染图像失败", err)
+		return nil, nil
+	}
+	image, err := findImage(ctx, req.DeviceId, req.ImageId)
+	if err != nil {
+		writeImageError(r, "渲染图像失败", err)
+		return nil, nil
+	}
+	data, contentType, cached, err := service.GetMQTTService().RenderImage(ctx, image.StorageKey, service.RenderOptions{
+		Width:   req.Width,
+		Height:  req.Height,
+		Fit:     req.Fit,
+		Crop:    crop,
+		Quality: req.Quality,
+		Format:  req.Format,
+	})
+	if err != nil {
+		log.Printf("渲染设备 %s 的帧 %s 失败: %v", req.DeviceId, image.StorageKey, err)
+		writeImageError(r, "渲染图像失败", err)
+		return nil, nil
+	}
+	if cached {
+		r.Response.Header().Set("X-Cache", "HIT")
+	} else {
+		r.Response.Header().Set("X-Cache", "MISS")
+	}
+	writeImage(r, data, contentType, req.ImageId != "latest")
+	return nil, nil
+}
+
+// 将一段时间内的原始图像导出为 ZIP，边读取边写出；开始写出之后出错只能中断连接
+func (c *imageController) Export(ctx context.Context, req *model.ImageExportReq) (res *model.ImageRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local)
+	if err != nil {
+		writeImageError(r, "导出图像失败", fmt.Errorf("解析开始时间失败: %v", err))
+		return nil, nil
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local)
+	if err != nil {
+		writeImageError(r, "导出图像失败", fmt.Errorf("解析结束时间失败: %v", err))
+		return nil, nil
+	}
+	var deviceIds []string
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(req.DeviceIds, ",") {
+		if id = strings.TrimSpace(id); id != "" && !seen[id] {
+			seen[id] = true
+			deviceIds = append(deviceIds, id)
+		}
+	}
+
+	// 结束时间精确到秒，同一秒内的帧都计入范围
+	export, err := service.GetMQTTService().PrepareExport(ctx, deviceIds, start, end.Add(time.Second))
+	if err != nil {
+		writeImageError(r, "导出图像失败", err)
+		return nil, nil
+	}
+
+	filename := fmt.Sprintf("frames_%s-%s.zip", start.Format("20060102_150405"), end.Format("20060102_150405"))
+	r.Response.Header().Set("Content-Type", "application/zip")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	log.Printf("开始导出设备 %v 在 %s 至 %s 的 %d 帧", deviceIds, req.StartTime, req.EndTime, export.Frames)
+	manifest, err := export.WriteZip(ctx, r.Response.RawWriter())
+	if err != nil {
+		log.Printf("导出图像中断（已写出 %d 帧）: %v", len(manifest.Frames), err)
+		return nil, nil
+	}
+	log.Printf("导出完成: %d 帧，缺失 %d 帧", len(manifest.Frames), len(manifest.Missing))
+	return nil, nil
+}
+
+// 按ID查找设备的帧，imageId 为 latest 时查找设备最新的一帧
+func findImage(ctx context.Context, deviceId string, imageId string) (*model.ImageModel, error) {
+	var (
+		image *model.ImageModel
+		err   error
+	)
+	if imageId == "latest" {
+		image, err = model.Image.Latest(ctx, deviceId)
+	} else {
+		id, parseErr := strconv.ParseInt(imageId, 10, 64)
+		if parseErr != nil {
+			return nil, fmt.Errorf("非法的图像ID '%s'", imageId)
+		}
+		image, err = model.Image.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查找图像失败: %v", err)
+	}
+	if image == nil || image.DeviceId != deviceId {
+		return nil, fmt.Errorf("未找到图像")
+	}
+	return image, nil
+}
+
+// 返回图像；帧写入后不再改变，按ID请求时允许浏览器长期缓存
+func writeImage(r *ghttp.Request, data []byte, contentType string, immutable bool) {
+	if immutable {
+		r.Response.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		r.Response.Header().Set("Cache-Control", "no-cache")
+	}
+	r.Response.Header().Set("Content-Type", contentType)
+	r.Response.Write(data)
+}
+
+func writeImageError(r *ghttp.Request, action string, err error) {
+	r.Response.WriteJson(g.Map{
+		"code":    1,
+		"message": fmt.Sprintf("%s: %v", action, err),
+		"data":    nil,
+	})
+}
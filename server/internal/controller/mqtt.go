@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var MQTTController = new(mqttController)
+
+type mqttController struct{}
+
+// 获取接收管道统计
+func (c *mqttController) IngestStats(ctx context.Context, req *model.IngestStatsReq) (res *model.IngestStatsRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    service.GetMQTTService().IngestStats(),
+	})
+	return nil, nil
+}
+
+// 手动发布MQTT消息
+func (c *mqttController) Publish(ctx context.Context, req *model.PublishReq) (res *model.PublishRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	publish := &service.PublishRequest{
+		Topic:      req.Topic,
+		Qos:        byte(req.Qos),
+		Retain:     req.Retain,
+		Payload:    []byte(req.Payload),
+		RemoteAddr: r.GetClientIp(),
+		UserAgent:  r.UserAgent(),
+	}
+	if req.Encoding == "base64" {
+		if publish.Payload, err = base64.StdEncoding.DecodeString(req.Payload); err != nil {
+			err = fmt.Errorf("消息内容不是合法的Base64: %v", err)
+			publish.Payload = []byte(req.Payload)
+			r.Response.WriteJson(g.Map{
+				"code":    1,
+				"message": err.Error(),
+				"data":    service.GetMQTTService().RejectPublish(ctx, publish, err),
+			})
+			return nil, nil
+		}
+	}
+	record, err := service.GetMQTTService().Publish(ctx, publish)
+	if err != nil {
+		log.Printf("手动发布消息失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": err.Error(),
+			"data":    record,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    record,
+	})
+	return nil, nil
+}
+
+// 获取手动发布记录
+func (c *mqttController) PublishAudit(ctx context.Context, req *model.PublishAuditListReq) (res *model.PublishRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	if req.Limit <= 0 || req.Limit > 500 {
+		req.Limit = 50
+	}
+	records, err := model.PublishAudit.List(ctx, req.Topic, req.Limit)
+	if err != nil {
+		log.Printf("获取发布记录失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取发布记录失败: %v", err),
+			"data":    []interface{}{},
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    records,
+	})
+	return nil, nil
+}
@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var QuarantineController = new(quarantineController)
+
+type quarantineController struct{}
+
+// 获取隔离记录列表
+func (c *quarantineController) List(ctx context.Context, req *model.QuarantineListReq) (res *model.QuarantineRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	entries, err := service.GetMQTTService().Quarantine().List(req.DeviceId)
+	if err != nil {
+		log.Printf("获取隔离记录失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取隔离记录失败: %v", err),
+			"data":    []interface{}{},
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    entries,
+	})
+	return nil, nil
+}
+
+// 获取隔离记录详情，原始负载以base64返回
+func (c *quarantineController) Get(ctx context.Context, req *model.QuarantineGetReq) (res *model.QuarantineRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	entry, payload, err := service.GetMQTTService().Quarantine().Get(req.Id)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取隔离记录失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data": g.Map{
+			"entry":   entry,
+			"payload": base64.StdEncoding.EncodeToString(payload),
+		},
+	})
+	return nil, nil
+}
+
+// 删除隔离记录
+func (c *quarantineController) Delete(ctx context.Context, req *model.QuarantineDeleteReq) (res *model.QuarantineRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	if err := service.GetMQTTService().Quarantine().Delete(req.Id); err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("删除隔离记录失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	log.Printf("已删除隔离记录: %s", req.Id)
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+	return nil, nil
+}
+
+// 按设备和时间清理隔离记录
+func (c *quarantineController) Purge(ctx context.Context, req *model.QuarantinePurgeReq) (res *model.QuarantineRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	var before time.Time
+	if req.Before != "" {
+		before, err = time.ParseInLocation("2006-01-02 15:04:05", req.Before, time.Local)
+		if err != nil {
+			r.Response.WriteJson(g.Map{
+				"code":    1,
+				"message": fmt.Sprintf("解析时间失败: %v", err),
+				"data":    nil,
+			})
+			return nil, nil
+		}
+	}
+	count, err := service.GetMQTTService().Quarantine().Purge(req.DeviceId, before)
+	if err != nil {
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("清理隔离记录失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	log.Printf("已清理 %d 条隔离记录", count)
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    g.Map{"deleted": count},
+	})
+	return nil, nil
+}
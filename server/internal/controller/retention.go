@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var RetentionController = new(retentionController)
+
+type retentionController struct{}
+
+// 预览保留策略将要清理的帧
+func (c *retentionController) Preview(ctx context.Context, req *model.RetentionPreviewReq) (res *model.RetentionRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	svc := service.GetMQTTService()
+	plans, err := svc.RetentionPreview(ctx, req.DeviceId)
+	if err != nil {
+		log.Printf("预览图像清理失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("预览图像清理失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	frames, bytes := 0, int64(0)
+	for _, plan := range plans {
+		frames += plan.PurgeFrames
+		bytes += plan.PurgeBytes
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data": g.Map{
+			"enabled":     svc.RetentionConfig().Enabled,
+			"purgeFrames": frames,
+			"purgeBytes":  bytes,
+			"devices":     plans,
+		},
+	})
+	return nil, nil
+}
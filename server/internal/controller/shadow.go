@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var ShadowController = new(shadowController)
+
+type shadowController struct{}
+
+// 获取设备影子
+func (c *shadowController) Get(ctx context.Context, req *model.ShadowGetReq) (res *model.ShadowRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	doc, err := getShadowDocument(ctx, req.DeviceId)
+	if err != nil {
+		log.Printf("获取设备影子失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取设备影子失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    doc,
+	})
+	return nil, nil
+}
+
+// 替换期望状态
+func (c *shadowController) UpdateDesired(ctx context.Context, req *model.ShadowDesiredUpdateReq) (res *model.ShadowRes, err error) {
+	log.Printf("替换设备 %s 的期望状态: %v", req.DeviceId, req.State)
+	c.writeDesired(ctx, req.DeviceId, req.State, false)
+	return nil, nil
+}
+
+// 合并更新期望状态
+func (c *shadowController) PatchDesired(ctx context.Context, req *model.ShadowDesiredPatchReq) (res *model.ShadowRes, err error) {
+	log.Printf("合并更新设备 %s 的期望状态: %v", req.DeviceId, req.State)
+	c.writeDesired(ctx, req.DeviceId, req.State, true)
+	return nil, nil
+}
+
+func (c *shadowController) writeDesired(ctx context.Context, deviceId string, state g.Map, merge bool) {
+	r := g.RequestFromCtx(ctx)
+	doc, err := service.GetMQTTService().UpdateShadowDesired(ctx, deviceId, state, merge)
+	if err != nil {
+		log.Printf("更新期望状态失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("更新期望状态失败: %v", err),
+			"data":    nil,
+		})
+		return
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    doc,
+	})
+}
+
+// 获取期望状态与上报状态的差异
+func (c *shadowController) Delta(ctx context.Context, req *model.ShadowDeltaReq) (res *model.ShadowRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	doc, err := getShadowDocument(ctx, req.DeviceId)
+	if err != nil {
+		log.Printf("获取设备影子失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取设备影子失败: %v", err),
+			"data":    nil,
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data": g.Map{
+			"deviceId":        doc.DeviceId,
+			"delta":           doc.Delta,
+			"desiredVersion":  doc.DesiredVersion,
+			"reportedVersion": doc.ReportedVersion,
+			"inSync":          len(doc.Delta) == 0,
+		},
+	})
+	return nil, nil
+}
+
+// 列出尚未应用期望状态的设备
+func (c *shadowController) DeltaList(ctx context.Context, req *model.ShadowDeltaListReq) (res *model.ShadowRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	shadows, err := model.Shadow.List(ctx)
+	if err != nil {
+		log.Printf("获取设备影子列表失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取设备影子列表失败: %v", err),
+			"data":    []interface{}{},
+		})
+		return nil, nil
+	}
+	docs := make([]*model.ShadowDocument, 0)
+	for i := range shadows {
+		if doc := shadows[i].Document(); len(doc.Delta) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    docs,
+	})
+	return nil, nil
+}
+
+// 获取设备影子，尚未创建时返回空文档
+func getShadowDocument(ctx context.Context, deviceId string) (*model.ShadowDocument, error) {
+	shadow, err := model.Shadow.Get(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	if shadow == nil {
+		shadow = &model.ShadowModel{DeviceId: deviceId}
+	}
+	return shadow.Document(), nil
+}
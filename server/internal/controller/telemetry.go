@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var TelemetryController = new(telemetryController)
+
+type telemetryController struct{}
+
+// 自动选择时间桶长度时的目标桶数，以及单个指标允许的最大桶数
+const (
+	telemetryTargetBuckets = 300
+	telemetryMaxBuckets    = 10000
+)
+
+// 一个指标的降采样结果
+type telemetrySeries struct {
+	Metric string                  `json:"metric"`
+	Points []model.TelemetryBucket `json:"points"`
+}
+
+// 查询设备遥测数据
+func (c *telemetryController) Query(ctx context.Context, req *model.TelemetryQueryReq) (res *model.TelemetryQueryRes, err error) {
+	log.Printf("查询设备遥测数据: %s, 指标: %s, 时间范围: %s - %s, 步长: %d", req.DeviceId, req.Metric, req.From, req.To, req.Step)
+	r := g.RequestFromCtx(ctx)
+	fail := func(message string) {
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": message,
+			"data":    nil,
+		})
+	}
+
+	end := time.Now()
+	if req.To != "" {
+		if end, err = time.ParseInLocation("2006-01-02 15:04:05", req.To, time.Local); err != nil {
+			fail(fmt.Sprintf("解析结束时间失败: %v", err))
+			return nil, nil
+		}
+	}
+	start := end.Add(-24 * time.Hour)
+	if req.From != "" {
+		if start, err = time.ParseInLocation("2006-01-02 15:04:05", req.From, time.Local); err != nil {
+			fail(fmt.Sprintf("解析开始时间失败: %v", err))
+			return nil, nil
+		}
+	}
+	if !start.Before(end) {
+		fail("开始时间必须早于结束时间")
+		return nil, nil
+	}
+
+	span := end.Sub(start)
+	if req.Step < 0 {
+		fail("步长不能为负数")
+		return nil, nil
+	}
+	step := time.Duration(req.Step) * time.Second
+	if step == 0 {
+		step = (span/telemetryTargetBuckets + time.Second - 1).Truncate(time.Second)
+		if step < time.Second {
+			step = time.Second
+		}
+	}
+	if span/step > telemetryMaxBuckets {
+		fail(fmt.Sprintf("时间桶数量超过上限 %d，请增大步长或缩小时间范围", telemetryMaxBuckets))
+		return nil, nil
+	}
+
+	var metrics []string
+	for _, metric := range strings.Split(req.Metric, ",") {
+		if metric = strings.TrimSpace(metric); metric != "" {
+			metrics = append(metrics, metric)
+		}
+	}
+	if len(metrics) == 0 {
+		if metrics, err = model.Telemetry.Metrics(ctx, req.DeviceId); err != nil {
+			log.Printf("获取遥测指标失败: %v", err)
+			fail(fmt.Sprintf("获取遥测指标失败: %v", err))
+			return nil, nil
+		}
+	}
+
+	buckets, err := model.Telemetry.Query(ctx, req.DeviceId, metrics, start, end, step)
+	if err != nil {
+		log.Printf("查询遥测数据失败: %v", err)
+		fail(fmt.Sprintf("查询遥测数据失败: %v", err))
+		return nil, nil
+	}
+	series := make([]telemetrySeries, 0, len(metrics))
+	index := make(map[string]int, len(metrics))
+	for _, metric := range metrics {
+		if _, ok := index[metric]; ok {
+			continue
+		}
+		index[metric] = len(series)
+		series = append(series, telemetrySeries{Metric: metric, Points: make([]model.TelemetryBucket, 0)})
+	}
+	for _, bucket := range buckets {
+		i := index[bucket.Metric]
+		series[i].Points = append(series[i].Points, bucket)
+	}
+
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data": g.Map{
+			"deviceId": req.DeviceId,
+			"from":     start,
+			"to":       end,
+			"step":     int(step / time.Second),
+			"series":   series,
+		},
+	})
+	return nil, nil
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/service"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+var TimelapseController = new(timelapseController)
+
+type timelapseController struct{}
+
+// 创建延时视频任务，任务在后台执行，通过任务详情查询进度
+func (c *timelapseController) Create(ctx context.Context, req *model.TimelapseCreateReq) (res *model.TimelapseRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	start, err := time.ParseInLocation("2006-01-02 15:04:05", req.StartTime, time.Local)
+	if err != nil {
+		writeImageError(r, "创建延时视频任务失败", fmt.Errorf("解析开始时间失败: %v", err))
+		return nil, nil
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04:05", req.EndTime, time.Local)
+	if err != nil {
+		writeImageError(r, "创建延时视频任务失败", fmt.Errorf("解析结束时间失败: %v", err))
+		return nil, nil
+	}
+	job, err := service.GetMQTTService().Timelapse().Submit(ctx, service.TimelapseRequest{
+		DeviceId: req.DeviceId,
+		Start:    start,
+		End:      end.Add(time.Second), // 结束时间精确到秒，同一秒内的帧都计入范围
+		Fps:      req.Fps,
+		Skip:     req.Skip,
+		Gif:      req.Gif,
+		GifWidth: req.GifWidth,
+	})
+	if err != nil {
+		writeImageError(r, "创建延时视频任务失败", err)
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    job,
+	})
+	return nil, nil
+}
+
+// 获取延时视频任务列表
+func (c *timelapseController) List(ctx context.Context, req *model.TimelapseListReq) (res *model.TimelapseRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	jobs, err := service.GetMQTTService().Timelapse().List(req.DeviceId)
+	if err != nil {
+		log.Printf("获取延时视频任务失败: %v", err)
+		r.Response.WriteJson(g.Map{
+			"code":    1,
+			"message": fmt.Sprintf("获取延时视频任务失败: %v", err),
+			"data":    []interface{}{},
+		})
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    jobs,
+	})
+	return nil, nil
+}
+
+// 获取延时视频任务详情
+func (c *timelapseController) Get(ctx context.Context, req *model.TimelapseGetReq) (res *model.TimelapseRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	job, err := service.GetMQTTService().Timelapse().Get(req.Id)
+	if err != nil {
+		writeImageError(r, "获取延时视频任务失败", err)
+		return nil, nil
+	}
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    job,
+	})
+	return nil, nil
+}
+
+// 下载生成的文件，任务未完成时返回错误
+func (c *timelapseController) Download(ctx context.Context, req *model.TimelapseDownloadReq) (res *model.TimelapseRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	timelapse := service.GetMQTTService().Timelapse()
+	path, err := timelapse.Artifact(req.Id, req.Format)
+	if err != nil {
+		writeImageError(r, "下载延时视频失败", err)
+		return nil, nil
+	}
+	job, err := timelapse.Get(req.Id)
+	if err != nil {
+		writeImageError(r, "下载延时视频失败", err)
+		return nil, nil
+	}
+	format := service.TimelapseAVI
+	if req.Format == service.TimelapseGIF {
+		format = service.TimelapseGIF
+	}
+	r.Response.ServeFileDownload(path, fmt.Sprintf("%s_%s-%s.%s", job.DeviceId,
+		job.StartTime.Format("20060102_150405"), job.EndTime.Add(-time.Second).Format("20060102_150405"), format))
+	return nil, nil
+}
+
+// 删除延时视频任务
+func (c *timelapseController) Delete(ctx context.Context, req *model.TimelapseDeleteReq) (res *model.TimelapseRes, err error) {
+	r := g.RequestFromCtx(ctx)
+	if err := service.GetMQTTService().Timelapse().Delete(req.Id); err != nil {
+		writeImageError(r, "删除延时视频任务失败", err)
+		return nil, nil
+	}
+	log.Printf("已删除延时视频任务: %s", req.Id)
+	r.Response.WriteJson(g.Map{
+		"code":    0,
+		"message": "success",
+		"data":    nil,
+	})
+	return nil, nil
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+)
+
+// 管理接口鉴权：请求需携带 Authorization: Bearer <admin.token>，未配置令牌时拒绝所有请求
+func AdminAuth(token string) ghttp.HandlerFunc {
+	return func(r *ghttp.Request) {
+		if token == "" {
+			r.Response.WriteHeader(http.StatusForbidden)
+			r.Response.WriteJson(g.Map{
+				"code":    1,
+				"message": "未配置管理员令牌，管理接口不可用",
+				"data":    nil,
+			})
+			r.Exit()
+		}
+		given := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+		if given == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			log.Printf("管理接口鉴权失败: %s %s，来源: %s", r.Method, r.URL.Path, r.GetClientIp())
+			r.Response.WriteHeader(http.StatusUnauthorized)
+			r.Response.WriteJson(g.Map{
+				"code":    1,
+				"message": "管理员令牌无效",
+				"data":    nil,
+			})
+			r.Exit()
+		}
+		r.Middleware.Next()
+	}
+}
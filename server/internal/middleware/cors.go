@@ -7,7 +7,7 @@ import (
 var (
 	CORS = func(r *ghttp.Request) {
 		r.Response.Header().Set("Access-Control-Allow-Origin", "*")
-		r.Response.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		r.Response.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		r.Response.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization")
 		r.Response.Header().Set("Access-Control-Max-Age", "3600")
 		r.Response.Header().Set("Access-Control-Allow-Credentials", "true")
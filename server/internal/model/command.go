@@ -0,0 +1,173 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 命令状态
+const (
+	CommandPending  = "pending"   // 已下发，等待设备确认
+	CommandAcked    = "acked"     // 设备已确认执行成功
+	CommandFailed   = "failed"    // 下发失败或设备报告执行失败
+	CommandTimedOut = "timed_out" // 超时未收到确认
+)
+
+// CommandModel 设备命令表结构
+type CommandModel struct {
+	Id        string     `json:"id" dc:"命令ID"`
+	DeviceId  string     `json:"deviceId" dc:"设备ID"`
+	Name      string     `json:"name" dc:"命令名称"`
+	Params    string     `json:"params" dc:"命令参数（JSON）"`
+	Status    string     `json:"status" dc:"命令状态 pending/acked/failed/timed_out"`
+	Result    string     `json:"result" dc:"设备返回的结果（JSON）"`
+	Error     string     `json:"error" dc:"失败原因"`
+	CreatedAt time.Time  `json:"createdAt" dc:"创建时间"`
+	ExpiresAt time.Time  `json:"expiresAt" dc:"确认截止时间"`
+	AckedAt   *time.Time `json:"ackedAt" dc:"确认时间"`
+	UpdatedAt time.Time  `json:"updatedAt" dc:"更新时间"`
+}
+
+// 请求结构体
+type CommandSendReq struct {
+	g.Meta   `path:"/devices/{deviceId}/commands" method:"post" tags:"设备命令" summary:"向设备下发命令（需要管理员令牌）"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	Name     string `json:"name" v:"required" dc:"命令名称，例如 capture_now、set_interval、reboot"`
+	Params   g.Map  `json:"params" dc:"命令参数"`
+	Timeout  int    `json:"timeout" dc:"等待确认的超时时间（秒），为0时使用默认值"`
+}
+
+type CommandListReq struct {
+	g.Meta   `path:"/devices/{deviceId}/commands" method:"get" tags:"设备命令" summary:"获取设备命令历史"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	Limit    int    `json:"limit" d:"50" dc:"返回条数"`
+}
+
+type CommandGetReq struct {
+	g.Meta    `path:"/devices/{deviceId}/commands/{commandId}" method:"get" tags:"设备命令" summary:"获取命令详情"`
+	DeviceId  string `json:"deviceId" v:"required" dc:"设备ID"`
+	CommandId string `json:"commandId" v:"required" dc:"命令ID"`
+}
+
+type CommandRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// 命令数据访问对象
+type CommandDao struct{}
+
+var Command = new(CommandDao)
+
+// 初始化数据库表
+func (dao *CommandDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS device_command (
+		id VARCHAR(64) PRIMARY KEY,
+		device_id VARCHAR(64) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		params TEXT,
+		status VARCHAR(20) NOT NULL DEFAULT 'pending',
+		result TEXT,
+		error VARCHAR(1024),
+		created_at DATETIME(3),
+		expires_at DATETIME(3),
+		acked_at DATETIME(3) NULL,
+		updated_at DATETIME(3),
+		INDEX idx_device_created (device_id, created_at),
+		INDEX idx_status_expires (status, expires_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	_, err := g.DB().Exec(ctx, sql)
+	return err
+}
+
+// 添加命令
+func (dao *CommandDao) Add(ctx g.Ctx, cmd *CommandModel) error {
+	_, err := g.DB().Model("device_command").Ctx(ctx).Data(g.Map{
+		"id":         cmd.Id,
+		"device_id":  cmd.DeviceId,
+		"name":       cmd.Name,
+		"params":     cmd.Params,
+		"status":     cmd.Status,
+		"created_at": cmd.CreatedAt,
+		"expires_at": cmd.ExpiresAt,
+		"updated_at": cmd.UpdatedAt,
+	}).Insert()
+	return err
+}
+
+// 获取单条命令
+func (dao *CommandDao) Get(ctx g.Ctx, deviceId string, id string) (cmd *CommandModel, err error) {
+	err = g.DB().Model("device_command").Ctx(ctx).Where("id", id).Where("device_id", deviceId).Scan(&cmd)
+	return cmd, err
+}
+
+// 获取设备的命令历史，按创建时间倒序
+func (dao *CommandDao) List(ctx g.Ctx, deviceId string, limit int) (cmds []CommandModel, err error) {
+	cmds = make([]CommandModel, 0)
+	err = g.DB().Model("device_command").Ctx(ctx).
+		Where("device_id", deviceId).
+		OrderDesc("created_at").
+		Limit(limit).
+		Scan(&cmds)
+	return cmds, err
+}
+
+// 记录设备确认结果，只更新仍在等待确认的命令，返回是否更新成功
+func (dao *CommandDao) Ack(ctx g.Ctx, deviceId string, id string, success bool, result string, errMsg string) (bool, error) {
+	now := time.Now()
+	status := CommandAcked
+	if !success {
+		status = CommandFailed
+	}
+	r, err := g.DB().Model("device_command").Ctx(ctx).
+		Where("id", id).
+		Where("device_id", deviceId).
+		Where("status", CommandPending).
+		Data(g.Map{
+			"status":     status,
+			"result":     result,
+			"error":      errMsg,
+			"acked_at":   now,
+			"updated_at": now,
+		}).
+		Update()
+	if err != nil {
+		return false, err
+	}
+	n, err := r.RowsAffected()
+	return n > 0, err
+}
+
+// 标记命令失败
+func (dao *CommandDao) Fail(ctx g.Ctx, id string, errMsg string) error {
+	_, err := g.DB().Model("device_command").Ctx(ctx).
+		Where("id", id).
+		Data(g.Map{
+			"status":     CommandFailed,
+			"error":      errMsg,
+			"updated_at": time.Now(),
+		}).
+		Update()
+	return err
+}
+
+// 将超过截止时间仍未确认的命令标记为超时，返回更新的条数
+func (dao *CommandDao) ExpirePending(ctx g.Ctx, now time.Time) (int64, error) {
+	r, err := g.DB().Model("device_command").Ctx(ctx).
+		Where("status", CommandPending).
+		WhereLT("expires_at", now).
+		Data(g.Map{
+			"status":     CommandTimedOut,
+			"error":      "等待设备确认超时",
+			"updated_at": now,
+		}).
+		Update()
+	if err != nil {
+		return 0, err
+	}
+	return r.RowsAffected()
+}
@@ -3,22 +3,40 @@ package model
 import (
 	"encoding/base64"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"path/filepath"
 	"time"
+	"video-platform/internal/storage"
 
 	"github.com/gogf/gf/v2/frame/g"
 )
 
+// 设备状态
+const (
+	DeviceOnline   = "online"
+	DeviceOffline  = "offline"
+	DeviceDegraded = "degraded" // 仍在连接但没有按时上传图像
+)
+
+// 设备状态来源
+const (
+	PresenceHeuristic = "heuristic" // 根据最后一帧图像的时间推断
+	PresenceStatus    = "status"    // 设备通过 device/{id}/status 主题和遗嘱消息上报
+)
+
 // DeviceModel 设备表结构
 type DeviceModel struct {
-	Id         string    `json:"id" dc:"设备ID"`
-	Name       string    `json:"name" dc:"设备名称"`
-	Status     string    `json:"status" dc:"设备状态 online/offline"`
-	LastActive time.Time `json:"lastActive" dc:"最后活跃时间"`
-	CreatedAt  time.Time `json:"createdAt" dc:"创建时间"`
-	UpdatedAt  time.Time `json:"updatedAt" dc:"更新时间"`
+	Id                 string    `json:"id" dc:"设备ID"`
+	Name               string    `json:"name" dc:"设备名称"`
+	Status             string    `json:"status" dc:"设备状态 online/offline/degraded，由状态监控维护"`
+	PresenceSource     string    `json:"presenceSource" dc:"状态来源 heuristic/status"`
+	ReportedStatus     string    `json:"reportedStatus" dc:"设备通过状态主题上报的状态 online/offline"`
+	OfflineTimeout     int       `json:"offlineTimeout" dc:"无图像多少秒后判定离线，0 表示使用默认值"`
+	RetentionDays      int       `json:"retentionDays" dc:"帧的最长保留天数，0 表示使用全局配置，-1 表示不限制"`
+	RetentionMaxBytes  int64     `json:"retentionMaxBytes" dc:"帧的最大总字节数，0 表示使用全局配置，-1 表示不限制"`
+	RetentionMaxFrames int       `json:"retentionMaxFrames" dc:"帧的最大数量，0 表示使用全局配置，-1 表示不限制"`
+	LastActive         time.Time `json:"lastActive" dc:"最后活跃时间"`
+	CreatedAt          time.Time `json:"createdAt" dc:"创建时间"`
+	UpdatedAt          time.Time `json:"updatedAt" dc:"更新时间"`
 }
 
 // 请求结构体
@@ -32,16 +50,23 @@ type DeviceGetReq struct {
 }
 
 type DeviceAddReq struct {
-	g.Meta `path:"/devices" method:"post" tags:"设备管理" summary:"添加设备"`
-	Id     string `json:"id" v:"required" dc:"设备ID"`
-	Name   string `json:"name" v:"required" dc:"设备名称"`
+	g.Meta             `path:"/devices" method:"post" tags:"设备管理" summary:"添加设备"`
+	Id                 string `json:"id" v:"required|regex:^[A-Za-z0-9_.-]{1,64}$|not-in:.,..#设备ID不能为空|设备ID只能包含字母、数字、下划线、点和中划线，长度为1-64|设备ID不能为 . 或 .." dc:"设备ID，会用于MQTT主题和存储目录"`
+	Name               string `json:"name" v:"required" dc:"设备名称"`
+	OfflineTimeout     int    `json:"offlineTimeout" v:"min:0" dc:"无图像多少秒后判定离线，0 表示使用默认值"`
+	RetentionDays      int    `json:"retentionDays" v:"min:-1" dc:"帧的最长保留天数，0 表示使用全局配置，-1 表示不限制"`
+	RetentionMaxBytes  int64  `json:"retentionMaxBytes" v:"min:-1" dc:"帧的最大总字节数，0 表示使用全局配置，-1 表示不限制"`
+	RetentionMaxFrames int    `json:"retentionMaxFrames" v:"min:-1" dc:"帧的最大数量，0 表示使用全局配置，-1 表示不限制"`
 }
 
 type DeviceUpdateReq struct {
-	g.Meta   `path:"/devices/{deviceId}" method:"put" tags:"设备管理" summary:"更新设备"`
-	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
-	Name     string `json:"name" v:"required" dc:"设备名称"`
-	Status   string `json:"status" dc:"设备状态"`
+	g.Meta             `path:"/devices/{deviceId}" method:"put" tags:"设备管理" summary:"更新设备"`
+	DeviceId           string `json:"deviceId" v:"required" dc:"设备ID"`
+	Name               string `json:"name" v:"required" dc:"设备名称"`
+	OfflineTimeout     *int   `json:"offlineTimeout" v:"min:0" dc:"无图像多少秒后判定离线，0 表示使用默认值，不传时保持不变"`
+	RetentionDays      *int   `json:"retentionDays" v:"min:-1" dc:"帧的最长保留天数，0 表示使用全局配置，-1 表示不限制，不传时保持不变"`
+	RetentionMaxBytes  *int64 `json:"retentionMaxBytes" v:"min:-1" dc:"帧的最大总字节数，0 表示使用全局配置，-1 表示不限制，不传时保持不变"`
+	RetentionMaxFrames *int   `json:"retentionMaxFrames" v:"min:-1" dc:"帧的最大数量，0 表示使用全局配置，-1 表示不限制，不传时保持不变"`
 }
 
 type DeviceDeleteReq struct {
@@ -89,12 +114,14 @@ type DeviceHistoryImageReq struct {
 	DeviceId  string `json:"deviceId" v:"required" dc:"设备ID"`
 	StartTime string `json:"startTime" v:"required" dc:"开始时间"`
 	EndTime   string `json:"endTime" v:"required" dc:"结束时间"`
+	NoData    bool   `json:"noData" dc:"为 true 时不返回图像数据，通过缩略图接口按 id 获取图像"`
 }
 
 type DeviceHistoryImageRes struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    []struct {
+		Id        int64  `json:"id"`
 		Timestamp string `json:"timestamp"`
 		ImageData string `json:"imageData"`
 	} `json:"data"`
@@ -114,10 +141,22 @@ type DeviceRealtimeImageRes struct {
 }
 
 // 设备数据访问对象
-type DeviceDao struct{}
+type DeviceDao struct {
+	storage storage.Storage // 图像存储
+}
 
 var Device = new(DeviceDao)
 
+// 设置图像存储，与接收图像使用的存储保持一致
+func (dao *DeviceDao) SetStorage(st storage.Storage) {
+	dao.storage = st
+}
+
+// 获取图像存储
+func (dao *DeviceDao) Storage() storage.Storage {
+	return dao.storage
+}
+
 // 获取所有设备
 func (dao *DeviceDao) List(ctx g.Ctx) (devices []DeviceModel, err error) {
 	log.Printf("正在从数据库获取设备列表...")
@@ -152,6 +191,13 @@ func (dao *DeviceDao) List(ctx g.Ctx) (devices []DeviceModel, err error) {
 	return devices, nil
 }
 
+// 获取所有设备，不输出日志，供后台定期任务使用
+func (dao *DeviceDao) All(ctx g.Ctx) (devices []DeviceModel, err error) {
+	devices = make([]DeviceModel, 0)
+	err = g.DB().Model("device").Ctx(ctx).Scan(&devices)
+	return devices, err
+}
+
 // 获取单个设备
 func (dao *DeviceDao) Get(ctx g.Ctx, id string) (device *DeviceModel, err error) {
 	err = g.DB().Model("device").Where("id", id).Scan(&device)
@@ -160,37 +206,6 @@ func (dao *DeviceDao) Get(ctx g.Ctx, id string) (device *DeviceModel, err error)
 		return nil, err
 	}
 	
-	// 检查设备状态
-	if device != nil {
-		// 计算时间差
-		now := time.Now()
-		timeDiff := now.Sub(device.LastActive)
-		log.Printf("设备 %s 状态检查:", id)
-		log.Printf("- 最后活跃时间: %v", device.LastActive)
-		log.Printf("- 当前时间: %v", now)
-		log.Printf("- 时间差: %.2f秒", timeDiff.Seconds())
-		log.Printf("- 当前状态: %s", device.Status)
-		
-		// 如果最后活跃时间超过15秒，将状态设置为离线
-		if timeDiff > 15*time.Second {
-			device.Status = "offline"
-			log.Printf("设备 %s 已超过15秒无活动，标记为离线", id)
-			// 更新数据库中的状态
-			_ = dao.Update(ctx, id, g.Map{
-				"status": "offline",
-			})
-		} else if device.Status == "offline" && timeDiff <= 15*time.Second {
-			// 如果设备状态为离线，但最后活跃时间在15秒内，则更新为在线
-			device.Status = "online"
-			log.Printf("设备 %s 在15秒内有活动，标记为在线", id)
-			_ = dao.Update(ctx, id, g.Map{
-				"status": "online",
-			})
-		}
-		
-		log.Printf("设备 %s 最终状态: %s", id, device.Status)
-	}
-	
 	return device, nil
 }
 
@@ -198,6 +213,9 @@ func (dao *DeviceDao) Get(ctx g.Ctx, id string) (device *DeviceModel, err error)
 func (dao *DeviceDao) Add(ctx g.Ctx, device *DeviceModel) error {
 	device.CreatedAt = time.Now()
 	device.UpdatedAt = time.Now()
+	if device.PresenceSource == "" {
+		device.PresenceSource = PresenceHeuristic
+	}
 	_, err := g.DB().Model("device").Data(device).Insert()
 	return err
 }
@@ -215,26 +233,49 @@ func (dao *DeviceDao) Delete(ctx g.Ctx, id string) error {
 	return err
 }
 
-// 更新设备状态
-func (dao *DeviceDao) UpdateStatus(ctx g.Ctx, id string, status string) error {
+// 收到图像时刷新最后活跃时间，设备状态由状态监控根据该时间判断
+func (dao *DeviceDao) Touch(ctx g.Ctx, id string) error {
 	now := time.Now()
-	log.Printf("更新设备 %s 状态为 %s，时间：%v", id, status, now)
-	
-	_, err := g.DB().Model("device").
+	_, err := g.DB().Model("device").Ctx(ctx).
 		Where("id", id).
 		Data(g.Map{
-			"status":      status,
 			"last_active": now,
 			"updated_at":  now,
 		}).
 		Update()
-		
 	if err != nil {
-		log.Printf("更新设备状态失败: %v", err)
+		log.Printf("更新设备活跃时间失败: %v", err)
 	}
 	return err
 }
 
+// 记录设备通过状态主题上报的在线状态，设备状态由状态监控根据上报结果判断
+func (dao *DeviceDao) ReportStatus(ctx g.Ctx, id string, status string) error {
+	now := time.Now()
+	data := g.Map{
+		"reported_status": status,
+		"presence_source": PresenceStatus,
+		"updated_at":      now,
+	}
+	if status == DeviceOnline {
+		data["last_active"] = now
+	}
+	_, err := g.DB().Model("device").Ctx(ctx).Where("id", id).Data(data).Update()
+	return err
+}
+
+// 记录状态监控判断出的设备状态
+func (dao *DeviceDao) SetStatus(ctx g.Ctx, id string, status string) error {
+	_, err := g.DB().Model("device").Ctx(ctx).
+		Where("id", id).
+		Data(g.Map{
+			"status":     status,
+			"updated_at": time.Now(),
+		}).
+		Update()
+	return err
+}
+
 // 初始化数据库表
 func (dao *DeviceDao) InitTable(ctx g.Ctx) error {
 	sql := `
@@ -242,6 +283,12 @@ func (dao *DeviceDao) InitTable(ctx g.Ctx) error {
 		id VARCHAR(64) PRIMARY KEY,
 		name VARCHAR(255) NOT NULL,
 		status VARCHAR(20) NOT NULL DEFAULT 'offline',
+		presence_source VARCHAR(20) NOT NULL DEFAULT 'heuristic',
+		reported_status VARCHAR(20) NOT NULL DEFAULT '',
+		offline_timeout INT NOT NULL DEFAULT 0,
+		retention_days INT NOT NULL DEFAULT 0,
+		retention_max_bytes BIGINT NOT NULL DEFAULT 0,
+		retention_max_frames INT NOT NULL DEFAULT 0,
 		last_active DATETIME,
 		created_at DATETIME,
 		updated_at DATETIME,
@@ -249,7 +296,41 @@ func (dao *DeviceDao) InitTable(ctx g.Ctx) error {
 		INDEX idx_last_active (last_active)
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 	`
-	_, err := g.DB().Exec(ctx, sql)
+	if _, err := g.DB().Exec(ctx, sql); err != nil {
+		return err
+	}
+	// 旧版本创建的表缺少以下字段
+	if err := ensureColumn(ctx, "device", "presence_source", "VARCHAR(20) NOT NULL DEFAULT 'heuristic' AFTER status"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, "device", "reported_status", "VARCHAR(20) NOT NULL DEFAULT '' AFTER presence_source"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, "device", "offline_timeout", "INT NOT NULL DEFAULT 0 AFTER reported_status"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, "device", "retention_days", "INT NOT NULL DEFAULT 0 AFTER offline_timeout"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, "device", "retention_max_bytes", "BIGINT NOT NULL DEFAULT 0 AFTER retention_days"); err != nil {
+		return err
+	}
+	return ensureColumn(ctx, "device", "retention_max_frames", "INT NOT NULL DEFAULT 0 AFTER retention_max_bytes")
+}
+
+// 字段不存在时添加
+func ensureColumn(ctx g.Ctx, table string, column string, definition string) error {
+	count, err := g.DB().GetCount(ctx,
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?",
+		table, column)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	log.Printf("为表 %s 添加字段 %s", table, column)
+	_, err = g.DB().Exec(ctx, fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", table, column, definition))
 	return err
 }
 
@@ -269,34 +350,24 @@ func (dao *DeviceDao) GetLatestImage(ctx g.Ctx, deviceId string) (string, error)
 		return "", fmt.Errorf("设备不存在")
 	}
 
-	// 获取当前工作目录
-	workDir, err := filepath.Abs(".")
-	if err != nil {
-		log.Printf("获取工作目录失败: %v", err)
-		return "", fmt.Errorf("获取工作目录失败: %v", err)
-	}
-
-	// 使用绝对路径查找图像文件
-	pattern := filepath.Join(workDir, "images", deviceId, "*.jpg")
-	log.Printf("查找图像文件: %s", pattern)
-	
-	files, err := filepath.Glob(pattern)
+	// 从图像索引中查找设备最新的帧
+	latest, err := Image.Latest(ctx, deviceId)
 	if err != nil {
 		log.Printf("查找图像文件失败: %v", err)
 		return "", fmt.Errorf("查找图像文件失败: %v", err)
 	}
 
-	if len(files) == 0 {
+	if latest == nil {
 		log.Printf("设备 %s 未找到图像文件", deviceId)
 		return "", fmt.Errorf("未找到图像文件")
 	}
 
 	// 获取最新的图像文件
-	latestFile := files[len(files)-1]
+	latestFile := latest.StorageKey
 	log.Printf("找到最新图像文件: %s", latestFile)
 
 	// 读取图像文件
-	imageData, err := ioutil.ReadFile(latestFile)
+	imageData, err := ReadFrame(ctx, dao.storage, latestFile)
 	if err != nil {
 		log.Printf("读取图像文件失败: %v", err)
 		return "", fmt.Errorf("读取图像文件失败: %v", err)
@@ -310,7 +381,8 @@ func (dao *DeviceDao) GetLatestImage(ctx g.Ctx, deviceId string) (string, error)
 }
 
 // 获取历史图像
-func (dao *DeviceDao) GetHistoryImages(ctx g.Ctx, deviceId string, startTime string, endTime string) ([]struct {
+func (dao *DeviceDao) GetHistoryImages(ctx g.Ctx, deviceId string, startTime string, endTime string, withData bool) ([]struct {
+	Id        int64  `json:"id"`
 	Timestamp string `json:"timestamp"`
 	ImageData string `json:"imageData"`
 }, error) {
@@ -330,58 +402,44 @@ func (dao *DeviceDao) GetHistoryImages(ctx g.Ctx, deviceId string, startTime str
 	
 	log.Printf("解析后的时间范围: %v 至 %v", start.Format("2006-01-02 15:04:05"), end.Format("2006-01-02 15:04:05"))
 	
-	// 获取当前工作目录
-	workDir, err := filepath.Abs(".")
-	if err != nil {
-		return nil, fmt.Errorf("获取工作目录失败: %v", err)
-	}
-	log.Printf("当前工作目录: %s", workDir)
-	
-	// 从文件系统获取指定时间范围内的图像
-	pattern := filepath.Join(workDir, "images", deviceId, "*.jpg")
-	log.Printf("查找图像文件: %s", pattern)
-	files, err := filepath.Glob(pattern)
+	// 从图像索引查询指定时间范围内的帧
+	// 结束时间精确到秒，同一秒内的帧都计入范围
+	frames, err := Image.Range(ctx, deviceId, start, end.Add(time.Second))
 	if err != nil {
 		return nil, fmt.Errorf("查找图像文件失败: %v", err)
 	}
 	
-	log.Printf("找到 %d 个图像文件", len(files))
+	log.Printf("找到 %d 个图像文件", len(frames))
 	
 	var images []struct {
+		Id        int64  `json:"id"`
 		Timestamp string `json:"timestamp"`
 		ImageData string `json:"imageData"`
 	}
 	
-	for _, file := range files {
-		// 从文件名解析时间戳
-		timestamp := filepath.Base(file)
-		timestamp = timestamp[:len(timestamp)-4] // 移除 .jpg 后缀
-		fileTime, err := time.ParseInLocation("20060102_150405", timestamp, loc)
-		if err != nil {
-			log.Printf("解析文件时间戳失败: %s, %v", timestamp, err)
-			continue
-		}
-		
-		// 检查时间范围
-		if fileTime.Before(start) || fileTime.After(end) {
-			log.Printf("文件 %s 不在时间范围内: %v", file, fileTime.Format("2006-01-02 15:04:05"))
-			continue
-		}
+	for _, frame := range frames {
+		file := frame.StorageKey
+		fileTime := frame.FrameTime
 		
 		log.Printf("处理文件: %s, 时间: %v", file, fileTime.Format("2006-01-02 15:04:05"))
 		
-		// 读取图像文件
-		imageData, err := ioutil.ReadFile(file)
-		if err != nil {
-			log.Printf("读取图像文件失败: %v", err)
-			continue
+		// 读取图像文件，不需要图像数据时跳过
+		var imageData []byte
+		if withData {
+			imageData, err = ReadFrame(ctx, dao.storage, file)
+			if err != nil {
+				log.Printf("读取图像文件失败: %v", err)
+				continue
+			}
 		}
 		
 		// 添加到结果列表
 		images = append(images, struct {
+			Id        int64  `json:"id"`
 			Timestamp string `json:"timestamp"`
 			ImageData string `json:"imageData"`
 		}{
+			Id:        frame.Id,
 			Timestamp: fileTime.Format("2006-01-02 15:04:05"),
 			ImageData: base64.StdEncoding.EncodeToString(imageData),
 		})
@@ -0,0 +1,332 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"video-platform/internal/storage"
+)
+
+// 帧文件名格式：{时间，精确到毫秒}_{序号}.jpg，例如 20250316_212305.123_000.jpg，
+// 序号用于区分同一毫秒内收到的多帧。旧版本使用 20250316_212305.jpg，读取时两种格式都支持。
+const (
+	FrameTimeLayout       = "20060102_150405.000"
+	LegacyFrameTimeLayout = "20060102_150405"
+	MaxFrameSeq           = 999
+)
+
+var frameNamePattern = regexp.MustCompile(`^(\d{8}_\d{6})(?:\.(\d{3})_(\d{3}))?\.jpg$`)
+
+// 生成帧文件名
+func FrameName(t time.Time, seq int) string {
+	return fmt.Sprintf("%s_%03d.jpg", t.Format(FrameTimeLayout), seq)
+}
+
+// 解析帧文件名，兼容旧格式，legacy 表示是否为旧格式
+func ParseFrameName(name string) (t time.Time, seq int, legacy bool, ok bool) {
+	m := frameNamePattern.FindStringSubmatch(name)
+	if m == nil {
+		return time.Time{}, 0, false, false
+	}
+	if m[2] == "" {
+		t, err := time.ParseInLocation(LegacyFrameTimeLayout, m[1], time.Local)
+		return t, 0, true, err == nil
+	}
+	t, err := time.ParseInLocation(FrameTimeLayout, m[1]+"."+m[2], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false, false
+	}
+	seq, _ = strconv.Atoi(m[3])
+	return t, seq, false, true
+}
+
+// FrameFile 存储中的一个帧
+type FrameFile struct {
+	Key  string // 存储中的对象键，例如 0610/2025/03/16/21/20250316_212305.123_000.jpg
+	Time time.Time
+	Seq  int
+}
+
+// 设备帧在存储中的键前缀
+func DeviceFramePrefix(deviceId string) string {
+	return deviceId + "/"
+}
+
+// 帧按小时分区存放：{deviceId}/{yyyy}/{mm}/{dd}/{hh}/{文件名}，避免单个目录下的文件过多。
+// 旧版本把设备的帧平铺在 {deviceId}/ 下，由 migrate-layout 命令迁移
+const FramePartitionLayout = "2006/01/02/15"
+
+// 帧时间所在的分区目录
+func FramePartition(deviceId string, t time.Time) string {
+	return storage.Join(deviceId, t.Format(FramePartitionLayout))
+}
+
+// 帧的对象键
+func FrameKey(deviceId string, t time.Time, seq int) string {
+	return storage.Join(FramePartition(deviceId, t), FrameName(t, seq))
+}
+
+// 帧在分区布局下的对象键，文件名不变；ok 为 false 表示不是可识别的帧
+func PartitionedFrameKey(key string) (string, bool) {
+	i := strings.Index(key, "/")
+	if i <= 0 {
+		return "", false
+	}
+	name := path.Base(key)
+	t, _, _, ok := ParseFrameName(name)
+	if !ok {
+		return "", false
+	}
+	return storage.Join(FramePartition(key[:i], t), name), true
+}
+
+// 列出设备的帧，按时间和序号升序排列，无法识别的文件名被跳过
+func ListFrames(ctx context.Context, st storage.Storage, deviceId string) ([]FrameFile, error) {
+	objects, err := st.List(ctx, DeviceFramePrefix(deviceId))
+	if err != nil {
+		return nil, err
+	}
+	return framesOf(objects), nil
+}
+
+// 从对象列表中挑出帧，按时间和序号升序排列
+func framesOf(objects []storage.ObjectInfo) []FrameFile {
+	frames := make([]FrameFile, 0, len(objects))
+	for _, obj := range objects {
+		t, seq, _, ok := ParseFrameName(path.Base(obj.Key))
+		if !ok {
+			continue
+		}
+		frames = append(frames, FrameFile{Key: obj.Key, Time: t, Seq: seq})
+	}
+	sort.Slice(frames, func(i, j int) bool {
+		if !frames[i].Time.Equal(frames[j].Time) {
+			return frames[i].Time.Before(frames[j].Time)
+		}
+		return frames[i].Seq < frames[j].Seq
+	})
+	return frames
+}
+
+// 缩略图文件名格式：{帧文件名去掉 .jpg}.thumb{宽度}.jpg，与原图放在同一目录
+var thumbnailNamePattern = regexp.MustCompile(`^(.+)\.thumb(\d+)\.jpg$`)
+
+// 帧的缩略图对象键，例如 0610/2025/03/16/21/20250316_212305.123_000.thumb320.jpg
+func ThumbnailKey(frameKey string, size int) string {
+	return fmt.Sprintf("%s.thumb%d.jpg", strings.TrimSuffix(frameKey, ".jpg"), size)
+}
+
+// 从对象列表中挑出缩略图，按所属帧的对象键分组
+func thumbnailsOf(objects []storage.ObjectInfo) map[string][]string {
+	thumbnails := make(map[string][]string)
+	for _, obj := range objects {
+		m := thumbnailNamePattern.FindStringSubmatch(obj.Key)
+		if m == nil {
+			continue
+		}
+		thumbnails[m[1]+".jpg"] = append(thumbnails[m[1]+".jpg"], obj.Key)
+	}
+	return thumbnails
+}
+
+// 将设备旧格式的帧重命名为新格式（连同元数据和缩略图），已是新格式的帧不受影响，可重复执行。
+// 存储没有重命名操作，通过复制后删除完成。dryRun 为 true 时只统计不重命名，返回需要（或已经）重命名的帧数
+func MigrateFrameNames(ctx context.Context, st storage.Storage, deviceId string, dryRun bool) (int, error) {
+	objects, err := st.List(ctx, DeviceFramePrefix(deviceId))
+	if err != nil {
+		return 0, err
+	}
+	frames, thumbnails := framesOf(objects), thumbnailsOf(objects)
+	count := 0
+	for _, frame := range frames {
+		t, _, legacy, _ := ParseFrameName(path.Base(frame.Key))
+		if !legacy {
+			continue
+		}
+		dir := path.Dir(frame.Key)
+		target := ""
+		for seq := 0; seq <= MaxFrameSeq; seq++ {
+			candidate := storage.Join(dir, FrameName(t, seq))
+			if _, err := st.Stat(ctx, candidate); storage.IsNotExist(err) {
+				target = candidate
+				break
+			} else if err != nil {
+				return count, err
+			}
+		}
+		if target == "" {
+			return count, fmt.Errorf("找不到可用的新文件名: %s", frame.Key)
+		}
+		count++
+		if dryRun {
+			continue
+		}
+		if err := moveFrame(ctx, st, frame.Key, target, thumbnails[frame.Key]); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// 将设备平铺存放的帧（连同元数据和缩略图）移动到分区目录，已在分区中的帧不受影响，中断后可重复执行。
+// 每移动一帧调用一次 moved（可为 nil）；dryRun 为 true 时只统计不移动，返回需要（或已经）移动的帧数
+func MigrateFrameLayout(ctx context.Context, st storage.Storage, deviceId string, dryRun bool, moved func(from string, to string) error) (int, error) {
+	objects, err := st.List(ctx, DeviceFramePrefix(deviceId))
+	if err != nil {
+		return 0, err
+	}
+	frames, thumbnails := framesOf(objects), thumbnailsOf(objects)
+	count := 0
+	for _, frame := range frames {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		target, _ := PartitionedFrameKey(frame.Key)
+		if target == frame.Key {
+			continue
+		}
+		count++
+		if dryRun {
+			continue
+		}
+		// 分区目录由文件名中的时间决定，目标已存在只可能是上次中断时复制过的同一帧，直接覆盖
+		if err := moveFrame(ctx, st, frame.Key, target, thumbnails[frame.Key]); err != nil {
+			return count, err
+		}
+		if moved != nil {
+			if err := moved(frame.Key, target); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, nil
+}
+
+// 读取帧。迁移过程中帧已移动到分区目录而索引尚未更新时，按分区布局下的对象键再读取一次
+func ReadFrame(ctx context.Context, st storage.Storage, key string) ([]byte, error) {
+	data, err := st.Get(ctx, key)
+	if storage.IsNotExist(err) {
+		if target, ok := PartitionedFrameKey(key); ok && target != key {
+			return st.Get(ctx, target)
+		}
+	}
+	return data, err
+}
+
+// 移动帧及其元数据和缩略图。帧最后移动，中断后重新执行时帧仍在原位置，会再次处理
+func moveFrame(ctx context.Context, st storage.Storage, from string, to string, thumbnails []string) error {
+	if err := moveObject(ctx, st, MetaKey(from), MetaKey(to)); err != nil && !storage.IsNotExist(err) {
+		return err
+	}
+	for _, thumbnail := range thumbnails {
+		m := thumbnailNamePattern.FindStringSubmatch(thumbnail)
+		size, _ := strconv.Atoi(m[2])
+		if err := moveObject(ctx, st, thumbnail, ThumbnailKey(to, size)); err != nil && !storage.IsNotExist(err) {
+			return err
+		}
+	}
+	return moveObject(ctx, st, from, to)
+}
+
+// 复制对象后删除原对象
+func moveObject(ctx context.Context, st storage.Storage, from string, to string) error {
+	data, err := st.Get(ctx, from)
+	if err != nil {
+		return err
+	}
+	if err := st.Put(ctx, to, data); err != nil {
+		return err
+	}
+	return st.Delete(ctx, from)
+}
+
+// 以不覆盖已有帧的方式写入设备的帧，同一毫秒内的帧依次使用递增的序号，返回对象键。
+// 同一设备的帧由接收管道的同一个工作协程依次写入，检查与写入之间不会有其他写入者
+func CreateFrame(ctx context.Context, st storage.Storage, deviceId string, t time.Time, data []byte) (string, error) {
+	for seq := 0; seq <= MaxFrameSeq; seq++ {
+		key := FrameKey(deviceId, t, seq)
+		if _, err := st.Stat(ctx, key); err == nil {
+			continue
+		} else if !storage.IsNotExist(err) {
+			return "", err
+		}
+		if err := st.Put(ctx, key, data); err != nil {
+			return "", err
+		}
+		return key, nil
+	}
+	return "", fmt.Errorf("同一毫秒内的帧数超过上限 %d", MaxFrameSeq+1)
+}
+
+// FrameMeta 图像帧元数据，与图像文件同名保存为 .json 文件
+type FrameMeta struct {
+	DeviceId      string            `json:"deviceId"`
+	Topic         string            `json:"topic"`
+	ReceivedAt    time.Time         `json:"receivedAt"`              // 服务器接收时间
+	CapturedAt    *time.Time        `json:"capturedAt,omitempty"`    // 设备采集时间
+	Seq           *int64            `json:"seq,omitempty"`           // 设备帧序号
+	Resolution    string            `json:"resolution,omitempty"`    // 分辨率，例如 1920x1080
+	Firmware      string            `json:"firmware,omitempty"`      // 固件版本
+	Width         int               `json:"width,omitempty"`         // 图像宽度，由服务器解析
+	Height        int               `json:"height,omitempty"`        // 图像高度，由服务器解析
+	Channel       string            `json:"channel,omitempty"`       // 摄像头通道
+	ContentType   string            `json:"contentType,omitempty"`   // MQTT v5 content-type
+	MessageExpiry *uint32           `json:"messageExpiry,omitempty"` // MQTT v5 消息过期时间（秒）
+	Properties    map[string]string `json:"properties,omitempty"`    // MQTT v5 用户属性
+}
+
+// 是否包含设备上报的信息，只有接收时间和主题的帧不写元数据文件
+func (m *FrameMeta) HasDeviceInfo() bool {
+	return m.CapturedAt != nil || m.Seq != nil || m.Resolution != "" || m.Firmware != "" || m.Channel != "" ||
+		m.ContentType != "" || m.MessageExpiry != nil || len(m.Properties) > 0
+}
+
+// 设备时钟与服务器时间的最大允许偏差，超出时认为设备时间不可信
+const MaxClockSkew = 24 * time.Hour
+
+// 帧时间：优先使用设备采集时间，设备时钟明显错误时退回服务器接收时间
+func (m *FrameMeta) FrameTime() time.Time {
+	if m.CapturedAt != nil {
+		skew := m.CapturedAt.Sub(m.ReceivedAt)
+		if skew < MaxClockSkew && skew > -MaxClockSkew {
+			return m.CapturedAt.In(time.Local)
+		}
+	}
+	return m.ReceivedAt
+}
+
+// 帧对应的元数据对象键
+func MetaKey(frameKey string) string {
+	return strings.TrimSuffix(frameKey, ".jpg") + ".json"
+}
+
+// 写入帧元数据
+func WriteFrameMeta(ctx context.Context, st storage.Storage, frameKey string, meta *FrameMeta) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return st.Put(ctx, MetaKey(frameKey), data)
+}
+
+// 读取帧元数据，不存在时返回 nil
+func ReadFrameMeta(ctx context.Context, st storage.Storage, frameKey string) (*FrameMeta, error) {
+	data, err := st.Get(ctx, MetaKey(frameKey))
+	if err != nil {
+		if storage.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var meta FrameMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
@@ -0,0 +1,144 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+	"video-platform/internal/storage"
+)
+
+func TestParseFrameName(t *testing.T) {
+	tests := []struct {
+		name   string
+		ok     bool
+		legacy bool
+		time   time.Time
+		seq    int
+	}{
+		{"20250316_212305.123_000.jpg", true, false, time.Date(2025, 3, 16, 21, 23, 5, 123e6, time.Local), 0},
+		{"20250316_212305.123_042.jpg", true, false, time.Date(2025, 3, 16, 21, 23, 5, 123e6, time.Local), 42},
+		{"20250316_212305.000_999.jpg", true, false, time.Date(2025, 3, 16, 21, 23, 5, 0, time.Local), 999},
+		{"20250316_212305.jpg", true, true, time.Date(2025, 3, 16, 21, 23, 5, 0, time.Local), 0},
+
+		{name: "20250316_212305.123.jpg"},
+		{name: "20250316_212305_000.jpg"},
+		{name: "20250316_212305.12_000.jpg"},
+		{name: "20250316_212305.123_0000.jpg"},
+		{name: "20250316_212305.123_000.png"},
+		{name: "20250316_212305.123_000.thumb320.jpg"},
+		{name: "20250316_212305.123_000.json"},
+		{name: "20251316_212305.123_000.jpg"},
+		{name: "20250316_256105.jpg"},
+		{name: "x20250316_212305.jpg"},
+		{name: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, seq, legacy, ok := ParseFrameName(tt.name)
+			if ok != tt.ok {
+				t.Fatalf("ParseFrameName(%q) ok = %v，应为 %v", tt.name, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if !ts.Equal(tt.time) || seq != tt.seq || legacy != tt.legacy {
+				t.Errorf("ParseFrameName(%q) = %v, %d, %v，应为 %v, %d, %v",
+					tt.name, ts, seq, legacy, tt.time, tt.seq, tt.legacy)
+			}
+		})
+	}
+}
+
+func TestFrameNameRoundTrip(t *testing.T) {
+	tests := []struct {
+		time time.Time
+		seq  int
+		name string
+	}{
+		{time.Date(2025, 3, 16, 21, 23, 5, 123456789, time.Local), 0, "20250316_212305.123_000.jpg"},
+		{time.Date(2025, 1, 2, 3, 4, 5, 0, time.Local), 7, "20250102_030405.000_007.jpg"},
+		{time.Date(2025, 12, 31, 23, 59, 59, 999e6, time.Local), MaxFrameSeq, "20251231_235959.999_999.jpg"},
+	}
+	for _, tt := range tests {
+		name := FrameName(tt.time, tt.seq)
+		if name != tt.name {
+			t.Errorf("FrameName(%v, %d) = %q，应为 %q", tt.time, tt.seq, name, tt.name)
+			continue
+		}
+		ts, seq, legacy, ok := ParseFrameName(name)
+		if !ok || legacy || seq != tt.seq || !ts.Equal(tt.time.Truncate(time.Millisecond)) {
+			t.Errorf("ParseFrameName(%q) = %v, %d, %v, %v", name, ts, seq, legacy, ok)
+		}
+	}
+}
+
+func TestFrameKey(t *testing.T) {
+	ts := time.Date(2025, 3, 16, 21, 23, 5, 123e6, time.Local)
+	if got, want := FrameKey("0610", ts, 1), "0610/2025/03/16/21/20250316_212305.123_001.jpg"; got != want {
+		t.Errorf("FrameKey = %q，应为 %q", got, want)
+	}
+}
+
+func TestPartitionedFrameKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+		ok   bool
+	}{
+		{"0610/20250316_212305.123_000.jpg", "0610/2025/03/16/21/20250316_212305.123_000.jpg", true},
+		{"0610/20250316_212305.jpg", "0610/2025/03/16/21/20250316_212305.jpg", true},
+		// 已在分区中的帧得到相同的键
+		{"0610/2025/03/16/21/20250316_212305.123_000.jpg", "0610/2025/03/16/21/20250316_212305.123_000.jpg", true},
+		{"20250316_212305.jpg", "", false},
+		{"/20250316_212305.jpg", "", false},
+		{"0610/notes.txt", "", false},
+		{"0610/20250316_212305.123_000.thumb320.jpg", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := PartitionedFrameKey(tt.key)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("PartitionedFrameKey(%q) = %q, %v，应为 %q, %v", tt.key, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFramesOf(t *testing.T) {
+	objects := []storage.ObjectInfo{
+		{Key: "0610/2025/03/16/21/20250316_212305.123_001.jpg"},
+		{Key: "0610/2025/03/16/21/20250316_212305.123_000.thumb320.jpg"},
+		{Key: "0610/2025/03/16/21/20250316_212305.123_000.json"},
+		{Key: "0610/20250316_212305.jpg"},
+		{Key: "0610/2025/03/16/21/20250316_212305.123_000.jpg"},
+		{Key: "0610/2025/03/16/20/20250316_205959.999_000.jpg"},
+	}
+	want := []string{
+		"0610/2025/03/16/20/20250316_205959.999_000.jpg",
+		"0610/20250316_212305.jpg",
+		"0610/2025/03/16/21/20250316_212305.123_000.jpg",
+		"0610/2025/03/16/21/20250316_212305.123_001.jpg",
+	}
+	var got []string
+	for _, frame := range framesOf(objects) {
+		got = append(got, frame.Key)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("framesOf = %v，应为 %v", got, want)
+	}
+}
+
+func TestThumbnails(t *testing.T) {
+	frame := "0610/2025/03/16/21/20250316_212305.123_000.jpg"
+	if got, want := ThumbnailKey(frame, 320), "0610/2025/03/16/21/20250316_212305.123_000.thumb320.jpg"; got != want {
+		t.Errorf("ThumbnailKey = %q，应为 %q", got, want)
+	}
+	got := thumbnailsOf([]storage.ObjectInfo{
+		{Key: frame},
+		{Key: ThumbnailKey(frame, 160)},
+		{Key: ThumbnailKey(frame, 320)},
+		{Key: "0610/2025/03/16/21/20250316_212305.123_000.thumbx.jpg"},
+	})
+	want := map[string][]string{frame: {ThumbnailKey(frame, 160), ThumbnailKey(frame, 320)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("thumbnailsOf = %v，应为 %v", got, want)
+	}
+}
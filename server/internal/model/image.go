@@ -0,0 +1,264 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// ImageModel 图像索引表结构，每行对应存储中的一帧
+type ImageModel struct {
+	Id          int64      `json:"id" dc:"记录ID"`
+	DeviceId    string     `json:"deviceId" dc:"设备ID"`
+	StorageKey  string     `json:"storageKey" dc:"存储中的对象键"`
+	FrameTime   time.Time  `json:"frameTime" dc:"帧时间，设备采集时间可信时使用采集时间，否则为接收时间"`
+	CapturedAt  *time.Time `json:"capturedAt" dc:"设备采集时间"`
+	ReceivedAt  time.Time  `json:"receivedAt" dc:"服务器接收时间"`
+	Size        int64      `json:"size" dc:"字节数"`
+	Sha256      string     `json:"sha256" dc:"内容的SHA-256"`
+	Width       int        `json:"width" dc:"图像宽度"`
+	Height      int        `json:"height" dc:"图像高度"`
+	ContentType string     `json:"contentType" dc:"内容类型"`
+	CreatedAt   time.Time  `json:"createdAt" dc:"索引时间"`
+}
+
+type ImageThumbnailReq struct {
+	g.Meta   `path:"/devices/{deviceId}/images/{imageId}/thumbnail" method:"get" tags:"设备管理" summary:"获取图像缩略图"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	ImageId  string `json:"imageId" v:"required" dc:"图像ID，latest 表示设备最新的一帧"`
+	Size     int    `json:"size" v:"min:0" dc:"缩略图宽度，必须为 thumbnail.sizes 中的值，不传时使用最小的尺寸"`
+}
+
+// 成功时直接返回 JPEG，失败时返回 JSON
+type ImageRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type ImageRenderReq struct {
+	g.Meta   `path:"/devices/{deviceId}/images/{imageId}/render" method:"get" tags:"设备管理" summary:"按指定尺寸、裁剪区域和格式渲染图像"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	ImageId  string `json:"imageId" v:"required" dc:"图像ID，latest 表示设备最新的一帧"`
+	Width    int    `json:"width" v:"min:0" dc:"输出宽度，不传时按比例计算"`
+	Height   int    `json:"height" v:"min:0" dc:"输出高度，不传时按比例计算"`
+	Fit      string `json:"fit" dc:"同时指定宽高时的缩放方式 contain/cover/fill，默认 contain"`
+	Crop     string `json:"crop" dc:"先从原图裁剪的区域，格式为 x,y,宽,高"`
+	Quality  int    `json:"quality" v:"min:0|max:100" dc:"JPEG 质量 1-100，不传时使用 render.defaultQuality"`
+	Format   string `json:"format" dc:"输出格式 jpeg/png，默认 jpeg"`
+}
+
+type ImageExportReq struct {
+	g.Meta    `path:"/images/export" method:"get" tags:"设备管理" summary:"将一段时间内的原始图像导出为 ZIP，附带清单"`
+	DeviceIds string `json:"deviceIds" v:"required" dc:"设备ID，多个用逗号分隔"`
+	StartTime string `json:"startTime" v:"required" dc:"开始时间，格式 2006-01-02 15:04:05"`
+	EndTime   string `json:"endTime" v:"required" dc:"结束时间，格式 2006-01-02 15:04:05，包含这一秒内的帧"`
+}
+
+// 图像索引数据访问对象
+type ImageDao struct{}
+
+var Image = new(ImageDao)
+
+// 初始化数据库表
+func (dao *ImageDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS image (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		device_id VARCHAR(64) NOT NULL,
+		storage_key VARCHAR(255) NOT NULL,
+		frame_time DATETIME(3) NOT NULL,
+		captured_at DATETIME(3) NULL,
+		received_at DATETIME(3) NOT NULL,
+		size BIGINT NOT NULL,
+		sha256 CHAR(64) NOT NULL,
+		width INT NOT NULL DEFAULT 0,
+		height INT NOT NULL DEFAULT 0,
+		content_type VARCHAR(64) NOT NULL DEFAULT '',
+		created_at DATETIME(3) NOT NULL,
+		UNIQUE KEY uk_storage_key (storage_key),
+		INDEX idx_device_frame_time (device_id, frame_time)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	_, err := g.DB().Exec(ctx, sql)
+	return err
+}
+
+// 写入图像索引，对象键已存在时更新
+func (dao *ImageDao) Save(ctx g.Ctx, image *ImageModel) error {
+	if image.CreatedAt.IsZero() {
+		image.CreatedAt = time.Now()
+	}
+	_, err := g.DB().Model("image").Ctx(ctx).Data(g.Map{
+		"device_id":    image.DeviceId,
+		"storage_key":  image.StorageKey,
+		"frame_time":   image.FrameTime,
+		"captured_at":  image.CapturedAt,
+		"received_at":  image.ReceivedAt,
+		"size":         image.Size,
+		"sha256":       image.Sha256,
+		"width":        image.Width,
+		"height":       image.Height,
+		"content_type": image.ContentType,
+		"created_at":   image.CreatedAt,
+	}).Save()
+	return err
+}
+
+// 按ID获取帧，不存在时返回 nil
+func (dao *ImageDao) Get(ctx g.Ctx, id int64) (image *ImageModel, err error) {
+	err = g.DB().Model("image").Ctx(ctx).Where("id", id).Scan(&image)
+	return image, err
+}
+
+// 获取设备最新的一帧，没有时返回 nil
+func (dao *ImageDao) Latest(ctx g.Ctx, deviceId string) (image *ImageModel, err error) {
+	err = g.DB().Model("image").Ctx(ctx).
+		Where("device_id", deviceId).
+		OrderDesc("frame_time").
+		OrderDesc("storage_key").
+		Limit(1).
+		Scan(&image)
+	return image, err
+}
+
+// 获取帧时间在 [start, end) 内的帧，按时间正序
+func (dao *ImageDao) Range(ctx g.Ctx, deviceId string, start time.Time, end time.Time) (images []ImageModel, err error) {
+	images = make([]ImageModel, 0)
+	err = g.DB().Model("image").Ctx(ctx).
+		Where("device_id", deviceId).
+		WhereGTE("frame_time", start).
+		WhereLT("frame_time", end).
+		OrderAsc("frame_time").
+		OrderAsc("storage_key").
+		Scan(&images)
+	return images, err
+}
+
+// 统计帧时间在 [start, end) 内的帧数
+func (dao *ImageDao) Count(ctx g.Ctx, deviceId string, start time.Time, end time.Time) (int, error) {
+	return g.DB().Model("image").Ctx(ctx).
+		Where("device_id", deviceId).
+		WhereGTE("frame_time", start).
+		WhereLT("frame_time", end).
+		Count()
+}
+
+// 获取帧时间在 [start, end) 内每帧的字节数，顺序与 RangeAfter 相同
+func (dao *ImageDao) Sizes(ctx g.Ctx, deviceId string, start time.Time, end time.Time) ([]int64, error) {
+	values, err := g.DB().Model("image").Ctx(ctx).
+		Fields("size").
+		Where("device_id", deviceId).
+		WhereGTE("frame_time", start).
+		WhereLT("frame_time", end).
+		OrderAsc("frame_time").
+		OrderAsc("id").
+		Array()
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int64, 0, len(values))
+	for _, v := range values {
+		sizes = append(sizes, v.Int64())
+	}
+	return sizes, nil
+}
+
+// 分批获取帧时间在 [start, end) 内的帧，按时间正序，after 不为空时从该帧之后开始
+func (dao *ImageDao) RangeAfter(ctx g.Ctx, deviceId string, start time.Time, end time.Time, after *ImageModel, limit int) (images []ImageModel, err error) {
+	images = make([]ImageModel, 0)
+	m := g.DB().Model("image").Ctx(ctx).
+		Where("device_id", deviceId).
+		WhereGTE("frame_time", start).
+		WhereLT("frame_time", end)
+	if after != nil {
+		m = m.Where("(frame_time > ? OR (frame_time = ? AND id > ?))", after.FrameTime, after.FrameTime, after.Id)
+	}
+	err = m.OrderAsc("frame_time").OrderAsc("id").Limit(limit).Scan(&images)
+	return images, err
+}
+
+// 获取设备已索引的对象键
+func (dao *ImageDao) Keys(ctx g.Ctx, deviceId string) (map[string]bool, error) {
+	values, err := g.DB().Model("image").Ctx(ctx).
+		Fields("storage_key").
+		Where("device_id", deviceId).
+		Array()
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool, len(values))
+	for _, v := range values {
+		keys[v.String()] = true
+	}
+	return keys, nil
+}
+
+// 按对象键删除索引
+func (dao *ImageDao) DeleteKeys(ctx g.Ctx, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := g.DB().Model("image").Ctx(ctx).WhereIn("storage_key", keys).Delete()
+	return err
+}
+
+// 删除设备的全部图像索引
+func (dao *ImageDao) DeleteDevice(ctx g.Ctx, deviceId string) error {
+	_, err := g.DB().Model("image").Ctx(ctx).Where("device_id", deviceId).Delete()
+	return err
+}
+
+// 获取有图像索引的设备
+func (dao *ImageDao) Devices(ctx g.Ctx) ([]string, error) {
+	values, err := g.DB().Model("image").Ctx(ctx).
+		Fields("DISTINCT device_id").
+		OrderAsc("device_id").
+		Array()
+	if err != nil {
+		return nil, err
+	}
+	deviceIds := make([]string, 0, len(values))
+	for _, v := range values {
+		deviceIds = append(deviceIds, v.String())
+	}
+	return deviceIds, nil
+}
+
+// 获取设备的帧数和总字节数
+func (dao *ImageDao) Usage(ctx g.Ctx, deviceId string) (count int, bytes int64, err error) {
+	one, err := g.DB().GetOne(ctx,
+		"SELECT COUNT(*) AS count, COALESCE(SUM(size), 0) AS bytes FROM image WHERE device_id = ?", deviceId)
+	if err != nil {
+		return 0, 0, err
+	}
+	return one["count"].Int(), one["bytes"].Int64(), nil
+}
+
+// 按时间从旧到新获取设备的帧，after 不为空时从该帧之后开始
+func (dao *ImageDao) Oldest(ctx g.Ctx, deviceId string, after *ImageModel, limit int) (images []ImageModel, err error) {
+	images = make([]ImageModel, 0)
+	m := g.DB().Model("image").Ctx(ctx).Where("device_id", deviceId)
+	if after != nil {
+		m = m.Where("(frame_time > ? OR (frame_time = ? AND id > ?))", after.FrameTime, after.FrameTime, after.Id)
+	}
+	err = m.OrderAsc("frame_time").OrderAsc("id").Limit(limit).Scan(&images)
+	return images, err
+}
+
+// 帧移动后更新对象键；新键已有索引时（例如期间执行过 reindex）删除旧键的索引
+func (dao *ImageDao) RenameKey(ctx g.Ctx, from string, to string) error {
+	return g.DB().Transaction(ctx, func(ctx g.Ctx, tx gdb.TX) error {
+		count, err := tx.Model("image").Ctx(ctx).Where("storage_key", to).Count()
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			_, err = tx.Model("image").Ctx(ctx).Where("storage_key", from).Delete()
+			return err
+		}
+		_, err = tx.Model("image").Ctx(ctx).Data(g.Map{"storage_key": to}).Where("storage_key", from).Update()
+		return err
+	})
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+type IngestStatsReq struct {
+	g.Meta `path:"/mqtt/ingest/stats" method:"get" tags:"MQTT" summary:"获取接收管道统计"`
+}
+
+type IngestStatsRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+type PublishReq struct {
+	g.Meta   `path:"/mqtt/publish" method:"post" tags:"MQTT" summary:"手动发布MQTT消息（需要管理员令牌）"`
+	Topic    string `json:"topic" v:"required" dc:"发布主题，必须在 publish.allowedTopics 允许的范围内"`
+	Qos      int    `json:"qos" v:"in:0,1,2" dc:"QoS"`
+	Retain   bool   `json:"retain" dc:"是否为保留消息"`
+	Payload  string `json:"payload" dc:"消息内容"`
+	Encoding string `json:"encoding" d:"raw" v:"in:raw,base64" dc:"消息内容的编码，raw 为原始文本，base64 为Base64编码的二进制"`
+}
+
+type PublishAuditListReq struct {
+	g.Meta `path:"/mqtt/publish/audit" method:"get" tags:"MQTT" summary:"获取手动发布记录（需要管理员令牌）"`
+	Topic  string `json:"topic" dc:"按主题过滤"`
+	Limit  int    `json:"limit" d:"50" dc:"返回条数"`
+}
+
+type PublishRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
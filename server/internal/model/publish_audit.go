@@ -0,0 +1,114 @@
+package model
+
+import (
+	"log"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// PublishAuditModel 手动发布记录表结构
+type PublishAuditModel struct {
+	Id            int64     `json:"id" dc:"记录ID"`
+	Topic         string    `json:"topic" dc:"发布主题"`
+	Qos           int       `json:"qos" dc:"QoS"`
+	Retained      bool      `json:"retained" dc:"是否为保留消息"`
+	PayloadSize   int       `json:"payloadSize" dc:"消息字节数"`
+	PayloadSha256 string    `json:"payloadSha256" dc:"消息内容的SHA-256"`
+	MessageId     *int      `json:"messageId" dc:"报文ID；QoS 0 没有报文ID，MQTT 5 客户端不提供报文ID，发布失败时也没有，均为 null"`
+	Success       bool      `json:"success" dc:"是否发布成功"`
+	Error         string    `json:"error" dc:"失败原因"`
+	RemoteAddr    string    `json:"remoteAddr" dc:"请求来源地址"`
+	UserAgent     string    `json:"userAgent" dc:"请求客户端"`
+	CreatedAt     time.Time `json:"createdAt" dc:"发布时间"`
+}
+
+// 手动发布记录数据访问对象
+type PublishAuditDao struct{}
+
+var PublishAudit = new(PublishAuditDao)
+
+// 初始化数据库表
+func (dao *PublishAuditDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS mqtt_publish_audit (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		topic VARCHAR(255) NOT NULL,
+		qos TINYINT NOT NULL,
+		retained TINYINT(1) NOT NULL DEFAULT 0,
+		payload_size INT NOT NULL,
+		payload_sha256 CHAR(64) NOT NULL,
+		message_id INT NULL,
+		success TINYINT(1) NOT NULL DEFAULT 0,
+		error VARCHAR(1024),
+		remote_addr VARCHAR(64),
+		user_agent VARCHAR(255),
+		created_at DATETIME(3) NOT NULL,
+		INDEX idx_created (created_at),
+		INDEX idx_topic_created (topic, created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	if _, err := g.DB().Exec(ctx, sql); err != nil {
+		return err
+	}
+	// 旧版本创建的表中 message_id 不允许为空，无法区分报文ID为0和没有报文ID
+	count, err := g.DB().GetCount(ctx,
+		"SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'mqtt_publish_audit' AND COLUMN_NAME = 'message_id' AND IS_NULLABLE = 'NO'")
+	if err != nil || count == 0 {
+		return err
+	}
+	log.Printf("修改表 mqtt_publish_audit 的字段 message_id 为允许空值")
+	_, err = g.DB().Exec(ctx, "ALTER TABLE `mqtt_publish_audit` MODIFY COLUMN `message_id` INT NULL")
+	return err
+}
+
+// 添加发布记录，被拒绝的请求中的主题等字段可能超长，按列宽截断
+func (dao *PublishAuditDao) Add(ctx g.Ctx, record *PublishAuditModel) error {
+	r, err := g.DB().Model("mqtt_publish_audit").Ctx(ctx).Data(g.Map{
+		"topic":          truncateString(record.Topic, 255),
+		"qos":            record.Qos,
+		"retained":       record.Retained,
+		"payload_size":   record.PayloadSize,
+		"payload_sha256": record.PayloadSha256,
+		"message_id":     record.MessageId,
+		"success":        record.Success,
+		"error":          truncateString(record.Error, 1024),
+		"remote_addr":    truncateString(record.RemoteAddr, 64),
+		"user_agent":     truncateString(record.UserAgent, 255),
+		"created_at":     record.CreatedAt,
+	}).Insert()
+	if err != nil {
+		return err
+	}
+	record.Id, err = r.LastInsertId()
+	return err
+}
+
+// 发布完成后更新记录的结果
+func (dao *PublishAuditDao) Finish(ctx g.Ctx, record *PublishAuditModel) error {
+	_, err := g.DB().Model("mqtt_publish_audit").Ctx(ctx).Data(g.Map{
+		"message_id": record.MessageId,
+		"success":    record.Success,
+		"error":      truncateString(record.Error, 1024),
+	}).Where("id", record.Id).Update()
+	return err
+}
+
+// 获取发布记录，按时间倒序，topic 为空时不过滤
+func (dao *PublishAuditDao) List(ctx g.Ctx, topic string, limit int) (records []PublishAuditModel, err error) {
+	records = make([]PublishAuditModel, 0)
+	m := g.DB().Model("mqtt_publish_audit").Ctx(ctx)
+	if topic != "" {
+		m = m.Where("topic", topic)
+	}
+	err = m.OrderDesc("id").Limit(limit).Scan(&records)
+	return records, err
+}
+
+// 按字符截断字符串
+func truncateString(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n])
+	}
+	return s
+}
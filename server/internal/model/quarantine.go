@@ -0,0 +1,32 @@
+package model
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+type QuarantineListReq struct {
+	g.Meta   `path:"/quarantine" method:"get" tags:"隔离区" summary:"获取隔离记录列表"`
+	DeviceId string `json:"deviceId" dc:"设备ID，为空时返回全部"`
+}
+
+type QuarantineGetReq struct {
+	g.Meta `path:"/quarantine/{id}" method:"get" tags:"隔离区" summary:"获取隔离记录详情及原始负载"`
+	Id     string `json:"id" v:"required" dc:"隔离记录ID"`
+}
+
+type QuarantineDeleteReq struct {
+	g.Meta `path:"/quarantine/{id}" method:"delete" tags:"隔离区" summary:"删除隔离记录"`
+	Id     string `json:"id" v:"required" dc:"隔离记录ID"`
+}
+
+type QuarantinePurgeReq struct {
+	g.Meta   `path:"/quarantine" method:"delete" tags:"隔离区" summary:"清理隔离记录（需要管理员令牌）"`
+	DeviceId string `json:"deviceId" dc:"设备ID，为空时不限设备"`
+	Before   string `json:"before" dc:"只清理该时间之前隔离的记录，格式 2006-01-02 15:04:05，为空时不限时间"`
+}
+
+type QuarantineRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
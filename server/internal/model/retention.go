@@ -0,0 +1,16 @@
+package model
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+type RetentionPreviewReq struct {
+	g.Meta   `path:"/retention/preview" method:"get" tags:"图像保留" summary:"预览保留策略将要清理的帧，不实际删除"`
+	DeviceId string `json:"deviceId" dc:"设备ID，为空时预览全部设备"`
+}
+
+type RetentionRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
@@ -0,0 +1,211 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/gogf/gf/v2/database/gdb"
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// ShadowModel 设备影子表结构：desired 为平台期望的配置，reported 为设备上报的实际配置
+type ShadowModel struct {
+	DeviceId          string     `json:"deviceId" dc:"设备ID"`
+	Desired           string     `json:"-" dc:"期望状态（JSON）"`
+	DesiredVersion    int64      `json:"desiredVersion" dc:"期望状态版本"`
+	DesiredUpdatedAt  *time.Time `json:"desiredUpdatedAt" dc:"期望状态更新时间"`
+	Reported          string     `json:"-" dc:"上报状态（JSON）"`
+	ReportedVersion   int64      `json:"reportedVersion" dc:"上报状态版本"`
+	ReportedUpdatedAt *time.Time `json:"reportedUpdatedAt" dc:"上报状态更新时间"`
+}
+
+// 影子文档，desired 与 reported 解析为对象后返回给接口调用方
+type ShadowDocument struct {
+	DeviceId          string                 `json:"deviceId"`
+	Desired           map[string]interface{} `json:"desired"`
+	DesiredVersion    int64                  `json:"desiredVersion"`
+	DesiredUpdatedAt  *time.Time             `json:"desiredUpdatedAt"`
+	Reported          map[string]interface{} `json:"reported"`
+	ReportedVersion   int64                  `json:"reportedVersion"`
+	ReportedUpdatedAt *time.Time             `json:"reportedUpdatedAt"`
+	Delta             map[string]interface{} `json:"delta"` // desired 中与 reported 不一致的字段
+}
+
+// 请求结构体
+type ShadowGetReq struct {
+	g.Meta   `path:"/devices/{deviceId}/shadow" method:"get" tags:"设备影子" summary:"获取设备影子"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+}
+
+type ShadowDesiredUpdateReq struct {
+	g.Meta   `path:"/devices/{deviceId}/shadow/desired" method:"put" tags:"设备影子" summary:"替换期望状态（需要管理员令牌）"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	State    g.Map  `json:"state" v:"required" dc:"期望状态，例如 {\"resolution\":\"1920x1080\",\"captureInterval\":10,\"jpegQuality\":80}"`
+}
+
+type ShadowDesiredPatchReq struct {
+	g.Meta   `path:"/devices/{deviceId}/shadow/desired" method:"patch" tags:"设备影子" summary:"合并更新期望状态，值为 null 的字段被删除（需要管理员令牌）"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	State    g.Map  `json:"state" v:"required" dc:"要更新的字段"`
+}
+
+type ShadowDeltaReq struct {
+	g.Meta   `path:"/devices/{deviceId}/shadow/delta" method:"get" tags:"设备影子" summary:"获取期望状态与上报状态的差异"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+}
+
+type ShadowDeltaListReq struct {
+	g.Meta `path:"/shadows/delta" method:"get" tags:"设备影子" summary:"列出尚未应用期望状态的设备"`
+}
+
+type ShadowRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// 设备影子数据访问对象
+type ShadowDao struct{}
+
+var Shadow = new(ShadowDao)
+
+// 初始化数据库表
+func (dao *ShadowDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS device_shadow (
+		device_id VARCHAR(64) PRIMARY KEY,
+		desired TEXT,
+		desired_version BIGINT NOT NULL DEFAULT 0,
+		desired_updated_at DATETIME(3) NULL,
+		reported TEXT,
+		reported_version BIGINT NOT NULL DEFAULT 0,
+		reported_updated_at DATETIME(3) NULL
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	_, err := g.DB().Exec(ctx, sql)
+	return err
+}
+
+// 获取设备影子，不存在时返回 nil
+func (dao *ShadowDao) Get(ctx g.Ctx, deviceId string) (shadow *ShadowModel, err error) {
+	err = g.DB().Model("device_shadow").Ctx(ctx).Where("device_id", deviceId).Scan(&shadow)
+	return shadow, err
+}
+
+// 获取全部设备影子
+func (dao *ShadowDao) List(ctx g.Ctx) (shadows []ShadowModel, err error) {
+	shadows = make([]ShadowModel, 0)
+	err = g.DB().Model("device_shadow").Ctx(ctx).OrderAsc("device_id").Scan(&shadows)
+	return shadows, err
+}
+
+// 在事务中更新期望状态：锁定设备影子行后把当前的期望状态交给 update 修改，再保存并将版本号加一，
+// 返回新的版本号。并发的更新依次执行，合并时不会丢失其他请求的修改；update 返回错误时不保存
+func (dao *ShadowDao) UpdateDesired(ctx g.Ctx, deviceId string, update func(desired map[string]interface{}) error) (version int64, err error) {
+	err = g.DB().Transaction(ctx, func(ctx g.Ctx, tx gdb.TX) error {
+		// 行不存在时 SELECT ... FOR UPDATE 锁不住，先插入空行
+		if _, err := tx.Exec("INSERT IGNORE INTO device_shadow (device_id) VALUES (?)", deviceId); err != nil {
+			return err
+		}
+		var shadow *ShadowModel
+		if err := tx.Model("device_shadow").Ctx(ctx).Where("device_id", deviceId).LockUpdate().Scan(&shadow); err != nil {
+			return err
+		}
+		desired := decodeState(shadow.Desired)
+		if err := update(desired); err != nil {
+			return err
+		}
+		data, err := json.Marshal(desired)
+		if err != nil {
+			return err
+		}
+		version = shadow.DesiredVersion + 1
+		_, err = tx.Model("device_shadow").Ctx(ctx).Data(g.Map{
+			"desired":            string(data),
+			"desired_version":    version,
+			"desired_updated_at": time.Now(),
+		}).Where("device_id", deviceId).Update()
+		return err
+	})
+	return version, err
+}
+
+// 保存上报状态，版本号加一，返回新的版本号
+func (dao *ShadowDao) SaveReported(ctx g.Ctx, deviceId string, reported map[string]interface{}) (int64, error) {
+	return dao.save(ctx, deviceId, "reported", reported)
+}
+
+func (dao *ShadowDao) save(ctx g.Ctx, deviceId string, field string, state map[string]interface{}) (int64, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	// 使用 INSERT ... ON DUPLICATE KEY UPDATE 保证版本号原子递增
+	sql := "INSERT INTO device_shadow (device_id, " + field + ", " + field + "_version, " + field + "_updated_at) VALUES (?, ?, 1, ?) " +
+		"ON DUPLICATE KEY UPDATE " + field + " = VALUES(" + field + "), " +
+		field + "_version = " + field + "_version + 1, " +
+		field + "_updated_at = VALUES(" + field + "_updated_at)"
+	if _, err := g.DB().Exec(ctx, sql, deviceId, string(data), now); err != nil {
+		return 0, err
+	}
+	v, err := g.DB().Model("device_shadow").Ctx(ctx).Where("device_id", deviceId).Value(field + "_version")
+	if err != nil {
+		return 0, err
+	}
+	return v.Int64(), nil
+}
+
+// 删除设备影子
+func (dao *ShadowDao) Delete(ctx g.Ctx, deviceId string) error {
+	_, err := g.DB().Model("device_shadow").Ctx(ctx).Where("device_id", deviceId).Delete()
+	return err
+}
+
+// 解析为影子文档并计算差异
+func (m *ShadowModel) Document() *ShadowDocument {
+	doc := &ShadowDocument{
+		DeviceId:          m.DeviceId,
+		Desired:           decodeState(m.Desired),
+		DesiredVersion:    m.DesiredVersion,
+		DesiredUpdatedAt:  m.DesiredUpdatedAt,
+		Reported:          decodeState(m.Reported),
+		ReportedVersion:   m.ReportedVersion,
+		ReportedUpdatedAt: m.ReportedUpdatedAt,
+	}
+	doc.Delta = ShadowDelta(doc.Desired, doc.Reported)
+	return doc
+}
+
+// 计算差异：desired 中存在、且 reported 中缺失或取值不同的字段
+func ShadowDelta(desired, reported map[string]interface{}) map[string]interface{} {
+	delta := make(map[string]interface{})
+	for key, want := range desired {
+		if got, ok := reported[key]; !ok || !reflect.DeepEqual(normalizeJSON(want), normalizeJSON(got)) {
+			delta[key] = want
+		}
+	}
+	return delta
+}
+
+func decodeState(s string) map[string]interface{} {
+	state := make(map[string]interface{})
+	if s != "" {
+		_ = json.Unmarshal([]byte(s), &state)
+	}
+	return state
+}
+
+// 通过一次JSON往返统一数值等类型的表示，便于比较
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return v
+	}
+	return out
+}
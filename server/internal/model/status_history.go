@@ -0,0 +1,96 @@
+package model
+
+import (
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// StatusHistoryModel 设备状态变化记录表结构
+type StatusHistoryModel struct {
+	Id         int64     `json:"id" dc:"记录ID"`
+	DeviceId   string    `json:"deviceId" dc:"设备ID"`
+	FromStatus string    `json:"fromStatus" dc:"变化前的状态"`
+	ToStatus   string    `json:"toStatus" dc:"变化后的状态"`
+	Reason     string    `json:"reason" dc:"变化原因"`
+	ChangedAt  time.Time `json:"changedAt" dc:"变化时间"`
+}
+
+// 请求结构体
+type DeviceStatusHistoryReq struct {
+	g.Meta    `path:"/devices/{deviceId}/status/history" method:"get" tags:"设备管理" summary:"获取设备状态变化历史及在线率"`
+	DeviceId  string `json:"deviceId" v:"required" dc:"设备ID"`
+	StartTime string `json:"startTime" dc:"开始时间，格式 2006-01-02 15:04:05，默认为24小时前"`
+	EndTime   string `json:"endTime" dc:"结束时间，格式 2006-01-02 15:04:05，默认为当前时间"`
+}
+
+type DeviceStatusHistoryRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// 设备状态历史数据访问对象
+type StatusHistoryDao struct{}
+
+var StatusHistory = new(StatusHistoryDao)
+
+// 初始化数据库表
+func (dao *StatusHistoryDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS device_status_history (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		device_id VARCHAR(64) NOT NULL,
+		from_status VARCHAR(20) NOT NULL,
+		to_status VARCHAR(20) NOT NULL,
+		reason VARCHAR(255),
+		changed_at DATETIME(3) NOT NULL,
+		INDEX idx_device_changed (device_id, changed_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	_, err := g.DB().Exec(ctx, sql)
+	return err
+}
+
+// 添加状态变化记录
+func (dao *StatusHistoryDao) Add(ctx g.Ctx, record *StatusHistoryModel) error {
+	_, err := g.DB().Model("device_status_history").Ctx(ctx).Data(g.Map{
+		"device_id":   record.DeviceId,
+		"from_status": record.FromStatus,
+		"to_status":   record.ToStatus,
+		"reason":      record.Reason,
+		"changed_at":  record.ChangedAt,
+	}).Insert()
+	return err
+}
+
+// 获取时间范围内的状态变化，按时间正序
+func (dao *StatusHistoryDao) List(ctx g.Ctx, deviceId string, start time.Time, end time.Time) (records []StatusHistoryModel, err error) {
+	records = make([]StatusHistoryModel, 0)
+	err = g.DB().Model("device_status_history").Ctx(ctx).
+		Where("device_id", deviceId).
+		WhereGTE("changed_at", start).
+		WhereLTE("changed_at", end).
+		OrderAsc("changed_at").
+		OrderAsc("id").
+		Scan(&records)
+	return records, err
+}
+
+// 获取指定时间之前的最后一次状态变化，不存在时返回 nil
+func (dao *StatusHistoryDao) LastBefore(ctx g.Ctx, deviceId string, t time.Time) (record *StatusHistoryModel, err error) {
+	err = g.DB().Model("device_status_history").Ctx(ctx).
+		Where("device_id", deviceId).
+		WhereLT("changed_at", t).
+		OrderDesc("changed_at").
+		OrderDesc("id").
+		Limit(1).
+		Scan(&record)
+	return record, err
+}
+
+// 删除设备的状态历史
+func (dao *StatusHistoryDao) Delete(ctx g.Ctx, deviceId string) error {
+	_, err := g.DB().Model("device_status_history").Ctx(ctx).Where("device_id", deviceId).Delete()
+	return err
+}
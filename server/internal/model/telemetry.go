@@ -0,0 +1,138 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// TelemetryModel 设备遥测数据表结构，每行为一个指标的一次采样
+type TelemetryModel struct {
+	DeviceId string    `json:"deviceId" dc:"设备ID"`
+	Metric   string    `json:"metric" dc:"指标名称，例如 temperature、signal、diskFree、uptime"`
+	Value    float64   `json:"value" dc:"指标值"`
+	Ts       time.Time `json:"ts" dc:"采样时间"`
+}
+
+// TelemetryBucket 降采样后的一个时间桶
+type TelemetryBucket struct {
+	Metric string    `json:"metric"`
+	Time   time.Time `json:"time"` // 桶的开始时间
+	Min    float64   `json:"min"`
+	Max    float64   `json:"max"`
+	Avg    float64   `json:"avg"`
+	Count  int       `json:"count"`
+}
+
+// 请求结构体
+type TelemetryQueryReq struct {
+	g.Meta   `path:"/devices/{deviceId}/telemetry" method:"get" tags:"设备遥测" summary:"查询设备遥测数据，按时间桶降采样"`
+	DeviceId string `json:"deviceId" v:"required" dc:"设备ID"`
+	Metric   string `json:"metric" dc:"指标名称，多个用逗号分隔，为空时返回全部指标"`
+	From     string `json:"from" dc:"开始时间，格式 2006-01-02 15:04:05，默认为24小时前"`
+	To       string `json:"to" dc:"结束时间，格式 2006-01-02 15:04:05，默认为当前时间"`
+	Step     int    `json:"step" dc:"时间桶长度（秒），为0时自动选择"`
+}
+
+type TelemetryQueryRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// 遥测数据访问对象
+type TelemetryDao struct{}
+
+var Telemetry = new(TelemetryDao)
+
+// 初始化数据库表
+func (dao *TelemetryDao) InitTable(ctx g.Ctx) error {
+	sql := `
+	CREATE TABLE IF NOT EXISTS device_telemetry (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		device_id VARCHAR(64) NOT NULL,
+		metric VARCHAR(64) NOT NULL,
+		value DOUBLE NOT NULL,
+		ts DATETIME(3) NOT NULL,
+		INDEX idx_device_metric_ts (device_id, metric, ts)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+	_, err := g.DB().Exec(ctx, sql)
+	return err
+}
+
+// 批量写入采样
+func (dao *TelemetryDao) Add(ctx g.Ctx, samples []TelemetryModel) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	data := make(g.List, 0, len(samples))
+	for _, sample := range samples {
+		data = append(data, g.Map{
+			"device_id": sample.DeviceId,
+			"metric":    sample.Metric,
+			"value":     sample.Value,
+			"ts":        sample.Ts,
+		})
+	}
+	_, err := g.DB().Model("device_telemetry").Ctx(ctx).Data(data).Insert()
+	return err
+}
+
+// 获取设备上报过的指标名称
+func (dao *TelemetryDao) Metrics(ctx g.Ctx, deviceId string) ([]string, error) {
+	values, err := g.DB().Model("device_telemetry").Ctx(ctx).
+		Fields("DISTINCT metric").
+		Where("device_id", deviceId).
+		OrderAsc("metric").
+		Array()
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]string, 0, len(values))
+	for _, v := range values {
+		metrics = append(metrics, v.String())
+	}
+	return metrics, nil
+}
+
+// 按时间桶聚合 [start, end) 内的采样，桶从 start 开始，长度为 step
+func (dao *TelemetryDao) Query(ctx g.Ctx, deviceId string, metrics []string, start time.Time, end time.Time, step time.Duration) ([]TelemetryBucket, error) {
+	buckets := make([]TelemetryBucket, 0)
+	if len(metrics) == 0 {
+		return buckets, nil
+	}
+	// 桶序号相对 start 计算，避免依赖数据库会话时区
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(metrics)), ",")
+	sql := "SELECT metric, FLOOR(TIMESTAMPDIFF(MICROSECOND, ?, ts) / 1000 / ?) AS bucket, " +
+		"MIN(value) AS min_value, MAX(value) AS max_value, AVG(value) AS avg_value, COUNT(*) AS count " +
+		"FROM device_telemetry WHERE device_id = ? AND metric IN (" + placeholders + ") AND ts >= ? AND ts < ? " +
+		"GROUP BY metric, bucket ORDER BY metric, bucket"
+	args := []interface{}{start, step.Milliseconds(), deviceId}
+	for _, metric := range metrics {
+		args = append(args, metric)
+	}
+	args = append(args, start, end)
+	result, err := g.DB().GetAll(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range result {
+		buckets = append(buckets, TelemetryBucket{
+			Metric: row["metric"].String(),
+			Time:   start.Add(time.Duration(row["bucket"].Int64()) * step),
+			Min:    row["min_value"].Float64(),
+			Max:    row["max_value"].Float64(),
+			Avg:    row["avg_value"].Float64(),
+			Count:  row["count"].Int(),
+		})
+	}
+	return buckets, nil
+}
+
+// 删除设备的遥测数据
+func (dao *TelemetryDao) Delete(ctx g.Ctx, deviceId string) error {
+	_, err := g.DB().Model("device_telemetry").Ctx(ctx).Where("device_id", deviceId).Delete()
+	return err
+}
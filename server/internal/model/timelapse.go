@@ -0,0 +1,43 @@
+package model
+
+import (
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+type TimelapseCreateReq struct {
+	g.Meta    `path:"/timelapse" method:"post" tags:"延时视频" summary:"创建延时视频任务"`
+	DeviceId  string `json:"deviceId" v:"required" dc:"设备ID"`
+	StartTime string `json:"startTime" v:"required" dc:"开始时间，格式 2006-01-02 15:04:05"`
+	EndTime   string `json:"endTime" v:"required" dc:"结束时间，格式 2006-01-02 15:04:05"`
+	Fps       int    `json:"fps" dc:"帧率，默认10"`
+	Skip      int    `json:"skip" dc:"每取一帧后跳过的帧数，默认0"`
+	Gif       bool   `json:"gif" dc:"同时生成缩小的 GIF 动画"`
+	GifWidth  int    `json:"gifWidth" dc:"GIF 宽度（像素），默认使用配置值"`
+}
+
+type TimelapseListReq struct {
+	g.Meta   `path:"/timelapse" method:"get" tags:"延时视频" summary:"获取延时视频任务列表"`
+	DeviceId string `json:"deviceId" dc:"设备ID，为空时返回全部"`
+}
+
+type TimelapseGetReq struct {
+	g.Meta `path:"/timelapse/{id}" method:"get" tags:"延时视频" summary:"获取延时视频任务详情"`
+	Id     string `json:"id" v:"required" dc:"任务ID"`
+}
+
+type TimelapseDownloadReq struct {
+	g.Meta `path:"/timelapse/{id}/download" method:"get" tags:"延时视频" summary:"下载生成的视频或 GIF"`
+	Id     string `json:"id" v:"required" dc:"任务ID"`
+	Format string `json:"format" dc:"文件格式：avi（默认）、gif"`
+}
+
+type TimelapseDeleteReq struct {
+	g.Meta `path:"/timelapse/{id}" method:"delete" tags:"延时视频" summary:"删除延时视频任务及生成的文件，运行中的任务会被取消"`
+	Id     string `json:"id" v:"required" dc:"任务ID"`
+}
+
+type TimelapseRes struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
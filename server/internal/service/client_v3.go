@@ -0,0 +1,120 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// 基于 paho.mqtt.golang 的 MQTT 3.1.1 客户端
+type clientV3 struct {
+	cfg     *MQTTConfig
+	client  mqtt.Client
+	handler func(*inboundMessage)
+}
+
+func newClientV3(cfg *MQTTConfig, handler func(*inboundMessage)) (*clientV3, error) {
+	c := &clientV3{cfg: cfg, handler: handler}
+
+	// 日志是 paho 的包级变量，按配置设置，同一进程中的客户端使用相同的配置
+	if cfg.DebugLog {
+		mqtt.DEBUG = log.New(log.Writer(), "MQTT DEBUG: ", log.Ltime|log.Lshortfile)
+	} else {
+		mqtt.DEBUG = mqtt.NOOPLogger{}
+	}
+	mqtt.ERROR = log.New(log.Writer(), "MQTT ERROR: ", log.Ltime|log.Lshortfile)
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(cfg.Broker)
+	opts.SetClientID(cfg.ClientId())
+	opts.SetDefaultPublishHandler(c.onMessage)
+	opts.SetOnConnectHandler(c.onConnect)
+	opts.SetConnectionLostHandler(c.onConnectionLost)
+
+	// 添加更多连接选项
+	opts.SetAutoReconnect(cfg.AutoReconnect)
+	opts.SetMaxReconnectInterval(time.Duration(cfg.MaxReconnectInterval) * time.Second)
+	opts.SetKeepAlive(time.Duration(cfg.KeepAlive) * time.Second)
+	if cfg.UseTLS() {
+		tlsConfig, err := cfg.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConfig)
+	}
+	if cfg.Session.Persistent {
+		// 持久会话：服务器在断线期间缓存QoS 1/2消息，未确认的消息写入文件存储
+		if err := os.MkdirAll(cfg.Session.StoreDir, 0755); err != nil {
+			return nil, fmt.Errorf("创建MQTT会话存储目录失败: %v", err)
+		}
+		opts.SetCleanSession(false)
+		opts.SetStore(mqtt.NewFileStore(cfg.Session.StoreDir))
+		opts.SetResumeSubs(true)
+	} else {
+		opts.SetCleanSession(true)
+	}
+	// 回调只负责把消息放入接收管道，按到达顺序调用才能保证同一设备的消息有序。
+	// 回调在客户端的接收协程中执行，block 策略下阻塞期间无法处理心跳应答，因此等待时间必须小于 keepAlive
+	opts.SetOrderMatters(true)
+
+	c.client = mqtt.NewClient(opts)
+	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
+		log.Printf("MQTT连接失败: %v", token.Error())
+	}
+	return c, nil
+}
+
+// 连接成功回调
+func (c *clientV3) onConnect(client mqtt.Client) {
+	log.Println("MQTT已连接")
+	// 订阅配置中的所有主题
+	topics := c.cfg.Subscriptions()
+	if len(topics) == 0 {
+		return
+	}
+	filters := make(map[string]byte, len(topics))
+	for _, topic := range topics {
+		filters[topic] = byte(c.cfg.Qos)
+	}
+	if token := client.SubscribeMultiple(filters, c.onMessage); token.Wait() && token.Error() != nil {
+		log.Printf("订阅主题失败: %v", token.Error())
+	} else {
+		log.Printf("成功订阅主题: %v", topics)
+	}
+}
+
+// 连接断开回调
+func (c *clientV3) onConnectionLost(client mqtt.Client, err error) {
+	log.Printf("MQTT连接断开: %v", err)
+}
+
+func (c *clientV3) onMessage(client mqtt.Client, msg mqtt.Message) {
+	c.handler(&inboundMessage{
+		Topic:      msg.Topic(),
+		Payload:    msg.Payload(),
+		Qos:        msg.Qos(),
+		Retained:   msg.Retained(),
+		Duplicate:  msg.Duplicate(),
+		MessageId:  msg.MessageID(),
+		ReceivedAt: time.Now(),
+	})
+}
+
+func (c *clientV3) Publish(topic string, qos byte, retained bool, payload []byte) (*uint16, error) {
+	token := c.client.Publish(topic, qos, retained, payload)
+	if token.Wait() && token.Error() != nil {
+		return nil, token.Error()
+	}
+	if pt, ok := token.(*mqtt.PublishToken); ok && qos > 0 {
+		id := pt.MessageID()
+		return &id, nil
+	}
+	return nil, nil
+}
+
+func (c *clientV3) Disconnect() {
+	c.client.Disconnect(250)
+}
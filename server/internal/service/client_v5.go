@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/eclipse/paho.golang/paho/session/state"
+	"github.com/eclipse/paho.golang/paho/store/file"
+)
+
+// 持久会话在服务器端的保留时间（秒）
+const sessionExpiryInterval = 7 * 24 * 3600
+
+// 发布消息的超时时间
+const publishTimeout = 10 * time.Second
+
+// 基于 paho.golang 的 MQTT v5 客户端，支持读取消息属性
+type clientV5 struct {
+	cfg     *MQTTConfig
+	cm      *autopaho.ConnectionManager
+	cancel  context.CancelFunc
+	handler func(*inboundMessage)
+}
+
+func newClientV5(cfg *MQTTConfig, handler func(*inboundMessage)) (*clientV5, error) {
+	c := &clientV5{cfg: cfg, handler: handler}
+
+	u, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt.broker 格式错误: %v", err)
+	}
+
+	pahoCfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     uint16(cfg.KeepAlive),
+		CleanStartOnInitialConnection: !cfg.Session.Persistent,
+		ConnectRetryDelay:             time.Duration(cfg.MaxReconnectInterval) * time.Second,
+		OnConnectionUp:                c.onConnectionUp,
+		OnConnectError: func(err error) {
+			log.Printf("MQTT连接失败: %v", err)
+		},
+		Errors: log.New(log.Writer(), "MQTT ERROR: ", log.Ltime|log.Lshortfile),
+		ClientConfig: paho.ClientConfig{
+			ClientID:          cfg.ClientId(),
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublishReceived},
+			OnClientError: func(err error) {
+				log.Printf("MQTT客户端错误: %v", err)
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				log.Printf("MQTT服务器断开连接，原因码: %d", d.ReasonCode)
+			},
+		},
+	}
+	if cfg.UseTLS() {
+		tlsConfig, err := cfg.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		pahoCfg.TlsCfg = tlsConfig
+	}
+	if cfg.Session.Persistent {
+		// 持久会话：服务器保留会话，未确认的消息写入文件存储
+		session, err := newFileSession(cfg.Session.StoreDir)
+		if err != nil {
+			return nil, err
+		}
+		pahoCfg.SessionExpiryInterval = sessionExpiryInterval
+		pahoCfg.Session = session
+	}
+	if !cfg.AutoReconnect {
+		log.Printf("警告: MQTT v5 客户端始终自动重连，mqtt.autoReconnect 配置被忽略")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cm, err := autopaho.NewConnection(ctx, pahoCfg)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("创建MQTT v5连接失败: %v", err)
+	}
+	c.cm = cm
+	c.cancel = cancel
+	return c, nil
+}
+
+// 创建基于文件的会话存储，客户端和服务器生成的报文分别存放
+func newFileSession(dir string) (*state.State, error) {
+	clientDir := filepath.Join(dir, "client")
+	serverDir := filepath.Join(dir, "server")
+	for _, d := range []string{clientDir, serverDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return nil, fmt.Errorf("创建MQTT会话存储目录失败: %v", err)
+		}
+	}
+	clientStore, err := file.New(clientDir, "pkt_", ".bin")
+	if err != nil {
+		return nil, fmt.Errorf("创建MQTT会话存储失败: %v", err)
+	}
+	serverStore, err := file.New(serverDir, "pkt_", ".bin")
+	if err != nil {
+		return nil, fmt.Errorf("创建MQTT会话存储失败: %v", err)
+	}
+	return state.New(clientStore, serverStore), nil
+}
+
+// 连接成功回调
+func (c *clientV5) onConnectionUp(cm *autopaho.ConnectionManager, connack *paho.Connack) {
+	log.Printf("MQTT v5已连接，会话已恢复: %v", connack.SessionPresent)
+	topics := c.cfg.Subscriptions()
+	if len(topics) == 0 {
+		return
+	}
+	sub := &paho.Subscribe{}
+	for _, topic := range topics {
+		sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: topic, QoS: byte(c.cfg.Qos)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if _, err := cm.Subscribe(ctx, sub); err != nil {
+		log.Printf("订阅主题失败: %v", err)
+	} else {
+		log.Printf("成功订阅主题: %v", topics)
+	}
+}
+
+func (c *clientV5) onPublishReceived(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+	msg := &inboundMessage{
+		Topic:      p.Topic,
+		Payload:    p.Payload,
+		Qos:        p.QoS,
+		Retained:   p.Retain,
+		Duplicate:  p.Duplicate(),
+		MessageId:  p.PacketID,
+		ReceivedAt: time.Now(),
+	}
+	if p.Properties != nil {
+		msg.ContentType = p.Properties.ContentType
+		msg.MessageExpiry = p.Properties.MessageExpiry
+		if len(p.Properties.User) > 0 {
+			msg.UserProperties = make(map[string]string, len(p.Properties.User))
+			for _, prop := range p.Properties.User {
+				msg.UserProperties[prop.Key] = prop.Value
+			}
+		}
+	}
+	c.handler(msg)
+	return true, nil
+}
+
+// 发布消息；v5 客户端内部分配报文ID且不对外提供，报文ID固定返回 nil
+func (c *clientV5) Publish(topic string, qos byte, retained bool, payload []byte) (*uint16, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+	if err := c.cm.AwaitConnection(ctx); err != nil {
+		return nil, fmt.Errorf("MQTT未连接: %v", err)
+	}
+	_, err := c.cm.Publish(ctx, &paho.Publish{
+		Topic:   topic,
+		QoS:     qos,
+		Retain:  retained,
+		Payload: payload,
+	})
+	return nil, err
+}
+
+func (c *clientV5) Disconnect() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = c.cm.Disconnect(ctx)
+	c.cancel()
+}
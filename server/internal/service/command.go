@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/util/guid"
+)
+
+// CommandConfig 对应 config.yaml 中的 command 配置段
+type CommandConfig struct {
+	Topic          string   `json:"topic"`          // 下发主题模板，{deviceId} 替换为设备ID
+	Qos            int      `json:"qos"`            // 下发使用的QoS
+	DefaultTimeout int      `json:"defaultTimeout"` // 默认确认超时（秒）
+	MaxTimeout     int      `json:"maxTimeout"`     // 允许的最大确认超时（秒）
+	Allowed        []string `json:"allowed"`        // 允许下发的命令名称，为空时不限制
+}
+
+// 命令名称只允许小写字母、数字和下划线
+var commandNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// 超时检查间隔
+const commandSweepInterval = 5 * time.Second
+
+func defaultCommandConfig() CommandConfig {
+	return CommandConfig{
+		Topic:          "device/{deviceId}/cmd",
+		Qos:            1,
+		DefaultTimeout: 30,
+		MaxTimeout:     3600,
+		Allowed:        []string{"capture_now", "set_interval", "reboot"},
+	}
+}
+
+// 读取命令配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadCommandConfig(ctx context.Context) (*CommandConfig, error) {
+	cfg := defaultCommandConfig()
+
+	v, err := g.Cfg().Get(ctx, "command")
+	if err != nil {
+		return nil, fmt.Errorf("读取command配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析command配置失败: %v", err)
+		}
+	}
+
+	envString("COMMAND_TOPIC", &cfg.Topic)
+	if err := envInt("COMMAND_DEFAULT_TIMEOUT", &cfg.DefaultTimeout); err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(cfg.Topic, "{deviceId}") {
+		return nil, fmt.Errorf("command.topic 必须包含 {deviceId}，当前为 '%s'", cfg.Topic)
+	}
+	if cfg.Qos < 0 || cfg.Qos > 2 {
+		return nil, fmt.Errorf("command.qos 必须为 0、1 或 2，当前为 %d", cfg.Qos)
+	}
+	if cfg.DefaultTimeout <= 0 || cfg.MaxTimeout < cfg.DefaultTimeout {
+		return nil, fmt.Errorf("command.defaultTimeout 必须大于0且不超过 command.maxTimeout")
+	}
+	for _, name := range cfg.Allowed {
+		if !commandNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("command.allowed 中的命令名称非法: '%s'", name)
+		}
+	}
+	return &cfg, nil
+}
+
+// 下发到设备的命令
+type commandMessage struct {
+	Id     string          `json:"id"`
+	Name   string          `json:"name"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Ts     int64           `json:"ts"` // 下发时间，Unix毫秒
+}
+
+// 设备回复的确认
+type commandAck struct {
+	Id      string          `json:"id"`
+	Success *bool           `json:"success"` // 缺省时根据 error 是否为空判断
+	Result  json.RawMessage `json:"result"`
+	Error   string          `json:"error"`
+}
+
+// 下发命令：先写入命令历史，再发布到设备的命令主题
+func (s *MQTTService) SendCommand(ctx context.Context, deviceId string, name string, params map[string]interface{}, timeout int) (*model.CommandModel, error) {
+	// 设备ID会拼入主题，含 + # / 时会发布到通配或其他设备的主题
+	if !validDeviceId(deviceId) {
+		return nil, fmt.Errorf("设备ID非法: '%s'", deviceId)
+	}
+	if !commandNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("命令名称非法: '%s'", name)
+	}
+	if len(s.commandCfg.Allowed) > 0 && !containsString(s.commandCfg.Allowed, name) {
+		return nil, fmt.Errorf("不允许下发的命令: '%s'", name)
+	}
+	if timeout == 0 {
+		timeout = s.commandCfg.DefaultTimeout
+	}
+	if timeout < 0 || timeout > s.commandCfg.MaxTimeout {
+		return nil, fmt.Errorf("超时时间必须在 1-%d 秒之间", s.commandCfg.MaxTimeout)
+	}
+	device, err := model.Device.Get(ctx, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("获取设备信息失败: %v", err)
+	}
+	if device == nil {
+		return nil, fmt.Errorf("设备不存在")
+	}
+
+	var rawParams json.RawMessage
+	if len(params) > 0 {
+		if rawParams, err = json.Marshal(params); err != nil {
+			return nil, fmt.Errorf("序列化命令参数失败: %v", err)
+		}
+	}
+	now := time.Now()
+	cmd := &model.CommandModel{
+		Id:        guid.S(),
+		DeviceId:  deviceId,
+		Name:      name,
+		Params:    string(rawParams),
+		Status:    model.CommandPending,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(timeout) * time.Second),
+		UpdatedAt: now,
+	}
+	if err := model.Command.Add(ctx, cmd); err != nil {
+		return nil, fmt.Errorf("保存命令失败: %v", err)
+	}
+
+	payload, err := json.Marshal(commandMessage{Id: cmd.Id, Name: name, Params: rawParams, Ts: now.UnixMilli()})
+	if err != nil {
+		return nil, err
+	}
+	topic := strings.ReplaceAll(s.commandCfg.Topic, "{deviceId}", deviceId)
+	if _, err := s.client.Publish(topic, byte(s.commandCfg.Qos), false, payload); err != nil {
+		errMsg := fmt.Sprintf("发布命令失败: %v", err)
+		if ferr := model.Command.Fail(ctx, cmd.Id, errMsg); ferr != nil {
+			log.Printf("更新命令状态失败: %v", ferr)
+		}
+		cmd.Status = model.CommandFailed
+		cmd.Error = errMsg
+		return cmd, nil
+	}
+	log.Printf("已向设备 %s 下发命令 %s（%s），主题: %s", deviceId, name, cmd.Id, topic)
+	return cmd, nil
+}
+
+// 处理设备回复的命令确认
+func (s *MQTTService) handleCommandAck(msg *inboundMessage, match *TopicMatch) {
+	var ack commandAck
+	if err := json.Unmarshal(msg.Payload, &ack); err != nil {
+		log.Printf("设备 %s 的命令确认格式错误: %v", match.DeviceId, err)
+		return
+	}
+	if ack.Id == "" {
+		log.Printf("设备 %s 的命令确认缺少命令ID", match.DeviceId)
+		return
+	}
+	success := ack.Error == ""
+	if ack.Success != nil {
+		success = *ack.Success
+	}
+	result := ""
+	if len(ack.Result) > 0 && string(ack.Result) != "null" {
+		result = string(ack.Result)
+	}
+
+	updated, err := model.Command.Ack(context.Background(), match.DeviceId, ack.Id, success, result, ack.Error)
+	if err != nil {
+		log.Printf("更新命令 %s 状态失败: %v", ack.Id, err)
+		return
+	}
+	if !updated {
+		log.Printf("忽略设备 %s 对命令 %s 的确认：命令不存在或已不在等待状态", match.DeviceId, ack.Id)
+		return
+	}
+	log.Printf("设备 %s 已确认命令 %s，成功: %v", match.DeviceId, ack.Id, success)
+}
+
+// 定期将超时未确认的命令标记为超时
+func (s *MQTTService) sweepCommands() {
+	ticker := time.NewTicker(commandSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n, err := model.Command.ExpirePending(context.Background(), time.Now())
+		if err != nil {
+			log.Printf("检查命令超时失败: %v", err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("%d 条命令等待确认超时", n)
+		}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
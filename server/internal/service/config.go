@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// MQTTConfig 对应 config.yaml 中的 mqtt 配置段
+type MQTTConfig struct {
+	Broker               string        `json:"broker"`
+	ProtocolVersion      int           `json:"protocolVersion"` // 4 表示 MQTT 3.1.1，5 表示 MQTT v5
+	ClientIdPrefix       string        `json:"clientIdPrefix"`
+	ImageDir             string        `json:"imageDir"`
+	SubscribeTopics      []string      `json:"subscribeTopics"`
+	Qos                  int           `json:"qos"`
+	KeepAlive            int           `json:"keepAlive"` // 心跳间隔（秒）
+	AutoReconnect        bool          `json:"autoReconnect"`
+	MaxReconnectInterval int           `json:"maxReconnectInterval"` // 最大重连间隔（秒）
+	TLS                  TLSConfig     `json:"tls"`
+	TopicRules           []TopicRule   `json:"topicRules"` // 主题映射规则，按顺序匹配
+	Session              SessionConfig `json:"session"`
+	DebugLog             bool          `json:"debugLog"` // 输出 MQTT 3.1.1 客户端的调试日志
+}
+
+// SessionConfig 对应 mqtt.session 配置段
+type SessionConfig struct {
+	Persistent bool   `json:"persistent"` // 使用持久会话，服务重启期间由服务器缓存消息
+	ClientId   string `json:"clientId"`   // 持久会话使用的固定客户端ID
+	StoreDir   string `json:"storeDir"`   // 未确认消息的文件存储目录
+}
+
+// TLSConfig 对应 mqtt.tls 配置段，仅在 ssl/tls/mqtts/wss 协议下生效
+type TLSConfig struct {
+	CaFile             string `json:"caFile"`             // CA证书文件，为空时使用系统根证书
+	CertFile           string `json:"certFile"`           // 客户端证书（双向认证）
+	KeyFile            string `json:"keyFile"`            // 客户端私钥（双向认证）
+	ServerName         string `json:"serverName"`         // 覆盖证书校验使用的服务器名称
+	MinVersion         string `json:"minVersion"`         // 最低TLS版本：1.0/1.1/1.2/1.3
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"` // 跳过证书校验，仅用于调试
+}
+
+// 支持的最低TLS版本
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// 默认配置，配置文件中未声明的项使用这里的值
+func defaultMQTTConfig() MQTTConfig {
+	return MQTTConfig{
+		ProtocolVersion:      4,
+		ClientIdPrefix:       "server_",
+		ImageDir:             "images",
+		SubscribeTopics:      []string{"device/+/image"},
+		Qos:                  1,
+		KeepAlive:            60,
+		AutoReconnect:        true,
+		MaxReconnectInterval: 10,
+		TLS: TLSConfig{
+			MinVersion: "1.2",
+		},
+		TopicRules: defaultTopicRules(),
+		Session: SessionConfig{
+			StoreDir: "mqtt_store",
+		},
+		DebugLog: true,
+	}
+}
+
+// 读取MQTT配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadMQTTConfig(ctx context.Context) (*MQTTConfig, error) {
+	cfg := defaultMQTTConfig()
+
+	v, err := g.Cfg().Get(ctx, "mqtt")
+	if err != nil {
+		return nil, fmt.Errorf("读取mqtt配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析mqtt配置失败: %v", err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// 使用环境变量覆盖配置文件中的值
+func (c *MQTTConfig) applyEnv() error {
+	if v, ok := os.LookupEnv("MQTT_BROKER"); ok {
+		c.Broker = v
+	}
+	if err := envInt("MQTT_PROTOCOL_VERSION", &c.ProtocolVersion); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("MQTT_CLIENT_ID_PREFIX"); ok {
+		c.ClientIdPrefix = v
+	}
+	if v, ok := os.LookupEnv("MQTT_IMAGE_DIR"); ok {
+		c.ImageDir = v
+	}
+	if v, ok := os.LookupEnv("MQTT_SUBSCRIBE_TOPICS"); ok {
+		c.SubscribeTopics = splitList(v)
+	}
+	if err := envInt("MQTT_QOS", &c.Qos); err != nil {
+		return err
+	}
+	if err := envInt("MQTT_KEEP_ALIVE", &c.KeepAlive); err != nil {
+		return err
+	}
+	if err := envBool("MQTT_AUTO_RECONNECT", &c.AutoReconnect); err != nil {
+		return err
+	}
+	if err := envInt("MQTT_MAX_RECONNECT_INTERVAL", &c.MaxReconnectInterval); err != nil {
+		return err
+	}
+	if err := envBool("MQTT_DEBUG_LOG", &c.DebugLog); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("MQTT_TLS_CA_FILE"); ok {
+		c.TLS.CaFile = v
+	}
+	if v, ok := os.LookupEnv("MQTT_TLS_CERT_FILE"); ok {
+		c.TLS.CertFile = v
+	}
+	if v, ok := os.LookupEnv("MQTT_TLS_KEY_FILE"); ok {
+		c.TLS.KeyFile = v
+	}
+	if v, ok := os.LookupEnv("MQTT_TLS_SERVER_NAME"); ok {
+		c.TLS.ServerName = v
+	}
+	if v, ok := os.LookupEnv("MQTT_TLS_MIN_VERSION"); ok {
+		c.TLS.MinVersion = v
+	}
+	if err := envBool("MQTT_TLS_INSECURE_SKIP_VERIFY", &c.TLS.InsecureSkipVerify); err != nil {
+		return err
+	}
+	if err := envBool("MQTT_SESSION_PERSISTENT", &c.Session.Persistent); err != nil {
+		return err
+	}
+	if v, ok := os.LookupEnv("MQTT_CLIENT_ID"); ok {
+		c.Session.ClientId = v
+	}
+	if v, ok := os.LookupEnv("MQTT_STORE_DIR"); ok {
+		c.Session.StoreDir = v
+	}
+	return nil
+}
+
+// 校验配置，任何非法值都直接返回错误
+func (c *MQTTConfig) validate() error {
+	if c.Broker == "" {
+		return fmt.Errorf("mqtt.broker 不能为空")
+	}
+	u, err := url.Parse(c.Broker)
+	if err != nil {
+		return fmt.Errorf("mqtt.broker 格式错误: %v", err)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "tcps":
+		if u.Host == "" || u.Port() == "" {
+			return fmt.Errorf("mqtt.broker 缺少主机或端口: '%s'", c.Broker)
+		}
+	case "ws", "wss":
+		if u.Host == "" {
+			return fmt.Errorf("mqtt.broker 缺少主机: '%s'", c.Broker)
+		}
+	default:
+		return fmt.Errorf("mqtt.broker 不支持的协议: '%s'", u.Scheme)
+	}
+	if c.ProtocolVersion != 4 && c.ProtocolVersion != 5 {
+		return fmt.Errorf("mqtt.protocolVersion 必须为 4（MQTT 3.1.1）或 5（MQTT v5），当前为 %d", c.ProtocolVersion)
+	}
+	if c.KeepAlive > 65535 {
+		return fmt.Errorf("mqtt.keepAlive 不能超过65535，当前为 %d", c.KeepAlive)
+	}
+	if c.UseTLS() {
+		if _, err := c.TLS.build(); err != nil {
+			return err
+		}
+	}
+	if c.ImageDir == "" {
+		return fmt.Errorf("mqtt.imageDir 不能为空")
+	}
+	if len(c.TopicRules) == 0 {
+		return fmt.Errorf("mqtt.topicRules 至少需要一条规则")
+	}
+	if _, err := newTopicRouter(c.TopicRules); err != nil {
+		return err
+	}
+	for _, topic := range c.SubscribeTopics {
+		if err := validateTopicFilter(topic); err != nil {
+			return fmt.Errorf("mqtt.subscribeTopics 非法主题 '%s': %v", topic, err)
+		}
+	}
+	if c.Qos < 0 || c.Qos > 2 {
+		return fmt.Errorf("mqtt.qos 必须为 0、1 或 2，当前为 %d", c.Qos)
+	}
+	if c.KeepAlive <= 0 {
+		return fmt.Errorf("mqtt.keepAlive 必须大于0，当前为 %d", c.KeepAlive)
+	}
+	if c.MaxReconnectInterval <= 0 {
+		return fmt.Errorf("mqtt.maxReconnectInterval 必须大于0，当前为 %d", c.MaxReconnectInterval)
+	}
+	if c.Session.Persistent {
+		if c.Session.ClientId == "" {
+			return fmt.Errorf("mqtt.session.persistent 开启时必须配置固定的 mqtt.session.clientId")
+		}
+		if c.Session.StoreDir == "" {
+			return fmt.Errorf("mqtt.session.persistent 开启时 mqtt.session.storeDir 不能为空")
+		}
+		if c.Qos == 0 {
+			return fmt.Errorf("mqtt.session.persistent 开启时 mqtt.qos 必须大于0，QoS 0 的消息不会被服务器缓存")
+		}
+	}
+	return nil
+}
+
+// 客户端ID：持久会话使用固定ID，否则使用前缀加时间戳
+func (c *MQTTConfig) ClientId() string {
+	if c.Session.Persistent {
+		return c.Session.ClientId
+	}
+	return fmt.Sprintf("%s%d", c.ClientIdPrefix, time.Now().Unix())
+}
+
+// 实际订阅的主题：subscribeTopics 与主题规则推导出的主题合并去重
+func (c *MQTTConfig) Subscriptions() []string {
+	router, err := newTopicRouter(c.TopicRules)
+	if err != nil {
+		return c.SubscribeTopics
+	}
+	seen := make(map[string]bool)
+	var topics []string
+	for _, topic := range append(append([]string{}, c.SubscribeTopics...), router.Filters()...) {
+		if !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// 是否使用加密连接
+func (c *MQTTConfig) UseTLS() bool {
+	switch strings.SplitN(c.Broker, "://", 2)[0] {
+	case "ssl", "tls", "mqtts", "tcps", "wss":
+		return true
+	}
+	return false
+}
+
+// 根据配置构造 tls.Config，证书文件在此处读取，错误直接返回
+func (c *TLSConfig) build() (*tls.Config, error) {
+	version, ok := tlsVersions[c.MinVersion]
+	if !ok {
+		return nil, fmt.Errorf("mqtt.tls.minVersion 不支持的版本: '%s'", c.MinVersion)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         version,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CaFile != "" {
+		pem, err := os.ReadFile(c.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA证书文件中没有有效的证书: %s", c.CaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, fmt.Errorf("mqtt.tls.certFile 与 mqtt.tls.keyFile 必须同时配置")
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// 校验MQTT订阅主题过滤器
+func validateTopicFilter(filter string) error {
+	if filter == "" {
+		return fmt.Errorf("主题为空")
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		if strings.Contains(level, "#") && (level != "#" || i != len(levels)-1) {
+			return fmt.Errorf("'#' 只能作为最后一级单独出现")
+		}
+		if strings.Contains(level, "+") && level != "+" {
+			return fmt.Errorf("'+' 必须单独占据一级")
+		}
+	}
+	return nil
+}
+
+// 将逗号分隔的字符串拆分为列表，忽略空项
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func envString(key string, dst *string) {
+	if v, ok := os.LookupEnv(key); ok {
+		*dst = v
+	}
+}
+
+func envInt(key string, dst *int) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("环境变量 %s 不是合法整数: '%s'", key, v)
+	}
+	*dst = n
+	return nil
+}
+
+func envBool(key string, dst *bool) error {
+	v, ok := os.LookupEnv(key)
+	if !ok {
+		return nil
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(v))
+	if err != nil {
+		return fmt.Errorf("环境变量 %s 不是合法布尔值: '%s'", key, v)
+	}
+	*dst = b
+	return nil
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 图像信封格式（版本1），所有整数均为大端序：
+//
+//	+--------+---------+-------------+-------------+------------+
+//	| "VCFE" | 版本(1) | 头部长度(4) | JSON 头部   | JPEG 数据  |
+//	+--------+---------+-------------+-------------+------------+
+//
+// 不以 "VCFE" 开头的负载按裸 JPEG 处理，兼容旧固件。
+var envelopeMagic = []byte("VCFE")
+
+const (
+	envelopeVersion   = 1
+	envelopeMaxHeader = 64 * 1024
+	envelopePrefixLen = 4 + 1 + 4
+)
+
+// EnvelopeHeader 信封头部，字段均为可选
+type EnvelopeHeader struct {
+	CapturedAt json.RawMessage `json:"capturedAt,omitempty"` // RFC3339 字符串或 Unix 秒/毫秒时间戳
+	Seq        *int64          `json:"seq,omitempty"`        // 设备帧序号
+	Resolution string          `json:"resolution,omitempty"` // 分辨率，例如 1920x1080
+	Firmware   string          `json:"firmware,omitempty"`   // 固件版本
+	Channel    string          `json:"channel,omitempty"`    // 摄像头通道
+}
+
+// 解析后的信封
+type envelope struct {
+	Header     EnvelopeHeader
+	CapturedAt *time.Time
+	Image      []byte
+}
+
+// 判断负载是否为信封格式
+func isEnvelope(payload []byte) bool {
+	return bytes.HasPrefix(payload, envelopeMagic)
+}
+
+// 解析信封，非信封格式的负载原样作为图像返回
+func parseEnvelope(payload []byte) (*envelope, error) {
+	if !isEnvelope(payload) {
+		return &envelope{Image: payload}, nil
+	}
+	if len(payload) < envelopePrefixLen {
+		return nil, fmt.Errorf("信封长度不足: %d字节", len(payload))
+	}
+	version := payload[len(envelopeMagic)]
+	if version != envelopeVersion {
+		return nil, fmt.Errorf("不支持的信封版本: %d", version)
+	}
+	headerLen := binary.BigEndian.Uint32(payload[len(envelopeMagic)+1 : envelopePrefixLen])
+	if headerLen > envelopeMaxHeader {
+		return nil, fmt.Errorf("信封头部过大: %d字节", headerLen)
+	}
+	if uint64(envelopePrefixLen)+uint64(headerLen) > uint64(len(payload)) {
+		return nil, fmt.Errorf("信封头部长度 %d 超出负载长度 %d", headerLen, len(payload))
+	}
+
+	env := &envelope{Image: payload[envelopePrefixLen+int(headerLen):]}
+	if headerLen > 0 {
+		if err := json.Unmarshal(payload[envelopePrefixLen:envelopePrefixLen+int(headerLen)], &env.Header); err != nil {
+			return nil, fmt.Errorf("解析信封头部失败: %v", err)
+		}
+	}
+	if raw := env.Header.CapturedAt; len(raw) > 0 && string(raw) != "null" {
+		t, err := parseDeviceTime(strings.Trim(string(raw), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("解析信封 capturedAt 失败: %v", err)
+		}
+		env.CapturedAt = &t
+	}
+	return env, nil
+}
+
+// 生成信封格式的负载
+func EncodeEnvelope(header EnvelopeHeader, image []byte) ([]byte, error) {
+	data, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, envelopePrefixLen+len(data)+len(image)))
+	buf.Write(envelopeMagic)
+	buf.WriteByte(envelopeVersion)
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	buf.Write(image)
+	return buf.Bytes(), nil
+}
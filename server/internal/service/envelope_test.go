@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// 按信封格式拼接负载，header 原样写入，便于构造非法的头部
+func rawEnvelope(version byte, header string, image []byte) []byte {
+	buf := bytes.NewBuffer(nil)
+	buf.Write(envelopeMagic)
+	buf.WriteByte(version)
+	_ = binary.Write(buf, binary.BigEndian, uint32(len(header)))
+	buf.WriteString(header)
+	buf.Write(image)
+	return buf.Bytes()
+}
+
+func TestParseEnvelope(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x01, 0xFF, 0xD9}
+	tooLarge := rawEnvelope(envelopeVersion, "", jpeg)
+	binary.BigEndian.PutUint32(tooLarge[5:], envelopeMaxHeader+1)
+	overflow := rawEnvelope(envelopeVersion, "", jpeg)
+	binary.BigEndian.PutUint32(overflow[5:], uint32(len(jpeg)+1))
+
+	tests := []struct {
+		name       string
+		payload    []byte
+		ok         bool
+		image      []byte
+		capturedAt time.Time
+		seq        int64
+		resolution string
+	}{
+		{name: "裸 JPEG", payload: jpeg, ok: true, image: jpeg},
+		{name: "空负载", payload: []byte{}, ok: true, image: []byte{}},
+		{name: "没有头部", payload: rawEnvelope(envelopeVersion, "", jpeg), ok: true, image: jpeg},
+		{name: "空的 JSON 头部", payload: rawEnvelope(envelopeVersion, "{}", jpeg), ok: true, image: jpeg},
+		{
+			name:       "RFC3339 时间",
+			payload:    rawEnvelope(envelopeVersion, `{"capturedAt":"2025-03-16T21:23:05.123+08:00","seq":7,"resolution":"1920x1080"}`, jpeg),
+			ok:         true,
+			image:      jpeg,
+			capturedAt: time.Date(2025, 3, 16, 13, 23, 5, 123e6, time.UTC),
+			seq:        7,
+			resolution: "1920x1080",
+		},
+		{
+			name:       "Unix 秒",
+			payload:    rawEnvelope(envelopeVersion, `{"capturedAt":1742131385}`, jpeg),
+			ok:         true,
+			image:      jpeg,
+			capturedAt: time.Unix(1742131385, 0),
+		},
+		{
+			name:       "Unix 毫秒",
+			payload:    rawEnvelope(envelopeVersion, `{"capturedAt":1742131385123}`, jpeg),
+			ok:         true,
+			image:      jpeg,
+			capturedAt: time.UnixMilli(1742131385123),
+		},
+		{
+			name:       "字符串形式的时间戳",
+			payload:    rawEnvelope(envelopeVersion, `{"capturedAt":"1742131385"}`, jpeg),
+			ok:         true,
+			image:      jpeg,
+			capturedAt: time.Unix(1742131385, 0),
+		},
+		{name: "capturedAt 为 null", payload: rawEnvelope(envelopeVersion, `{"capturedAt":null}`, jpeg), ok: true, image: jpeg},
+		{name: "没有图像数据", payload: rawEnvelope(envelopeVersion, `{"seq":1}`, nil), ok: true, image: []byte{}, seq: 1},
+
+		{name: "前缀不完整", payload: []byte("VCFE\x01\x00"), ok: false},
+		{name: "不支持的版本", payload: rawEnvelope(2, "{}", jpeg), ok: false},
+		{name: "头部过大", payload: tooLarge, ok: false},
+		{name: "头部长度超出负载", payload: overflow, ok: false},
+		{name: "头部不是 JSON", payload: rawEnvelope(envelopeVersion, "not json", jpeg), ok: false},
+		{name: "非法的时间", payload: rawEnvelope(envelopeVersion, `{"capturedAt":"yesterday"}`, jpeg), ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := parseEnvelope(tt.payload)
+			if (err == nil) != tt.ok {
+				t.Fatalf("parseEnvelope 返回 %v，是否成功应为 %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if !bytes.Equal(env.Image, tt.image) {
+				t.Errorf("图像为 %x，应为 %x", env.Image, tt.image)
+			}
+			if tt.capturedAt.IsZero() {
+				if env.CapturedAt != nil {
+					t.Errorf("CapturedAt 为 %v，应为空", env.CapturedAt)
+				}
+			} else if env.CapturedAt == nil || !env.CapturedAt.Equal(tt.capturedAt) {
+				t.Errorf("CapturedAt 为 %v，应为 %v", env.CapturedAt, tt.capturedAt)
+			}
+			if tt.seq != 0 && (env.Header.Seq == nil || *env.Header.Seq != tt.seq) {
+				t.Errorf("Seq 为 %v，应为 %d", env.Header.Seq, tt.seq)
+			}
+			if env.Header.Resolution != tt.resolution {
+				t.Errorf("Resolution 为 %q，应为 %q", env.Header.Resolution, tt.resolution)
+			}
+		})
+	}
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xD9}
+	seq := int64(42)
+	payload, err := EncodeEnvelope(EnvelopeHeader{
+		CapturedAt: []byte(`"2025-03-16T13:23:05Z"`),
+		Seq:        &seq,
+		Firmware:   "1.2.3",
+		Channel:    "ch2",
+	}, jpeg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEnvelope(payload) {
+		t.Fatal("编码结果应为信封格式")
+	}
+	env, err := parseEnvelope(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(env.Image, jpeg) {
+		t.Errorf("图像为 %x，应为 %x", env.Image, jpeg)
+	}
+	if want := time.Date(2025, 3, 16, 13, 23, 5, 0, time.UTC); env.CapturedAt == nil || !env.CapturedAt.Equal(want) {
+		t.Errorf("CapturedAt 为 %v，应为 %v", env.CapturedAt, want)
+	}
+	if env.Header.Seq == nil || *env.Header.Seq != seq || env.Header.Firmware != "1.2.3" || env.Header.Channel != "ch2" {
+		t.Errorf("头部为 %+v", env.Header)
+	}
+}
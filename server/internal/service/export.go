@@ -0,0 +1,237 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// ExportConfig 对应 config.yaml 中的 export 配置段
+type ExportConfig struct {
+	MaxFrames  int `json:"maxFrames"`  // 一次导出的最大帧数
+	MaxDevices int `json:"maxDevices"` // 一次导出的最大设备数
+}
+
+// 从索引分批读取帧的批大小
+const exportBatchSize = 500
+
+func defaultExportConfig() ExportConfig {
+	return ExportConfig{
+		MaxFrames:  20000,
+		MaxDevices: 16,
+	}
+}
+
+// 读取导出配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadExportConfig(ctx context.Context) (*ExportConfig, error) {
+	cfg := defaultExportConfig()
+
+	v, err := g.Cfg().Get(ctx, "export")
+	if err != nil {
+		return nil, fmt.Errorf("读取export配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析export配置失败: %v", err)
+		}
+	}
+
+	if err := envInt("EXPORT_MAX_FRAMES", &cfg.MaxFrames); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxFrames <= 0 {
+		return nil, fmt.Errorf("export.maxFrames 必须大于0，当前为 %d", cfg.MaxFrames)
+	}
+	if cfg.MaxDevices <= 0 {
+		return nil, fmt.Errorf("export.maxDevices 必须大于0，当前为 %d", cfg.MaxDevices)
+	}
+	return &cfg, nil
+}
+
+// ExportManifestEntry 清单中的一帧
+type ExportManifestEntry struct {
+	DeviceId   string     `json:"deviceId"`
+	File       string     `json:"file"` // 压缩包中的文件名
+	FrameTime  time.Time  `json:"frameTime"`
+	CapturedAt *time.Time `json:"capturedAt"`
+	ReceivedAt time.Time  `json:"receivedAt"`
+	Size       int64      `json:"size"`
+	Sha256     string     `json:"sha256"` // 按导出的内容计算
+	Width      int        `json:"width"`
+	Height     int        `json:"height"`
+	StorageKey string     `json:"storageKey"`
+}
+
+// ExportManifest 导出清单，以 manifest.json 写在压缩包末尾，帧列表同时写入 manifest.csv
+type ExportManifest struct {
+	DeviceIds   []string              `json:"deviceIds"`
+	StartTime   time.Time             `json:"startTime"`
+	EndTime     time.Time             `json:"endTime"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Frames      []ExportManifestEntry `json:"frames"`
+	Missing     []string              `json:"missing"` // 有索引但读取失败的帧的对象键
+}
+
+// Export 一次导出：设备在 [Start, End) 内的全部帧
+type Export struct {
+	DeviceIds []string
+	Start     time.Time
+	End       time.Time
+	Frames    int // 索引中的帧数
+	storage   storage.Storage
+}
+
+// 校验导出范围并统计帧数，超出限制时返回错误；在写出响应之前调用，错误仍可以 JSON 返回
+func (s *MQTTService) PrepareExport(ctx context.Context, deviceIds []string, start time.Time, end time.Time) (*Export, error) {
+	if len(deviceIds) == 0 {
+		return nil, fmt.Errorf("设备ID不能为空")
+	}
+	if len(deviceIds) > s.exportCfg.MaxDevices {
+		return nil, fmt.Errorf("一次最多导出 %d 台设备", s.exportCfg.MaxDevices)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	export := &Export{DeviceIds: deviceIds, Start: start, End: end, storage: s.storage}
+	for _, deviceId := range deviceIds {
+		count, err := model.Image.Count(ctx, deviceId, start, end)
+		if err != nil {
+			return nil, fmt.Errorf("统计设备 %s 的帧数失败: %v", deviceId, err)
+		}
+		export.Frames += count
+	}
+	if export.Frames > s.exportCfg.MaxFrames {
+		return nil, fmt.Errorf("时间范围内共 %d 帧，超过单次导出上限 %d，请缩小时间范围", export.Frames, s.exportCfg.MaxFrames)
+	}
+	return export, nil
+}
+
+// 以 ZIP 格式写出原始图像和清单，逐帧读取和写出，不在内存中缓存整个压缩包。
+// 图像已经压缩，使用 Store 方式存放；文件名为 {deviceId}/{帧文件名}
+func (e *Export) WriteZip(ctx context.Context, w io.Writer) (*ExportManifest, error) {
+	manifest := &ExportManifest{
+		DeviceIds:   e.DeviceIds,
+		StartTime:   e.Start,
+		EndTime:     e.End,
+		GeneratedAt: time.Now(),
+		Frames:      make([]ExportManifestEntry, 0, e.Frames),
+		Missing:     make([]string, 0),
+	}
+	zw := zip.NewWriter(w)
+	for _, deviceId := range e.DeviceIds {
+		var after *model.ImageModel
+		for {
+			batch, err := model.Image.RangeAfter(ctx, deviceId, e.Start, e.End, after, exportBatchSize)
+			if err != nil {
+				return manifest, fmt.Errorf("查询设备 %s 的帧失败: %v", deviceId, err)
+			}
+			for i := range batch {
+				if err := ctx.Err(); err != nil {
+					return manifest, err
+				}
+				if err := e.writeFrame(ctx, zw, manifest, &batch[i]); err != nil {
+					return manifest, err
+				}
+			}
+			if len(batch) < exportBatchSize {
+				break
+			}
+			after = &batch[len(batch)-1]
+		}
+	}
+
+	if err := writeManifestCSV(zw, manifest); err != nil {
+		return manifest, err
+	}
+	mw, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return manifest, err
+	}
+	encoder := json.NewEncoder(mw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return manifest, err
+	}
+	return manifest, zw.Close()
+}
+
+// 写出一帧并记入清单，读取失败的帧记为缺失
+func (e *Export) writeFrame(ctx context.Context, zw *zip.Writer, manifest *ExportManifest, image *model.ImageModel) error {
+	data, err := model.ReadFrame(ctx, e.storage, image.StorageKey)
+	if err != nil {
+		log.Printf("导出时读取帧 %s 失败: %v", image.StorageKey, err)
+		manifest.Missing = append(manifest.Missing, image.StorageKey)
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if image.Sha256 != "" && image.Sha256 != hash {
+		log.Printf("警告: 帧 %s 的内容与索引中的哈希不一致", image.StorageKey)
+	}
+
+	name := path.Join(image.DeviceId, path.Base(image.StorageKey))
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: image.FrameTime})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	manifest.Frames = append(manifest.Frames, ExportManifestEntry{
+		DeviceId:   image.DeviceId,
+		File:       name,
+		FrameTime:  image.FrameTime,
+		CapturedAt: image.CapturedAt,
+		ReceivedAt: image.ReceivedAt,
+		Size:       int64(len(data)),
+		Sha256:     hash,
+		Width:      image.Width,
+		Height:     image.Height,
+		StorageKey: image.StorageKey,
+	})
+	return nil
+}
+
+// 写出 manifest.csv，时间使用 RFC 3339 毫秒格式
+func writeManifestCSV(zw *zip.Writer, manifest *ExportManifest) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.csv", Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	const layout = "2006-01-02T15:04:05.000Z07:00"
+	cw := csv.NewWriter(fw)
+	cw.Write([]string{"deviceId", "file", "frameTime", "capturedAt", "receivedAt", "size", "sha256", "width", "height"})
+	for _, entry := range manifest.Frames {
+		capturedAt := ""
+		if entry.CapturedAt != nil {
+			capturedAt = entry.CapturedAt.Format(layout)
+		}
+		cw.Write([]string{
+			entry.DeviceId,
+			entry.File,
+			entry.FrameTime.Format(layout),
+			capturedAt,
+			entry.ReceivedAt.Format(layout),
+			strconv.FormatInt(entry.Size, 10),
+			entry.Sha256,
+			strconv.Itoa(entry.Width),
+			strconv.Itoa(entry.Height),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"log"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+)
+
+// 默认的图像内容类型
+const defaultImageContentType = "image/jpeg"
+
+// 生成一帧的图像索引记录
+func newImageRecord(deviceId string, key string, data []byte, frameTime time.Time, meta *model.FrameMeta) *model.ImageModel {
+	sum := sha256.Sum256(data)
+	record := &model.ImageModel{
+		DeviceId:    deviceId,
+		StorageKey:  key,
+		FrameTime:   frameTime,
+		ReceivedAt:  frameTime,
+		Size:        int64(len(data)),
+		Sha256:      hex.EncodeToString(sum[:]),
+		ContentType: defaultImageContentType,
+	}
+	if meta != nil {
+		record.CapturedAt = meta.CapturedAt
+		record.ReceivedAt = meta.ReceivedAt
+		record.Width, record.Height = meta.Width, meta.Height
+		if meta.ContentType != "" {
+			record.ContentType = meta.ContentType
+		}
+	}
+	return record
+}
+
+// ReindexOptions 重建索引参数
+type ReindexOptions struct {
+	Full  bool // 重新索引全部帧，默认跳过已索引的帧
+	Prune bool // 删除存储中已不存在的帧的索引
+}
+
+// ReindexStats 重建索引结果
+type ReindexStats struct {
+	Frames  int // 存储中的帧数
+	Indexed int // 新写入或更新的索引数
+	Skipped int // 已索引而跳过的帧数
+	Failed  int // 读取或写入失败的帧数
+	Pruned  int // 删除的失效索引数
+}
+
+// 扫描存储中设备的帧，为缺少索引的帧写入图像索引
+func ReindexImages(ctx context.Context, st storage.Storage, deviceId string, opts ReindexOptions) (*ReindexStats, error) {
+	frames, err := model.ListFrames(ctx, st, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("列出设备 %s 的帧失败: %v", deviceId, err)
+	}
+	indexed, err := model.Image.Keys(ctx, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("读取设备 %s 的图像索引失败: %v", deviceId, err)
+	}
+
+	stats := &ReindexStats{Frames: len(frames)}
+	inStorage := make(map[string]bool, len(frames))
+	for _, frame := range frames {
+		inStorage[frame.Key] = true
+		if indexed[frame.Key] && !opts.Full {
+			stats.Skipped++
+			continue
+		}
+		data, err := st.Get(ctx, frame.Key)
+		if err != nil {
+			stats.Failed++
+			log.Printf("读取帧 %s 失败: %v", frame.Key, err)
+			continue
+		}
+		meta, err := model.ReadFrameMeta(ctx, st, frame.Key)
+		if err != nil {
+			log.Printf("读取帧 %s 的元数据失败: %v", frame.Key, err)
+		}
+		record := newImageRecord(deviceId, frame.Key, data, frame.Time, meta)
+		// 旧帧的元数据中没有尺寸，从图像头读取
+		if record.Width == 0 || record.Height == 0 {
+			if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+				record.Width, record.Height = config.Width, config.Height
+			}
+		}
+		if err := model.Image.Save(ctx, record); err != nil {
+			stats.Failed++
+			log.Printf("写入帧 %s 的索引失败: %v", frame.Key, err)
+			continue
+		}
+		stats.Indexed++
+	}
+
+	if opts.Prune {
+		var stale []string
+		for key := range indexed {
+			if !inStorage[key] {
+				stale = append(stale, key)
+			}
+		}
+		if err := model.Image.DeleteKeys(ctx, stale); err != nil {
+			return stats, fmt.Errorf("删除设备 %s 的失效索引失败: %v", deviceId, err)
+		}
+		stats.Pruned = len(stale)
+	}
+	return stats, nil
+}
+
+// 升级前接收的帧没有图像索引，最新图像和历史图像接口都查不到。
+// 启动时在后台为全部设备从存储补建索引，已索引的帧跳过。不能只检查设备是否已有索引：
+// 使用持久会话时，连接后立即收到的离线消息会先写入索引，设备更早的帧就永远不会补建
+func (s *MQTTService) backfillImageIndex() {
+	ctx := context.Background()
+	devices, err := model.Device.All(ctx)
+	if err != nil {
+		log.Printf("检查图像索引失败: %v", err)
+		return
+	}
+	for _, device := range devices {
+		started := time.Now()
+		stats, err := ReindexImages(ctx, s.storage, device.Id, ReindexOptions{})
+		if err != nil {
+			log.Printf("补建设备 %s 的图像索引失败: %v，请执行 reindex 命令", device.Id, err)
+			continue
+		}
+		if stats.Indexed > 0 || stats.Failed > 0 {
+			log.Printf("警告: 设备 %s 的存储中有 %d 帧没有图像索引，已补建 %d 条，失败 %d 条，耗时 %s",
+				device.Id, stats.Indexed+stats.Failed, stats.Indexed, stats.Failed, time.Since(started).Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 图像帧队列满时的处理策略；其他消息使用单独的队列，不受策略影响
+const (
+	OverflowBlock      = "block"       // 阻塞MQTT回调，直到队列有空位或等待超时
+	OverflowDropOldest = "drop-oldest" // 丢弃队列中最早的消息，为新消息腾出位置
+	OverflowDropNewest = "drop-newest" // 直接丢弃新到的消息
+)
+
+// IngestConfig 对应 config.yaml 中的 ingest 配置段
+type IngestConfig struct {
+	Workers   int    `json:"workers"`   // 工作协程数量
+	QueueSize int    `json:"queueSize"` // 每个工作协程的队列长度
+	Overflow  string `json:"overflow"`  // 图像帧队列满时的处理策略：block/drop-oldest/drop-newest
+	// block 策略下最多等待的秒数，超时后丢弃新消息；0 表示一直等待，只用于不连接服务器的回放
+	BlockTimeout int `json:"blockTimeout"`
+
+	Validation    ValidationConfig `json:"validation"`    // 图像校验规则
+	QuarantineDir string           `json:"quarantineDir"` // 未通过校验的负载存放目录
+}
+
+// IngestStats 接收管道的计数器
+type IngestStats struct {
+	Workers         int               `json:"workers"`
+	QueueSize       int               `json:"queueSize"`
+	Overflow        string            `json:"overflow"`
+	Received        uint64            `json:"received"`        // 进入管道的消息数
+	Processed       uint64            `json:"processed"`       // 已处理完成的消息数
+	DroppedOldest   uint64            `json:"droppedOldest"`   // 因 drop-oldest 被丢弃的消息数
+	DroppedNewest   uint64            `json:"droppedNewest"`   // 因 drop-newest 被丢弃的消息数
+	Blocked         uint64            `json:"blocked"`         // 因 block 策略等待过的消息数
+	DroppedBlocked  uint64            `json:"droppedBlocked"`  // block 策略下等待超时被丢弃的消息数
+	ControlBlocked  uint64            `json:"controlBlocked"`  // 非图像消息因队列满等待过的次数
+	QueueDepth      []int             `json:"queueDepth"`      // 每个工作协程当前的图像帧队列长度
+	ControlDepth    []int             `json:"controlDepth"`    // 每个工作协程当前的非图像消息队列长度
+	DroppedByDevice map[string]uint64 `json:"droppedByDevice"` // 按设备统计的丢弃数
+	RecorderDropped uint64            `json:"recorderDropped"` // 开启消息录制时，因录制队列满未录制的消息数
+}
+
+func defaultIngestConfig() IngestConfig {
+	return IngestConfig{
+		Workers:      4,
+		QueueSize:    64,
+		Overflow:     OverflowDropOldest,
+		BlockTimeout: 5,
+
+		Validation:    defaultValidationConfig(),
+		QuarantineDir: "quarantine",
+	}
+}
+
+// 读取接收管道配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadIngestConfig(ctx context.Context) (*IngestConfig, error) {
+	cfg := defaultIngestConfig()
+
+	v, err := g.Cfg().Get(ctx, "ingest")
+	if err != nil {
+		return nil, fmt.Errorf("读取ingest配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析ingest配置失败: %v", err)
+		}
+	}
+
+	if err := envInt("INGEST_WORKERS", &cfg.Workers); err != nil {
+		return nil, err
+	}
+	if err := envInt("INGEST_QUEUE_SIZE", &cfg.QueueSize); err != nil {
+		return nil, err
+	}
+	envString("INGEST_OVERFLOW", &cfg.Overflow)
+	if err := envInt("INGEST_BLOCK_TIMEOUT", &cfg.BlockTimeout); err != nil {
+		return nil, err
+	}
+	envString("INGEST_QUARANTINE_DIR", &cfg.QuarantineDir)
+
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("ingest.workers 必须大于0，当前为 %d", cfg.Workers)
+	}
+	if cfg.QueueSize <= 0 {
+		return nil, fmt.Errorf("ingest.queueSize 必须大于0，当前为 %d", cfg.QueueSize)
+	}
+	switch cfg.Overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return nil, fmt.Errorf("ingest.overflow 必须为 block、drop-oldest 或 drop-newest，当前为 '%s'", cfg.Overflow)
+	}
+	if cfg.BlockTimeout < 0 {
+		return nil, fmt.Errorf("ingest.blockTimeout 不能为负数，当前为 %d", cfg.BlockTimeout)
+	}
+	if err := cfg.Validation.validate(); err != nil {
+		return nil, err
+	}
+	if cfg.QuarantineDir == "" {
+		return nil, fmt.Errorf("ingest.quarantineDir 不能为空")
+	}
+	return &cfg, nil
+}
+
+// 管道中的一条待处理消息
+type ingestTask struct {
+	msg   *inboundMessage
+	match *TopicMatch
+}
+
+// 接收管道：按设备ID哈希到固定的工作协程，保证同一设备同一类队列中的消息按到达顺序处理。
+// 图像帧与状态、命令确认、影子上报、遥测等其他消息分开排队：前者数据量大，队列满时按溢出策略丢弃；
+// 后者丢失会让设备一直显示在线或命令误判为超时，且数据量小，队列满时等待而不丢弃
+type ingestPipeline struct {
+	cfg     *IngestConfig
+	queues  []chan *ingestTask // 图像帧
+	control []chan *ingestTask // 其他消息
+	handle  func(*inboundMessage, *TopicMatch)
+	wg      sync.WaitGroup
+
+	received       uint64
+	processed      uint64
+	droppedOldest  uint64
+	droppedNewest  uint64
+	blocked        uint64
+	droppedBlocked uint64
+	controlBlocked uint64
+
+	mu              sync.Mutex
+	droppedByDevice map[string]uint64
+}
+
+func newIngestPipeline(cfg *IngestConfig, handle func(*inboundMessage, *TopicMatch)) *ingestPipeline {
+	p := &ingestPipeline{
+		cfg:             cfg,
+		queues:          make([]chan *ingestTask, cfg.Workers),
+		control:         make([]chan *ingestTask, cfg.Workers),
+		handle:          handle,
+		droppedByDevice: make(map[string]uint64),
+	}
+	for i := range p.queues {
+		p.queues[i] = make(chan *ingestTask, cfg.QueueSize)
+		p.wg.Add(1)
+		go p.worker(p.queues[i])
+		p.control[i] = make(chan *ingestTask, cfg.QueueSize)
+		p.wg.Add(1)
+		go p.worker(p.control[i])
+	}
+	log.Printf("接收管道已启动，工作协程: %d，队列长度: %d，溢出策略: %s", cfg.Workers, cfg.QueueSize, cfg.Overflow)
+	return p
+}
+
+func (p *ingestPipeline) worker(queue chan *ingestTask) {
+	defer p.wg.Done()
+	for task := range queue {
+		p.handle(task.msg, task.match)
+		atomic.AddUint64(&p.processed, 1)
+	}
+}
+
+// 提交消息：图像帧在队列满时按配置的策略处理，其他消息等待空位
+func (p *ingestPipeline) Submit(msg *inboundMessage, match *TopicMatch) {
+	atomic.AddUint64(&p.received, 1)
+	task := &ingestTask{msg: msg, match: match}
+	i := p.index(match.DeviceId)
+	if match.Kind != KindImage {
+		select {
+		case p.control[i] <- task:
+		default:
+			atomic.AddUint64(&p.controlBlocked, 1)
+			p.control[i] <- task
+		}
+		return
+	}
+	queue := p.queues[i]
+
+	select {
+	case queue <- task:
+		return
+	default:
+	}
+
+	switch p.cfg.Overflow {
+	case OverflowDropNewest:
+		atomic.AddUint64(&p.droppedNewest, 1)
+		p.countDrop(match.DeviceId)
+		log.Printf("接收队列已满，丢弃新消息: 设备 %s, 主题 %s", match.DeviceId, msg.Topic)
+	case OverflowDropOldest:
+		for {
+			select {
+			case queue <- task:
+				return
+			default:
+			}
+			select {
+			case old := <-queue:
+				atomic.AddUint64(&p.droppedOldest, 1)
+				p.countDrop(old.match.DeviceId)
+				log.Printf("接收队列已满，丢弃最早的消息: 设备 %s, 主题 %s", old.match.DeviceId, old.msg.Topic)
+			default:
+			}
+		}
+	default:
+		atomic.AddUint64(&p.blocked, 1)
+		if p.cfg.BlockTimeout == 0 {
+			queue <- task
+			return
+		}
+		timer := time.NewTimer(time.Duration(p.cfg.BlockTimeout) * time.Second)
+		defer timer.Stop()
+		select {
+		case queue <- task:
+		case <-timer.C:
+			atomic.AddUint64(&p.droppedBlocked, 1)
+			p.countDrop(match.DeviceId)
+			log.Printf("接收队列已满且等待 %d 秒超时，丢弃新消息: 设备 %s, 主题 %s", p.cfg.BlockTimeout, match.DeviceId, msg.Topic)
+		}
+	}
+}
+
+// 关闭管道并等待队列中的消息处理完成
+func (p *ingestPipeline) Close() {
+	for i := range p.queues {
+		close(p.queues[i])
+		close(p.control[i])
+	}
+	p.wg.Wait()
+}
+
+func (p *ingestPipeline) Stats() IngestStats {
+	stats := IngestStats{
+		Workers:        p.cfg.Workers,
+		QueueSize:      p.cfg.QueueSize,
+		Overflow:       p.cfg.Overflow,
+		Received:       atomic.LoadUint64(&p.received),
+		Processed:      atomic.LoadUint64(&p.processed),
+		DroppedOldest:  atomic.LoadUint64(&p.droppedOldest),
+		DroppedNewest:  atomic.LoadUint64(&p.droppedNewest),
+		Blocked:        atomic.LoadUint64(&p.blocked),
+		DroppedBlocked: atomic.LoadUint64(&p.droppedBlocked),
+		ControlBlocked: atomic.LoadUint64(&p.controlBlocked),
+		QueueDepth:     make([]int, len(p.queues)),
+		ControlDepth:   make([]int, len(p.control)),
+	}
+	for i := range p.queues {
+		stats.QueueDepth[i] = len(p.queues[i])
+		stats.ControlDepth[i] = len(p.control[i])
+	}
+	p.mu.Lock()
+	stats.DroppedByDevice = make(map[string]uint64, len(p.droppedByDevice))
+	for id, n := range p.droppedByDevice {
+		stats.DroppedByDevice[id] = n
+	}
+	p.mu.Unlock()
+	return stats
+}
+
+func (p *ingestPipeline) index(deviceId string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(deviceId))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
+
+func (p *ingestPipeline) countDrop(deviceId string) {
+	p.mu.Lock()
+	p.droppedByDevice[deviceId]++
+	p.mu.Unlock()
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 测试用的接收管道：只有一个工作协程，处理函数在 gate 关闭前阻塞，便于把队列填满
+type testPipeline struct {
+	*ingestPipeline
+	started chan string
+	gate    chan struct{}
+	release sync.Once
+
+	mu      sync.Mutex
+	handled []string
+}
+
+func newTestPipeline(overflow string, blockTimeout int, queueSize int) *testPipeline {
+	tp := &testPipeline{started: make(chan string, 64), gate: make(chan struct{})}
+	cfg := &IngestConfig{Workers: 1, QueueSize: queueSize, Overflow: overflow, BlockTimeout: blockTimeout}
+	tp.ingestPipeline = newIngestPipeline(cfg, func(msg *inboundMessage, match *TopicMatch) {
+		tp.started <- msg.Topic
+		<-tp.gate
+		tp.mu.Lock()
+		tp.handled = append(tp.handled, msg.Topic)
+		tp.mu.Unlock()
+	})
+	return tp
+}
+
+func (tp *testPipeline) submit(topic string) {
+	tp.submitKind(topic, KindImage)
+}
+
+func (tp *testPipeline) submitKind(topic string, kind string) {
+	tp.Submit(&inboundMessage{Topic: topic}, &TopicMatch{DeviceId: "cam01", Kind: kind})
+}
+
+// 提交消息并等待工作协程取走，之后提交的同类消息留在队列中
+func (tp *testPipeline) hold(t *testing.T, topic string) {
+	t.Helper()
+	tp.holdKind(t, topic, KindImage)
+}
+
+func (tp *testPipeline) holdKind(t *testing.T, topic string, kind string) {
+	t.Helper()
+	tp.submitKind(topic, kind)
+	select {
+	case <-tp.started:
+	case <-time.After(time.Second):
+		t.Fatal("工作协程没有开始处理消息")
+	}
+}
+
+// 放行被阻塞的处理函数
+func (tp *testPipeline) open() {
+	tp.release.Do(func() { close(tp.gate) })
+}
+
+// 放行全部消息并关闭管道，返回按处理顺序排列的主题
+func (tp *testPipeline) finish() []string {
+	tp.open()
+	tp.Close()
+	tp.mu.Lock()
+	defer tp.mu.Unlock()
+	return tp.handled
+}
+
+func TestIngestOverflow(t *testing.T) {
+	tests := []struct {
+		name         string
+		overflow     string
+		blockTimeout int
+		handled      []string
+		stats        IngestStats
+	}{
+		{"drop-newest", OverflowDropNewest, 0, []string{"m1", "m2", "m3"}, IngestStats{DroppedNewest: 1}},
+		{"drop-oldest", OverflowDropOldest, 0, []string{"m1", "m3", "m4"}, IngestStats{DroppedOldest: 1}},
+		{"block 一直等待", OverflowBlock, 0, []string{"m1", "m2", "m3", "m4"}, IngestStats{Blocked: 1}},
+		{"block 等待超时", OverflowBlock, 1, []string{"m1", "m2", "m3"}, IngestStats{Blocked: 1, DroppedBlocked: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tp := newTestPipeline(tt.overflow, tt.blockTimeout, 2)
+			tp.hold(t, "m1")
+			tp.submit("m2")
+			tp.submit("m3")
+
+			done := make(chan struct{})
+			go func() {
+				tp.submit("m4")
+				close(done)
+			}()
+			if tt.overflow == OverflowBlock {
+				select {
+				case <-done:
+					t.Fatal("队列已满时 block 策略应当等待")
+				case <-time.After(50 * time.Millisecond):
+				}
+				if tt.blockTimeout == 0 {
+					tp.open()
+				}
+			}
+			select {
+			case <-done:
+			case <-time.After(time.Duration(tt.blockTimeout+1) * time.Second):
+				t.Fatal("提交消息没有返回")
+			}
+
+			handled := tp.finish()
+			if !reflect.DeepEqual(handled, tt.handled) {
+				t.Errorf("处理的消息为 %v，应为 %v", handled, tt.handled)
+			}
+			stats := tp.Stats()
+			if stats.Received != 4 || stats.Processed != uint64(len(tt.handled)) {
+				t.Errorf("收到 %d 条、处理 %d 条，应为 4 条、%d 条", stats.Received, stats.Processed, len(tt.handled))
+			}
+			if stats.DroppedNewest != tt.stats.DroppedNewest || stats.DroppedOldest != tt.stats.DroppedOldest || stats.Blocked != tt.stats.Blocked || stats.DroppedBlocked != tt.stats.DroppedBlocked {
+				t.Errorf("统计为 %+v，应为 %+v", stats, tt.stats)
+			}
+			if dropped := uint64(4 - len(tt.handled)); stats.DroppedByDevice["cam01"] != dropped {
+				t.Errorf("设备 cam01 的丢弃数为 %d，应为 %d", stats.DroppedByDevice["cam01"], dropped)
+			}
+		})
+	}
+}
+
+func TestIngestControlNeverDropped(t *testing.T) {
+	for _, overflow := range []string{OverflowDropNewest, OverflowDropOldest} {
+		t.Run(overflow, func(t *testing.T) {
+			tp := newTestPipeline(overflow, 0, 1)
+			tp.hold(t, "m1")
+			tp.submit("m2")
+			// 图像帧队列已满，状态消息仍然进入自己的队列
+			tp.holdKind(t, "s1", KindStatus)
+			tp.submit("m3")
+			tp.submitKind("s2", KindCommandAck)
+
+			done := make(chan struct{})
+			go func() {
+				tp.submitKind("s3", KindStatus)
+				close(done)
+			}()
+			select {
+			case <-done:
+				t.Fatal("非图像消息的队列已满时应当等待")
+			case <-time.After(50 * time.Millisecond):
+			}
+			tp.open()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("提交消息没有返回")
+			}
+
+			var control []string
+			for _, topic := range tp.finish() {
+				if topic[0] == 's' {
+					control = append(control, topic)
+				}
+			}
+			if want := []string{"s1", "s2", "s3"}; !reflect.DeepEqual(control, want) {
+				t.Errorf("处理的非图像消息为 %v，应为 %v", control, want)
+			}
+			stats := tp.Stats()
+			if stats.ControlBlocked != 1 {
+				t.Errorf("ControlBlocked 为 %d，应为 1", stats.ControlBlocked)
+			}
+			if stats.DroppedByDevice["cam01"] != 1 || stats.Processed != 5 {
+				t.Errorf("丢弃 %d 条、处理 %d 条，应为 1 条图像帧、5 条", stats.DroppedByDevice["cam01"], stats.Processed)
+			}
+		})
+	}
+}
@@ -4,20 +4,61 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 	"video-platform/internal/model"
-
-	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"video-platform/internal/storage"
 )
 
+// 收到的MQTT消息，屏蔽 3.1.1 与 v5 客户端的差异
+type inboundMessage struct {
+	Topic          string
+	Payload        []byte
+	Qos            byte
+	Retained       bool
+	Duplicate      bool
+	MessageId      uint16
+	ContentType    string            // 仅 v5
+	MessageExpiry  *uint32           // 仅 v5，单位秒
+	UserProperties map[string]string // 仅 v5
+	ReceivedAt     time.Time
+}
+
+// MQTT客户端，分别由 paho.mqtt.golang（3.1.1）和 paho.golang（v5）实现
+type mqttClient interface {
+	// 发布消息，返回报文ID；QoS 0 没有报文ID，v5 客户端内部分配报文ID且不对外提供，此时返回 nil
+	Publish(topic string, qos byte, retained bool, payload []byte) (*uint16, error)
+	Disconnect()
+}
+
 type MQTTService struct {
-	client     mqtt.Client
-	imageDir   string        // 图像存储目录
-	deviceData sync.Map      // 存储设备数据
+	client       mqttClient
+	cfg          *MQTTConfig      // mqtt 配置
+	ingestCfg    *IngestConfig    // 接收管道配置
+	commandCfg   *CommandConfig   // 命令下发配置
+	shadowCfg    *ShadowConfig    // 设备影子配置
+	presenceCfg  *PresenceConfig  // 在线状态配置
+	publishCfg   *PublishConfig   // 手动发布配置
+	recorderCfg  *RecorderConfig  // 消息录制配置
+	recorder     *recorder        // 消息录制，未开启时为 nil
+	presence     *presenceMonitor // 设备状态监控
+	pipeline     *ingestPipeline  // 接收管道
+	quarantine   *Quarantine      // 隔离区
+	router       *topicRouter     // 主题映射规则
+	storageCfg   *storage.Config  // 图像存储配置
+	storage      storage.Storage  // 图像存储
+	retentionCfg *RetentionConfig // 保留策略配置
+	thumbnailCfg *ThumbnailConfig // 缩略图配置
+	thumbnails   *thumbnailer     // 缩略图生成
+	renderCfg    *RenderConfig    // 图像渲染配置
+	renderer     *renderer        // 图像渲染
+	exportCfg    *ExportConfig    // 图像导出配置
+	timelapseCfg *TimelapseConfig // 延时视频配置
+	timelapse    *Timelapse       // 延时视频任务
+	deviceData   sync.Map         // 存储设备数据
 }
 
 var (
@@ -25,87 +66,246 @@ var (
 	once        sync.Once
 )
 
-// 获取MQTT服务实例
-func GetMQTTService() *MQTTService {
+// 初始化MQTT服务，配置非法时返回错误
+func InitMQTTService(ctx context.Context) error {
+	svc, err := loadMQTTService(ctx)
+	if err != nil {
+		return err
+	}
+	var initErr error
 	once.Do(func() {
-		mqttService = &MQTTService{}
-		mqttService.init()
+		mqttService = svc
+		initErr = mqttService.init()
 	})
+	return initErr
+}
+
+// 读取MQTT服务用到的全部配置
+func loadMQTTService(ctx context.Context) (*MQTTService, error) {
+	cfg, err := LoadMQTTConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ingestCfg, err := LoadIngestConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 等待期间MQTT客户端无法处理心跳应答，超过 keepAlive 会被服务器断开
+	if ingestCfg.Overflow == OverflowBlock && (ingestCfg.BlockTimeout == 0 || ingestCfg.BlockTimeout >= cfg.KeepAlive) {
+		return nil, fmt.Errorf("ingest.blockTimeout 必须在 1 到 mqtt.keepAlive（%d）之间，当前为 %d", cfg.KeepAlive, ingestCfg.BlockTimeout)
+	}
+	commandCfg, err := LoadCommandConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shadowCfg, err := LoadShadowConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	presenceCfg, err := LoadPresenceConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	publishCfg, err := LoadPublishConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recorderCfg, err := LoadRecorderConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	storageCfg, err := LoadStorageConfig(ctx, cfg.ImageDir)
+	if err != nil {
+		return nil, err
+	}
+	retentionCfg, err := LoadRetentionConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	thumbnailCfg, err := LoadThumbnailConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	renderCfg, err := LoadRenderConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exportCfg, err := LoadExportConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	timelapseCfg, err := LoadTimelapseConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &MQTTService{
+		cfg:          cfg,
+		ingestCfg:    ingestCfg,
+		commandCfg:   commandCfg,
+		shadowCfg:    shadowCfg,
+		presenceCfg:  presenceCfg,
+		publishCfg:   publishCfg,
+		recorderCfg:  recorderCfg,
+		storageCfg:   storageCfg,
+		retentionCfg: retentionCfg,
+		thumbnailCfg: thumbnailCfg,
+		renderCfg:    renderCfg,
+		renderer:     newRenderer(renderCfg),
+		exportCfg:    exportCfg,
+		timelapseCfg: timelapseCfg,
+	}, nil
+}
+
+// 获取MQTT服务实例
+func GetMQTTService() *MQTTService {
 	return mqttService
 }
 
 // 初始化MQTT客户端
-func (s *MQTTService) init() {
-	// 创建图像存储目录
-	s.imageDir = "images"
-	if err := os.MkdirAll(s.imageDir, 0755); err != nil {
-		log.Printf("创建图像存储目录失败: %v", err)
-	}
-	
-	opts := mqtt.NewClientOptions()
-	opts.AddBroker("tcp://112.6.224.25:20042")
-	opts.SetClientID(fmt.Sprintf("server_%d", time.Now().Unix()))
-	opts.SetDefaultPublishHandler(s.messageHandler)
-	opts.SetOnConnectHandler(s.onConnect)
-	opts.SetConnectionLostHandler(s.onConnectionLost)
-	
-	// 添加更多连接选项
-	opts.SetAutoReconnect(true)
-	opts.SetMaxReconnectInterval(time.Second * 10)
-	opts.SetKeepAlive(time.Second * 60)
-	opts.SetCleanSession(true)
-	opts.SetOrderMatters(false) // 不要求消息顺序
-	
-	// 设置详细的调试日志
-	mqtt.DEBUG = log.New(log.Writer(), "MQTT DEBUG: ", log.Ltime|log.Lshortfile)
-	mqtt.ERROR = log.New(log.Writer(), "MQTT ERROR: ", log.Ltime|log.Lshortfile)
-
-	s.client = mqtt.NewClient(opts)
-	if token := s.client.Connect(); token.Wait() && token.Error() != nil {
-		log.Printf("MQTT连接失败: %v", token.Error())
-		return
+func (s *MQTTService) init() error {
+	if err := s.setup(); err != nil {
+		return err
 	}
-}
+	if s.recorderCfg.Enabled {
+		recorder, err := newRecorder(s.recorderCfg)
+		if err != nil {
+			return err
+		}
+		s.recorder = recorder
+		log.Printf("已开启消息录制，目录: %s", s.recorderCfg.Dir)
+	}
+
+	if s.cfg.UseTLS() && s.cfg.TLS.InsecureSkipVerify {
+		log.Printf("警告: 已关闭MQTT服务器证书校验")
+	}
+	if s.cfg.Session.Persistent {
+		log.Printf("使用持久会话，客户端ID: %s，存储目录: %s", s.cfg.Session.ClientId, s.cfg.Session.StoreDir)
+	}
+	log.Printf("MQTT服务器: %s, 协议版本: %d, 订阅主题: %v, QoS: %d",
+		s.cfg.Broker, s.cfg.ProtocolVersion, s.cfg.Subscriptions(), s.cfg.Qos)
 
-// 连接成功回调
-func (s *MQTTService) onConnect(client mqtt.Client) {
-	log.Println("MQTT已连接")
-	// 订阅所有设备的图像主题
-	if token := client.Subscribe("device/+/image", 1, s.messageHandler); token.Wait() && token.Error() != nil {
-		log.Printf("订阅主题失败: %v", token.Error())
+	var err error
+	if s.cfg.ProtocolVersion == 5 {
+		s.client, err = newClientV5(s.cfg, s.messageHandler)
 	} else {
-		log.Printf("成功订阅主题: device/+/image")
+		s.client, err = newClientV3(s.cfg, s.messageHandler)
 	}
+	if err != nil {
+		return err
+	}
+
+	go s.presence.run()
+	go s.backfillImageIndex()
+	go s.sweepCommands()
+	if s.retentionCfg.Enabled {
+		log.Printf("已开启图像定期清理，间隔: %d秒", s.retentionCfg.Interval)
+		go newJanitor(s.retentionCfg, s.storage, s.thumbnailCfg.Sizes).run()
+	}
+	s.timelapse.start()
+	return nil
 }
 
-// 连接断开回调
-func (s *MQTTService) onConnectionLost(client mqtt.Client, err error) {
-	log.Printf("MQTT连接断开: %v", err)
+// 创建存储目录、主题路由和接收管道，不连接MQTT服务器
+func (s *MQTTService) setup() error {
+	// 打开图像存储
+	st, err := OpenStorage(context.Background(), s.storageCfg)
+	if err != nil {
+		return fmt.Errorf("打开图像存储失败: %v", err)
+	}
+	s.storage = st
+	s.thumbnails = newThumbnailer(s.thumbnailCfg, st)
+	model.Device.SetStorage(st)
+
+	router, err := newTopicRouter(s.cfg.TopicRules)
+	if err != nil {
+		return err
+	}
+	s.router = router
+	s.quarantine, err = newQuarantine(s.ingestCfg.QuarantineDir)
+	if err != nil {
+		return err
+	}
+	s.timelapse, err = newTimelapse(s.timelapseCfg, st)
+	if err != nil {
+		return err
+	}
+	s.pipeline = newIngestPipeline(s.ingestCfg, s.process)
+	s.presence = newPresenceMonitor(s.presenceCfg)
+	return nil
 }
 
 // 消息处理
-func (s *MQTTService) messageHandler(client mqtt.Client, msg mqtt.Message) {
+func (s *MQTTService) messageHandler(msg *inboundMessage) {
+	// 录制只入队，由录制器的写入协程写文件
+	if s.recorder != nil {
+		s.recorder.Record(msg)
+	}
+
 	// 详细的消息日志
 	log.Printf("收到MQTT消息:")
-	log.Printf("- 主题: '%s'", msg.Topic())
-	log.Printf("- 主题字节: %v", []byte(msg.Topic()))
-	log.Printf("- QoS: %d", msg.Qos())
-	log.Printf("- 重复消息: %v", msg.Duplicate())
-	log.Printf("- 消息ID: %d", msg.MessageID())
-	log.Printf("- 数据长度: %d字节", len(msg.Payload()))
-	
-	// 从主题中提取设备ID
-	topic := strings.TrimSpace(msg.Topic())
-	parts := strings.Split(topic, "/")
-	log.Printf("- 主题分割: %v", parts)
-	
-	if len(parts) != 3 || parts[0] != "device" || parts[2] != "image" {
-		log.Printf("无效的主题格式: '%s'", msg.Topic())
+	log.Printf("- 主题: '%s'", msg.Topic)
+	log.Printf("- 主题字节: %v", []byte(msg.Topic))
+	log.Printf("- QoS: %d", msg.Qos)
+	log.Printf("- 重复消息: %v", msg.Duplicate)
+	log.Printf("- 消息ID: %d", msg.MessageId)
+	log.Printf("- 数据长度: %d字节", len(msg.Payload))
+	if msg.ContentType != "" || len(msg.UserProperties) > 0 {
+		log.Printf("- 内容类型: %s, 用户属性: %v", msg.ContentType, msg.UserProperties)
+	}
+
+	// 按主题规则提取设备ID和消息类型
+	topic := strings.TrimSpace(msg.Topic)
+	match, ok := s.router.Match(topic)
+	if !ok {
+		log.Printf("无效的主题格式: '%s'", msg.Topic)
 		return
 	}
-	deviceId := parts[1]
-	log.Printf("- 设备ID: %s", deviceId)
-	
+	deviceId := match.DeviceId
+	log.Printf("- 命中规则: %s", match.Pattern)
+	log.Printf("- 设备ID: %s, 消息类型: %s, 占位符: %v", deviceId, match.Kind, match.Vars)
+
+	// 交给接收管道异步处理，不在MQTT回调中访问数据库和磁盘
+	s.pipeline.Submit(msg, match)
+}
+
+// 在接收管道的工作协程中处理消息
+func (s *MQTTService) process(msg *inboundMessage, match *TopicMatch) {
+	switch match.Kind {
+	case KindImage:
+		s.handleImage(msg, match)
+	case KindCommandAck:
+		s.handleCommandAck(msg, match)
+	case KindShadowReported:
+		s.handleShadowReported(msg, match)
+	case KindStatus:
+		s.handleStatus(msg, match)
+	case KindTelemetry:
+		s.handleTelemetry(msg, match)
+	}
+}
+
+// 处理图像帧
+func (s *MQTTService) handleImage(msg *inboundMessage, match *TopicMatch) {
+	deviceId := match.DeviceId
+	meta := buildFrameMeta(msg, match)
+
+	// 解析信封格式，裸 JPEG 原样通过
+	env, err := parseEnvelope(msg.Payload)
+	if err != nil {
+		s.reject(msg, deviceId, fmt.Sprintf("图像信封无效: %v", err))
+		return
+	}
+	applyEnvelope(meta, env)
+	payload := env.Image
+
+	// 校验图像，未通过的负载放入隔离区
+	width, height, err := validateJPEG(payload, &s.ingestCfg.Validation)
+	if err != nil {
+		s.reject(msg, deviceId, err.Error())
+		return
+	}
+	meta.Width, meta.Height = width, height
+
 	// 检查设备是否存在，如果不存在则添加
 	device, err := model.Device.Get(context.Background(), deviceId)
 	if err != nil || device == nil {
@@ -113,51 +313,95 @@ func (s *MQTTService) messageHandler(client mqtt.Client, msg mqtt.Message) {
 		newDevice := &model.DeviceModel{
 			Id:         deviceId,
 			Name:       fmt.Sprintf("Device-%s", deviceId),
-			Status:     "online",
+			Status:     model.DeviceOffline,
 			LastActive: time.Now(),
 		}
 		if err := model.Device.Add(context.Background(), newDevice); err != nil {
 			log.Printf("添加新设备失败: %v", err)
 		} else {
 			log.Printf("成功添加新设备: %s", deviceId)
+			s.presence.Notify()
 		}
 	} else {
-		// 更新设备状态为在线
-		if err := model.Device.UpdateStatus(context.Background(), deviceId, "online"); err != nil {
-			log.Printf("更新设备状态失败: %v", err)
-		} else {
-			log.Printf("设备 %s 状态已更新为在线", deviceId)
+		// 刷新最后活跃时间，设备状态由状态监控更新
+		if err := model.Device.Touch(context.Background(), deviceId); err == nil {
+			log.Printf("设备 %s 最后活跃时间已更新", deviceId)
+			if device.Status != model.DeviceOnline {
+				s.presence.Notify()
+			}
 		}
 	}
-	
-	// 创建设备专属的图像存储目录
-	deviceDir := filepath.Join(s.imageDir, deviceId)
-	if err := os.MkdirAll(deviceDir, 0755); err != nil {
-		log.Printf("创建设备图像目录失败: %v", err)
-		return
-	}
-	
-	// 生成图像文件名（使用时间戳）
-	timestamp := time.Now().Format("20060102_150405")
-	filename := filepath.Join(deviceDir, fmt.Sprintf("%s.jpg", timestamp))
-	
-	// 保存图像到文件
-	if err := os.WriteFile(filename, msg.Payload(), 0644); err != nil {
+
+	// 保存图像到存储，文件名使用毫秒级时间加序号，同一毫秒内的多帧不会互相覆盖
+	filename, err := model.CreateFrame(context.Background(), s.storage, deviceId, meta.FrameTime(), payload)
+	if err != nil {
 		log.Printf("保存图像文件失败: %v", err)
 		return
 	}
-	
+
+	// 保存设备上报的元数据
+	if meta.HasDeviceInfo() {
+		if err := model.WriteFrameMeta(context.Background(), s.storage, filename, meta); err != nil {
+			log.Printf("保存图像元数据失败: %v", err)
+		}
+	}
+
+	// 生成缩略图，失败时在首次请求缩略图时再生成
+	if s.thumbnailCfg.Enabled {
+		if err := s.thumbnails.generate(context.Background(), filename, payload); err != nil {
+			log.Printf("生成缩略图失败: %v", err)
+		}
+	}
+
+	// 写入图像索引，最新图像和历史图像接口通过索引查询
+	frameTime := meta.FrameTime()
+	if t, _, _, ok := model.ParseFrameName(path.Base(filename)); ok {
+		frameTime = t
+	}
+	if err := model.Image.Save(context.Background(), newImageRecord(deviceId, filename, payload, frameTime, meta)); err != nil {
+		log.Printf("保存图像索引失败: %v", err)
+	}
+
 	// 更新设备最新图像的文件路径
 	s.deviceData.Store(deviceId, filename)
 	log.Printf("设备 %s 的图像已保存到文件: %s", deviceId, filename)
 }
 
+// 将未通过校验的消息放入隔离区
+func (s *MQTTService) reject(msg *inboundMessage, deviceId string, reason string) {
+	entry, err := s.quarantine.Put(msg, deviceId, reason)
+	if err != nil {
+		log.Printf("设备 %s 的消息被拒绝（%s），且放入隔离区失败: %v", deviceId, reason, err)
+		return
+	}
+	log.Printf("设备 %s 的消息被拒绝并放入隔离区: %s，原因: %s", deviceId, entry.Id, reason)
+}
+
+// 获取隔离区
+func (s *MQTTService) Quarantine() *Quarantine {
+	return s.quarantine
+}
+
+// 获取延时视频任务队列
+func (s *MQTTService) Timelapse() *Timelapse {
+	return s.timelapse
+}
+
+// 获取接收管道统计
+func (s *MQTTService) IngestStats() IngestStats {
+	stats := s.pipeline.Stats()
+	if s.recorder != nil {
+		stats.RecorderDropped = s.recorder.Dropped()
+	}
+	return stats
+}
+
 // 获取设备最新图像
 func (s *MQTTService) GetDeviceImage(deviceId string) []byte {
 	// 从内存中获取最新图像的文件路径
 	if filename, ok := s.deviceData.Load(deviceId); ok {
 		// 读取图像文件
-		if data, err := os.ReadFile(filename.(string)); err == nil {
+		if data, err := s.storage.Get(context.Background(), filename.(string)); err == nil {
 			return data
 		} else {
 			log.Printf("读取图像文件失败: %v", err)
@@ -166,13 +410,69 @@ func (s *MQTTService) GetDeviceImage(deviceId string) []byte {
 	return nil
 }
 
-// 测试发布消息
-func (s *MQTTService) TestPublish(deviceId string, data []byte) error {
-	topic := fmt.Sprintf("device/%s/image", deviceId)
-	token := s.client.Publish(topic, 1, false, data)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("发布消息失败: %v", token.Error())
+// 根据消息属性和主题占位符生成帧元数据
+func buildFrameMeta(msg *inboundMessage, match *TopicMatch) *model.FrameMeta {
+	meta := &model.FrameMeta{
+		DeviceId:      match.DeviceId,
+		Topic:         msg.Topic,
+		ReceivedAt:    msg.ReceivedAt,
+		Channel:       match.Vars["channel"],
+		ContentType:   msg.ContentType,
+		MessageExpiry: msg.MessageExpiry,
 	}
-	log.Printf("测试消息已发布到主题: %s", topic)
-	return nil
-} 
\ No newline at end of file
+	if len(msg.UserProperties) == 0 {
+		return meta
+	}
+	meta.Properties = msg.UserProperties
+	if v, ok := msg.UserProperties["capturedAt"]; ok {
+		if t, err := parseDeviceTime(v); err == nil {
+			meta.CapturedAt = &t
+		} else {
+			log.Printf("无法解析用户属性 capturedAt='%s': %v", v, err)
+		}
+	}
+	if v, ok := msg.UserProperties["seq"]; ok {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			meta.Seq = &n
+		} else {
+			log.Printf("无法解析用户属性 seq='%s': %v", v, err)
+		}
+	}
+	if v, ok := msg.UserProperties["resolution"]; ok {
+		meta.Resolution = v
+	}
+	if v, ok := msg.UserProperties["channel"]; ok && meta.Channel == "" {
+		meta.Channel = v
+	}
+	return meta
+}
+
+// 信封头部中的字段优先于 MQTT 属性
+func applyEnvelope(meta *model.FrameMeta, env *envelope) {
+	if env.CapturedAt != nil {
+		meta.CapturedAt = env.CapturedAt
+	}
+	if env.Header.Seq != nil {
+		meta.Seq = env.Header.Seq
+	}
+	if env.Header.Resolution != "" {
+		meta.Resolution = env.Header.Resolution
+	}
+	if env.Header.Firmware != "" {
+		meta.Firmware = env.Header.Firmware
+	}
+	if env.Header.Channel != "" {
+		meta.Channel = env.Header.Channel
+	}
+}
+
+// 解析设备上报的时间：RFC3339 字符串，或 Unix 秒/毫秒时间戳
+func parseDeviceTime(v string) (time.Time, error) {
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Parse(time.RFC3339Nano, v)
+}
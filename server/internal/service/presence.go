@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// PresenceConfig 对应 config.yaml 中的 presence 配置段
+type PresenceConfig struct {
+	DefaultTimeout int `json:"defaultTimeout"` // 超过该秒数没有图像即判定降级或离线，可按设备单独配置
+	CheckInterval  int `json:"checkInterval"`  // 状态监控的检查间隔（秒）
+}
+
+func defaultPresenceConfig() PresenceConfig {
+	return PresenceConfig{
+		DefaultTimeout: 60,
+		CheckInterval:  5,
+	}
+}
+
+// 读取在线状态配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadPresenceConfig(ctx context.Context) (*PresenceConfig, error) {
+	cfg := defaultPresenceConfig()
+
+	v, err := g.Cfg().Get(ctx, "presence")
+	if err != nil {
+		return nil, fmt.Errorf("读取presence配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析presence配置失败: %v", err)
+		}
+	}
+
+	if err := envInt("PRESENCE_DEFAULT_TIMEOUT", &cfg.DefaultTimeout); err != nil {
+		return nil, err
+	}
+
+	if cfg.DefaultTimeout <= 0 {
+		return nil, fmt.Errorf("presence.defaultTimeout 必须大于0，当前为 %d", cfg.DefaultTimeout)
+	}
+	if cfg.CheckInterval <= 0 {
+		return nil, fmt.Errorf("presence.checkInterval 必须大于0，当前为 %d", cfg.CheckInterval)
+	}
+	return &cfg, nil
+}
+
+// 解析状态消息，负载为 online/offline，也兼容 {"status":"online"}
+func parseStatusPayload(payload []byte) (string, error) {
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		var doc struct {
+			Status string `json:"status"`
+		}
+		if err := json.Unmarshal(payload, &doc); err != nil {
+			return "", err
+		}
+		text = doc.Status
+	}
+	switch status := strings.ToLower(strings.TrimSpace(text)); status {
+	case model.DeviceOnline, model.DeviceOffline:
+		return status, nil
+	default:
+		return "", fmt.Errorf("未知的状态 '%s'", text)
+	}
+}
+
+// 处理设备状态消息：设备上线时发布保留消息 online，异常断开时由服务器发布遗嘱消息 offline；只更新已有设备
+func (s *MQTTService) handleStatus(msg *inboundMessage, match *TopicMatch) {
+	deviceId := match.DeviceId
+	if len(msg.Payload) == 0 {
+		// 空负载用于清除保留消息，不代表状态变化
+		return
+	}
+	status, err := parseStatusPayload(msg.Payload)
+	if err != nil {
+		log.Printf("设备 %s 的状态消息格式错误: %v", deviceId, err)
+		return
+	}
+
+	ctx := context.Background()
+	device, err := model.Device.Get(ctx, deviceId)
+	if err != nil {
+		log.Printf("获取设备信息失败: %v", err)
+		return
+	}
+	if device == nil {
+		// 不根据状态消息添加设备：服务器上的保留消息和遗嘱消息会让已删除的设备重新出现，设备在上传图像时添加
+		log.Printf("忽略未知设备 %s 的状态消息: %s（保留消息: %v）", deviceId, status, msg.Retained)
+		return
+	}
+	if err := model.Device.ReportStatus(ctx, deviceId, status); err != nil {
+		log.Printf("更新设备 %s 状态失败: %v", deviceId, err)
+		return
+	}
+	log.Printf("设备 %s 上报状态: %s（保留消息: %v）", deviceId, status, msg.Retained)
+	s.presence.Notify()
+}
+
+// 设备状态监控：定期检查所有设备，是唯一修改设备状态的地方，状态变化写入 device_status_history
+//
+// 通过状态主题上报的设备：上报 offline 为离线；上报 online 且按时上传图像为在线，否则为降级。
+// 未上报状态的设备：超时时间内有图像为在线，超过超时为降级，超过两倍超时为离线。
+type presenceMonitor struct {
+	cfg    *PresenceConfig
+	notify chan struct{}
+}
+
+func newPresenceMonitor(cfg *PresenceConfig) *presenceMonitor {
+	return &presenceMonitor{cfg: cfg, notify: make(chan struct{}, 1)}
+}
+
+// 请求尽快检查一次，不等待下一个周期
+func (m *presenceMonitor) Notify() {
+	select {
+	case m.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (m *presenceMonitor) run() {
+	ticker := time.NewTicker(time.Duration(m.cfg.CheckInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-m.notify:
+		}
+		m.checkAll()
+	}
+}
+
+func (m *presenceMonitor) checkAll() {
+	ctx := context.Background()
+	devices, err := model.Device.All(ctx)
+	if err != nil {
+		log.Printf("状态监控获取设备列表失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for i := range devices {
+		device := &devices[i]
+		status, reason := m.evaluate(device, now)
+		from := device.Status
+		if from == "" {
+			from = model.DeviceOffline
+		}
+		if status == from {
+			continue
+		}
+		if err := model.Device.SetStatus(ctx, device.Id, status); err != nil {
+			log.Printf("更新设备 %s 状态失败: %v", device.Id, err)
+			continue
+		}
+		record := &model.StatusHistoryModel{
+			DeviceId:   device.Id,
+			FromStatus: from,
+			ToStatus:   status,
+			Reason:     reason,
+			ChangedAt:  now,
+		}
+		if err := model.StatusHistory.Add(ctx, record); err != nil {
+			log.Printf("记录设备 %s 状态变化失败: %v", device.Id, err)
+		}
+		log.Printf("设备 %s 状态变化: %s -> %s，原因: %s", device.Id, from, status, reason)
+	}
+}
+
+// 根据上报状态和最后一帧图像的时间判断设备状态
+func (m *presenceMonitor) evaluate(device *model.DeviceModel, now time.Time) (string, string) {
+	timeout := time.Duration(m.cfg.DefaultTimeout) * time.Second
+	if device.OfflineTimeout > 0 {
+		timeout = time.Duration(device.OfflineTimeout) * time.Second
+	}
+	fresh := !device.LastActive.IsZero() && now.Sub(device.LastActive) <= timeout
+
+	if device.PresenceSource == model.PresenceStatus {
+		switch {
+		case device.ReportedStatus != model.DeviceOnline:
+			return model.DeviceOffline, "设备上报离线"
+		case fresh:
+			return model.DeviceOnline, "设备在线且按时上传图像"
+		default:
+			return model.DeviceDegraded, fmt.Sprintf("设备在线但超过%.0f秒没有图像", timeout.Seconds())
+		}
+	}
+	switch {
+	case fresh:
+		return model.DeviceOnline, fmt.Sprintf("%.0f秒内收到图像", timeout.Seconds())
+	case !device.LastActive.IsZero() && now.Sub(device.LastActive) <= 2*timeout:
+		return model.DeviceDegraded, fmt.Sprintf("超过%.0f秒没有图像", timeout.Seconds())
+	default:
+		return model.DeviceOffline, fmt.Sprintf("超过%.0f秒没有图像", (2 * timeout).Seconds())
+	}
+}
+
+// StatusReport 设备在时间窗口内的状态统计
+type StatusReport struct {
+	DeviceId    string                     `json:"deviceId"`
+	Status      string                     `json:"status"`    // 当前状态
+	StartTime   time.Time                  `json:"startTime"` // 实际统计的起止时间
+	EndTime     time.Time                  `json:"endTime"`
+	Uptime      float64                    `json:"uptime"`    // 在线时间占比（%），降级不计入
+	Durations   map[string]float64         `json:"durations"` // 各状态的累计时长（秒）
+	Transitions []model.StatusHistoryModel `json:"transitions"`
+}
+
+// 统计设备在时间窗口内的状态变化和在线率，窗口不超过设备的创建时间和当前时间
+func DeviceStatusReport(ctx context.Context, device *model.DeviceModel, start time.Time, end time.Time) (*StatusReport, error) {
+	if now := time.Now(); end.After(now) {
+		end = now
+	}
+	if start.Before(device.CreatedAt) {
+		start = device.CreatedAt
+	}
+	report := &StatusReport{
+		DeviceId:    device.Id,
+		Status:      device.Status,
+		StartTime:   start,
+		EndTime:     end,
+		Durations:   make(map[string]float64),
+		Transitions: make([]model.StatusHistoryModel, 0),
+	}
+	if !start.Before(end) {
+		return report, nil
+	}
+
+	transitions, err := model.StatusHistory.List(ctx, device.Id, start, end)
+	if err != nil {
+		return nil, err
+	}
+	report.Transitions = transitions
+
+	// 窗口开始时的状态：之前最后一次变化后的状态，没有时取窗口内第一次变化前的状态
+	state := device.Status
+	prev, err := model.StatusHistory.LastBefore(ctx, device.Id, start)
+	if err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		state = prev.ToStatus
+	} else if len(transitions) > 0 {
+		state = transitions[0].FromStatus
+	}
+
+	cursor := start
+	for _, t := range transitions {
+		report.Durations[state] += t.ChangedAt.Sub(cursor).Seconds()
+		state = t.ToStatus
+		cursor = t.ChangedAt
+	}
+	report.Durations[state] += end.Sub(cursor).Seconds()
+
+	total := end.Sub(start).Seconds()
+	report.Uptime = math.Round(report.Durations[model.DeviceOnline]/total*10000) / 100
+	return report, nil
+}
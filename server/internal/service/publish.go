@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// AdminConfig 对应 config.yaml 中的 admin 配置段
+type AdminConfig struct {
+	Token string `json:"token"` // 管理接口令牌，为空时管理接口不可用
+}
+
+// PublishConfig 对应 config.yaml 中的 publish 配置段
+type PublishConfig struct {
+	AllowedTopics   []string `json:"allowedTopics"`   // 允许手动发布的主题过滤器，可使用 + 和 #，为空时不允许发布
+	MaxPayloadBytes int      `json:"maxPayloadBytes"` // 单条消息的最大字节数
+}
+
+// 管理员令牌的最小长度
+const minAdminTokenLength = 16
+
+// 读取管理配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadAdminConfig(ctx context.Context) (*AdminConfig, error) {
+	var cfg AdminConfig
+
+	v, err := g.Cfg().Get(ctx, "admin")
+	if err != nil {
+		return nil, fmt.Errorf("读取admin配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析admin配置失败: %v", err)
+		}
+	}
+
+	envString("ADMIN_TOKEN", &cfg.Token)
+
+	cfg.Token = strings.TrimSpace(cfg.Token)
+	if cfg.Token != "" && len(cfg.Token) < minAdminTokenLength {
+		return nil, fmt.Errorf("admin.token 长度不能少于 %d 个字符", minAdminTokenLength)
+	}
+	return &cfg, nil
+}
+
+func defaultPublishConfig() PublishConfig {
+	return PublishConfig{
+		MaxPayloadBytes: 1 << 20,
+	}
+}
+
+// 读取手动发布配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadPublishConfig(ctx context.Context) (*PublishConfig, error) {
+	cfg := defaultPublishConfig()
+
+	v, err := g.Cfg().Get(ctx, "publish")
+	if err != nil {
+		return nil, fmt.Errorf("读取publish配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析publish配置失败: %v", err)
+		}
+	}
+
+	if v, ok := os.LookupEnv("PUBLISH_ALLOWED_TOPICS"); ok {
+		cfg.AllowedTopics = splitList(v)
+	}
+
+	for _, filter := range cfg.AllowedTopics {
+		if err := validateTopicFilter(filter); err != nil {
+			return nil, fmt.Errorf("publish.allowedTopics 中的主题 '%s' 非法: %v", filter, err)
+		}
+	}
+	if cfg.MaxPayloadBytes <= 0 {
+		return nil, fmt.Errorf("publish.maxPayloadBytes 必须大于0，当前为 %d", cfg.MaxPayloadBytes)
+	}
+	return &cfg, nil
+}
+
+// PublishRequest 一次手动发布
+type PublishRequest struct {
+	Topic      string
+	Qos        byte
+	Retain     bool
+	Payload    []byte
+	RemoteAddr string // 请求来源，写入发布记录
+	UserAgent  string
+}
+
+// 校验手动发布的主题：不能包含通配符，且必须匹配允许的主题过滤器
+func (c *PublishConfig) checkTopic(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("主题为空")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("发布主题不能包含通配符")
+	}
+	if strings.HasPrefix(topic, "$") {
+		return fmt.Errorf("不能发布到系统主题")
+	}
+	for _, filter := range c.AllowedTopics {
+		if topicMatchesFilter(filter, topic) {
+			return nil
+		}
+	}
+	return fmt.Errorf("主题 '%s' 不在允许发布的范围内", topic)
+}
+
+// 手动发布消息，每次请求都写入发布记录：未通过校验的记录拒绝原因；
+// 通过校验的先写入记录再发布，记录写入失败时不发布
+func (s *MQTTService) Publish(ctx context.Context, req *PublishRequest) (*model.PublishAuditModel, error) {
+	if err := s.checkPublish(req); err != nil {
+		return s.RejectPublish(ctx, req, err), err
+	}
+
+	record := newPublishRecord(req)
+	// 发布过程中服务退出时，记录保持为未完成
+	record.Error = "发布未完成"
+	if err := model.PublishAudit.Add(ctx, record); err != nil {
+		return nil, fmt.Errorf("保存发布记录失败，未发布: %v", err)
+	}
+	messageId, publishErr := s.client.Publish(req.Topic, req.Qos, req.Retain, req.Payload)
+	if publishErr != nil {
+		record.Error = publishErr.Error()
+	} else {
+		record.Success, record.Error = true, ""
+		if messageId != nil {
+			id := int(*messageId)
+			record.MessageId = &id
+		}
+	}
+	if err := model.PublishAudit.Finish(ctx, record); err != nil {
+		log.Printf("更新发布记录 %d 失败: %v", record.Id, err)
+	}
+	log.Printf("手动发布消息，主题: %s，QoS: %d，保留: %v，大小: %d字节，来源: %s，成功: %v",
+		req.Topic, req.Qos, req.Retain, len(req.Payload), req.RemoteAddr, record.Success)
+	if publishErr != nil {
+		return record, fmt.Errorf("发布消息失败: %v", publishErr)
+	}
+	return record, nil
+}
+
+// 记录被拒绝的发布请求，例如未通过校验或消息内容无法解码
+func (s *MQTTService) RejectPublish(ctx context.Context, req *PublishRequest, reason error) *model.PublishAuditModel {
+	record := newPublishRecord(req)
+	record.Error = "已拒绝: " + reason.Error()
+	if err := model.PublishAudit.Add(ctx, record); err != nil {
+		log.Printf("保存发布记录失败: %v", err)
+	}
+	log.Printf("拒绝手动发布消息，主题: %s，来源: %s，原因: %v", req.Topic, req.RemoteAddr, reason)
+	return record
+}
+
+func newPublishRecord(req *PublishRequest) *model.PublishAuditModel {
+	sum := sha256.Sum256(req.Payload)
+	return &model.PublishAuditModel{
+		Topic:         req.Topic,
+		Qos:           int(req.Qos),
+		Retained:      req.Retain,
+		PayloadSize:   len(req.Payload),
+		PayloadSha256: hex.EncodeToString(sum[:]),
+		RemoteAddr:    req.RemoteAddr,
+		UserAgent:     req.UserAgent,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// 校验手动发布的主题、QoS 和消息大小
+func (s *MQTTService) checkPublish(req *PublishRequest) error {
+	if err := s.publishCfg.checkTopic(req.Topic); err != nil {
+		return err
+	}
+	if req.Qos > 2 {
+		return fmt.Errorf("QoS 必须为 0、1 或 2")
+	}
+	if len(req.Payload) > s.publishCfg.MaxPayloadBytes {
+		return fmt.Errorf("消息大小 %d 字节超过上限 %d 字节", len(req.Payload), s.publishCfg.MaxPayloadBytes)
+	}
+	return nil
+}
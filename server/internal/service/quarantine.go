@@ -0,0 +1,170 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QuarantineEntry 隔离区中的一条记录，与原始负载一起保存
+type QuarantineEntry struct {
+	Id            string    `json:"id"`
+	DeviceId      string    `json:"deviceId"`
+	Topic         string    `json:"topic"`
+	Reason        string    `json:"reason"` // 被拒绝的原因
+	Size          int       `json:"size"`   // 原始负载字节数
+	Qos           byte      `json:"qos"`
+	ReceivedAt    time.Time `json:"receivedAt"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// 隔离记录ID：时间戳加随机后缀，API中只接受该格式，防止路径穿越
+var quarantineIdPattern = regexp.MustCompile(`^\d{8}_\d{6}\.\d{3}_[0-9a-f]{8}$`)
+
+// Quarantine 隔离区，保存未通过校验的负载，每条记录对应 {id}.bin 和 {id}.json 两个文件
+type Quarantine struct {
+	dir string
+}
+
+func newQuarantine(dir string) (*Quarantine, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建隔离目录失败: %v", err)
+	}
+	return &Quarantine{dir: dir}, nil
+}
+
+// 将负载放入隔离区
+func (q *Quarantine) Put(msg *inboundMessage, deviceId string, reason string) (*QuarantineEntry, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry := &QuarantineEntry{
+		Id:            now.Format("20060102_150405.000") + "_" + hex.EncodeToString(suffix),
+		DeviceId:      deviceId,
+		Topic:         msg.Topic,
+		Reason:        reason,
+		Size:          len(msg.Payload),
+		Qos:           msg.Qos,
+		ReceivedAt:    msg.ReceivedAt,
+		QuarantinedAt: now,
+	}
+	if err := os.WriteFile(q.payloadPath(entry.Id), msg.Payload, 0644); err != nil {
+		return nil, fmt.Errorf("保存隔离负载失败: %v", err)
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(q.entryPath(entry.Id), data, 0644); err != nil {
+		_ = os.Remove(q.payloadPath(entry.Id))
+		return nil, fmt.Errorf("保存隔离记录失败: %v", err)
+	}
+	return entry, nil
+}
+
+// 列出隔离记录，deviceId 为空时返回全部，按隔离时间倒序
+func (q *Quarantine) List(deviceId string) ([]QuarantineEntry, error) {
+	files, err := filepath.Glob(filepath.Join(q.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]QuarantineEntry, 0, len(files))
+	for _, file := range files {
+		entry, err := q.readEntry(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			log.Printf("读取隔离记录失败: %s, %v", file, err)
+			continue
+		}
+		if deviceId != "" && entry.DeviceId != deviceId {
+			continue
+		}
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QuarantinedAt.After(entries[j].QuarantinedAt)
+	})
+	return entries, nil
+}
+
+// 获取隔离记录及原始负载
+func (q *Quarantine) Get(id string) (*QuarantineEntry, []byte, error) {
+	if !quarantineIdPattern.MatchString(id) {
+		return nil, nil, fmt.Errorf("无效的隔离记录ID: '%s'", id)
+	}
+	entry, err := q.readEntry(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	payload, err := os.ReadFile(q.payloadPath(id))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取隔离负载失败: %v", err)
+	}
+	return entry, payload, nil
+}
+
+// 删除隔离记录
+func (q *Quarantine) Delete(id string) error {
+	if !quarantineIdPattern.MatchString(id) {
+		return fmt.Errorf("无效的隔离记录ID: '%s'", id)
+	}
+	if _, err := os.Stat(q.entryPath(id)); err != nil {
+		return fmt.Errorf("隔离记录不存在: %s", id)
+	}
+	if err := os.Remove(q.payloadPath(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(q.entryPath(id))
+}
+
+// 清理隔离记录：deviceId 为空时不限设备，before 为零值时不限时间，返回删除的条数
+func (q *Quarantine) Purge(deviceId string, before time.Time) (int, error) {
+	entries, err := q.List(deviceId)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !before.IsZero() && !entry.QuarantinedAt.Before(before) {
+			continue
+		}
+		if err := q.Delete(entry.Id); err != nil {
+			log.Printf("删除隔离记录失败: %s, %v", entry.Id, err)
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+func (q *Quarantine) readEntry(id string) (*QuarantineEntry, error) {
+	data, err := os.ReadFile(q.entryPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("隔离记录不存在: %s", id)
+		}
+		return nil, err
+	}
+	var entry QuarantineEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (q *Quarantine) entryPath(id string) string {
+	return filepath.Join(q.dir, id+".json")
+}
+
+func (q *Quarantine) payloadPath(id string) string {
+	return filepath.Join(q.dir, id+".bin")
+}
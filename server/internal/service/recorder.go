@@ -0,0 +1,310 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// RecorderConfig 对应 config.yaml 中的 recorder 配置段
+type RecorderConfig struct {
+	Enabled      bool     `json:"enabled"`      // 是否录制收到的MQTT消息
+	Dir          string   `json:"dir"`          // 录制文件目录
+	MaxFileBytes int64    `json:"maxFileBytes"` // 单个文件的最大字节数，超过后切换到新文件
+	MaxFiles     int      `json:"maxFiles"`     // 最多保留的文件数，为0时不限制
+	QueueSize    int      `json:"queueSize"`    // 等待写入的消息数上限，写入跟不上时丢弃新消息
+	Topics       []string `json:"topics"`       // 只录制匹配的主题，可使用 + 和 #，为空时录制全部
+}
+
+// 录制文件名：capture_<创建时间>.jsonl，按文件名排序即为时间顺序
+const (
+	captureFilePrefix = "capture_"
+	captureFileSuffix = ".jsonl"
+)
+
+func defaultRecorderConfig() RecorderConfig {
+	return RecorderConfig{
+		Dir:          "captures",
+		MaxFileBytes: 100 << 20,
+		MaxFiles:     20,
+		QueueSize:    1024,
+	}
+}
+
+// 读取录制配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadRecorderConfig(ctx context.Context) (*RecorderConfig, error) {
+	cfg := defaultRecorderConfig()
+
+	v, err := g.Cfg().Get(ctx, "recorder")
+	if err != nil {
+		return nil, fmt.Errorf("读取recorder配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析recorder配置失败: %v", err)
+		}
+	}
+
+	if err := envBool("RECORDER_ENABLED", &cfg.Enabled); err != nil {
+		return nil, err
+	}
+	envString("RECORDER_DIR", &cfg.Dir)
+
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("recorder.dir 不能为空")
+	}
+	if cfg.MaxFileBytes <= 0 {
+		return nil, fmt.Errorf("recorder.maxFileBytes 必须大于0，当前为 %d", cfg.MaxFileBytes)
+	}
+	if cfg.MaxFiles < 0 {
+		return nil, fmt.Errorf("recorder.maxFiles 不能为负数，当前为 %d", cfg.MaxFiles)
+	}
+	if cfg.QueueSize <= 0 {
+		return nil, fmt.Errorf("recorder.queueSize 必须大于0，当前为 %d", cfg.QueueSize)
+	}
+	for _, filter := range cfg.Topics {
+		if err := validateTopicFilter(filter); err != nil {
+			return nil, fmt.Errorf("recorder.topics 中的主题 '%s' 非法: %v", filter, err)
+		}
+	}
+	return &cfg, nil
+}
+
+// 录制文件中的一行
+type captureRecord struct {
+	Topic          string            `json:"topic"`
+	Qos            byte              `json:"qos"`
+	Retained       bool              `json:"retained,omitempty"`
+	Duplicate      bool              `json:"duplicate,omitempty"`
+	MessageId      uint16            `json:"messageId,omitempty"`
+	ContentType    string            `json:"contentType,omitempty"`
+	MessageExpiry  *uint32           `json:"messageExpiry,omitempty"`
+	UserProperties map[string]string `json:"userProperties,omitempty"`
+	ReceivedAt     time.Time         `json:"receivedAt"`
+	Payload        []byte            `json:"payload"` // Base64编码
+}
+
+func newCaptureRecord(msg *inboundMessage) *captureRecord {
+	return &captureRecord{
+		Topic:          msg.Topic,
+		Qos:            msg.Qos,
+		Retained:       msg.Retained,
+		Duplicate:      msg.Duplicate,
+		MessageId:      msg.MessageId,
+		ContentType:    msg.ContentType,
+		MessageExpiry:  msg.MessageExpiry,
+		UserProperties: msg.UserProperties,
+		ReceivedAt:     msg.ReceivedAt,
+		Payload:        msg.Payload,
+	}
+}
+
+func (r *captureRecord) message() *inboundMessage {
+	return &inboundMessage{
+		Topic:          r.Topic,
+		Payload:        r.Payload,
+		Qos:            r.Qos,
+		Retained:       r.Retained,
+		Duplicate:      r.Duplicate,
+		MessageId:      r.MessageId,
+		ContentType:    r.ContentType,
+		MessageExpiry:  r.MessageExpiry,
+		UserProperties: r.UserProperties,
+		ReceivedAt:     r.ReceivedAt,
+	}
+}
+
+// 录制器：MQTT回调只把消息放入队列，由写入协程追加到录制文件，
+// 文件超过大小上限时切换到新文件并清理最旧的文件；队列满时丢弃新消息，不阻塞接收
+type recorder struct {
+	cfg     *RecorderConfig
+	queue   chan *inboundMessage
+	done    chan struct{}
+	file    *os.File
+	size    int64
+	dropped uint64
+}
+
+func newRecorder(cfg *RecorderConfig) (*recorder, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %v", err)
+	}
+	r := &recorder{
+		cfg:   cfg,
+		queue: make(chan *inboundMessage, cfg.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// 录制一条消息：只做主题过滤和入队，队列满时丢弃并计数
+func (r *recorder) Record(msg *inboundMessage) {
+	if len(r.cfg.Topics) > 0 {
+		matched := false
+		for _, filter := range r.cfg.Topics {
+			if topicMatchesFilter(filter, msg.Topic) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+	}
+	select {
+	case r.queue <- msg:
+	default:
+		// 只在第1条和之后每1000条时打印日志，避免磁盘卡顿时日志刷屏
+		if n := atomic.AddUint64(&r.dropped, 1); n%1000 == 1 {
+			log.Printf("录制队列已满，丢弃消息: 主题 %s，累计丢弃 %d 条", msg.Topic, n)
+		}
+	}
+}
+
+// 丢弃的消息数
+func (r *recorder) Dropped() uint64 {
+	return atomic.LoadUint64(&r.dropped)
+}
+
+// 写入协程：序列化并写入文件，失败时只记录日志
+func (r *recorder) run() {
+	defer close(r.done)
+	for msg := range r.queue {
+		r.write(msg)
+	}
+	if r.file != nil {
+		_ = r.file.Close()
+		r.file = nil
+	}
+}
+
+func (r *recorder) write(msg *inboundMessage) {
+	line, err := json.Marshal(newCaptureRecord(msg))
+	if err != nil {
+		log.Printf("序列化录制消息失败: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	if r.file == nil || (r.size > 0 && r.size+int64(len(line)) > r.cfg.MaxFileBytes) {
+		if err := r.rotate(); err != nil {
+			log.Printf("切换录制文件失败: %v", err)
+			return
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		log.Printf("写入录制文件失败: %v", err)
+	}
+}
+
+// 关闭当前文件，创建新文件，并删除超出数量的旧文件
+func (r *recorder) rotate() error {
+	if r.file != nil {
+		if err := r.file.Close(); err != nil {
+			log.Printf("关闭录制文件失败: %v", err)
+		}
+		r.file = nil
+	}
+	name := captureFilePrefix + time.Now().Format("20060102_150405.000") + captureFileSuffix
+	file, err := os.OpenFile(filepath.Join(r.cfg.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.size = 0
+	if info, err := file.Stat(); err == nil {
+		r.size = info.Size()
+	}
+	log.Printf("开始写入录制文件: %s", file.Name())
+
+	if r.cfg.MaxFiles > 0 {
+		files, err := ListCaptureFiles(r.cfg.Dir)
+		if err != nil {
+			log.Printf("列出录制文件失败: %v", err)
+			return nil
+		}
+		for len(files) > r.cfg.MaxFiles {
+			if err := os.Remove(files[0]); err != nil {
+				log.Printf("删除旧录制文件失败: %v", err)
+			} else {
+				log.Printf("已删除旧录制文件: %s", files[0])
+			}
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+// 停止接收新消息，等待队列中的消息写入完成后关闭文件
+func (r *recorder) Close() {
+	close(r.queue)
+	<-r.done
+}
+
+// 列出录制文件：path 为文件时直接返回，为目录时返回其中的录制文件，按时间顺序排列
+func ListCaptureFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, captureFilePrefix) && strings.HasSuffix(name, captureFileSuffix) {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// 逐行读取录制文件，对每条消息调用 fn，fn 返回错误时停止
+func readCaptureFile(path string, fn func(msg *inboundMessage) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record captureRecord
+			if jerr := json.Unmarshal(line, &record); jerr != nil {
+				// 录制过程中进程退出可能留下不完整的最后一行
+				log.Printf("跳过 %s 第%d行: %v", path, lineNo, jerr)
+			} else if ferr := fn(record.message()); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestRecorderQueue(t *testing.T) {
+	cfg := &RecorderConfig{Dir: t.TempDir(), MaxFileBytes: 1 << 20, QueueSize: 2, Topics: []string{"device/+/image"}}
+	// 先不启动写入协程，让队列保持满的状态
+	r := &recorder{cfg: cfg, queue: make(chan *inboundMessage, cfg.QueueSize), done: make(chan struct{})}
+	for _, topic := range []string{"device/cam01/image", "device/cam01/status", "device/cam02/image", "device/cam03/image", "device/cam04/image"} {
+		r.Record(&inboundMessage{Topic: topic, Payload: []byte(topic)})
+	}
+	if r.Dropped() != 2 {
+		t.Errorf("丢弃 %d 条，应为 2 条", r.Dropped())
+	}
+
+	go r.run()
+	r.Close()
+	files, err := ListCaptureFiles(cfg.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var topics []string
+	for _, file := range files {
+		if err := readCaptureFile(file, func(msg *inboundMessage) error {
+			topics = append(topics, msg.Topic)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(topics) != 2 || topics[0] != "device/cam01/image" || topics[1] != "device/cam02/image" {
+		t.Errorf("录制的主题为 %v，应为 [device/cam01/image device/cam02/image]", topics)
+	}
+}
@@ -0,0 +1,322 @@
+package service
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/image/draw"
+)
+
+// RenderConfig 对应 config.yaml 中的 render 配置段
+type RenderConfig struct {
+	MaxWidth       int   `json:"maxWidth"`       // 输出的最大宽度（像素）
+	MaxHeight      int   `json:"maxHeight"`      // 输出的最大高度（像素）
+	DefaultQuality int   `json:"defaultQuality"` // 未指定时的 JPEG 质量
+	CacheBytes     int64 `json:"cacheBytes"`     // 渲染结果缓存的最大字节数，0 表示不缓存
+}
+
+func defaultRenderConfig() RenderConfig {
+	return RenderConfig{
+		MaxWidth:       3840,
+		MaxHeight:      2160,
+		DefaultQuality: 85,
+		CacheBytes:     64 << 20,
+	}
+}
+
+// 读取渲染配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadRenderConfig(ctx context.Context) (*RenderConfig, error) {
+	cfg := defaultRenderConfig()
+
+	v, err := g.Cfg().Get(ctx, "render")
+	if err != nil {
+		return nil, fmt.Errorf("读取render配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析render配置失败: %v", err)
+		}
+	}
+
+	if err := envInt("RENDER_MAX_WIDTH", &cfg.MaxWidth); err != nil {
+		return nil, err
+	}
+	if err := envInt("RENDER_MAX_HEIGHT", &cfg.MaxHeight); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxWidth <= 0 || cfg.MaxHeight <= 0 {
+		return nil, fmt.Errorf("render.maxWidth 和 render.maxHeight 必须大于0")
+	}
+	if cfg.DefaultQuality < 1 || cfg.DefaultQuality > 100 {
+		return nil, fmt.Errorf("render.defaultQuality 必须在 1-100 之间，当前为 %d", cfg.DefaultQuality)
+	}
+	if cfg.CacheBytes < 0 {
+		return nil, fmt.Errorf("render.cacheBytes 不能为负数")
+	}
+	return &cfg, nil
+}
+
+// 缩放方式
+const (
+	FitContain = "contain" // 等比缩放到宽高范围内，输出可能小于指定的宽高
+	FitCover   = "cover"   // 等比缩放到覆盖宽高，居中裁掉多余部分
+	FitFill    = "fill"    // 拉伸到指定宽高，不保持比例
+)
+
+// 输出格式
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// RenderOptions 渲染参数，先裁剪再缩放
+type RenderOptions struct {
+	Width   int             // 输出宽度，为0时按比例计算
+	Height  int             // 输出高度，为0时按比例计算
+	Fit     string          // 同时指定宽高时的缩放方式，默认 contain
+	Crop    image.Rectangle // 原图中的裁剪区域，为空时不裁剪
+	Quality int             // JPEG 质量，为0时使用 render.defaultQuality
+	Format  string          // 输出格式，默认 jpeg
+}
+
+// 解析裁剪区域，格式为 x,y,宽,高，为空时不裁剪
+func ParseCrop(s string) (image.Rectangle, error) {
+	if s == "" {
+		return image.Rectangle{}, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("裁剪区域格式应为 x,y,宽,高: '%s'", s)
+	}
+	var v [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return image.Rectangle{}, fmt.Errorf("裁剪区域格式应为 x,y,宽,高: '%s'", s)
+		}
+		v[i] = n
+	}
+	if v[2] == 0 || v[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("裁剪区域的宽高必须大于0")
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// 补全默认值并校验，不依赖原图尺寸的限制在这里检查
+func (o *RenderOptions) normalize(cfg *RenderConfig) error {
+	if o.Width < 0 || o.Height < 0 {
+		return fmt.Errorf("宽高不能为负数")
+	}
+	if o.Width > cfg.MaxWidth || o.Height > cfg.MaxHeight {
+		return fmt.Errorf("输出尺寸不能超过 %dx%d", cfg.MaxWidth, cfg.MaxHeight)
+	}
+	switch o.Fit {
+	case "":
+		o.Fit = FitContain
+	case FitContain, FitCover, FitFill:
+	default:
+		return fmt.Errorf("不支持的缩放方式 '%s'，可用: contain、cover、fill", o.Fit)
+	}
+	switch strings.ToLower(o.Format) {
+	case "", "jpg", FormatJPEG:
+		o.Format = FormatJPEG
+	case FormatPNG:
+		o.Format = FormatPNG
+	default:
+		return fmt.Errorf("不支持的输出格式 '%s'，可用: jpeg、png", o.Format)
+	}
+	if o.Quality == 0 {
+		o.Quality = cfg.DefaultQuality
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return fmt.Errorf("质量必须在 1-100 之间")
+	}
+	if o.Format == FormatPNG {
+		// PNG 无损，质量不影响输出，统一后缓存可以共用
+		o.Quality = 0
+	}
+	return nil
+}
+
+// 缓存键，参数需先 normalize
+func (o *RenderOptions) cacheKey(frameKey string) string {
+	return fmt.Sprintf("%s|%dx%d|%s|%v|%s|%d", frameKey, o.Width, o.Height, o.Fit, o.Crop, o.Format, o.Quality)
+}
+
+// 输出格式对应的内容类型
+func (o *RenderOptions) ContentType() string {
+	if o.Format == FormatPNG {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// 渲染：按参数裁剪、缩放并编码，结果缓存在内存中
+type renderer struct {
+	cfg   *RenderConfig
+	cache *lruCache
+}
+
+func newRenderer(cfg *RenderConfig) *renderer {
+	return &renderer{cfg: cfg, cache: newLRUCache(cfg.CacheBytes)}
+}
+
+// 计算裁剪后的源区域和输出尺寸；cover 时源区域会再居中裁剪为输出的比例
+func (r *renderer) layout(bounds image.Rectangle, opts *RenderOptions) (image.Rectangle, int, int, error) {
+	src := bounds
+	if !opts.Crop.Empty() {
+		crop := opts.Crop.Add(bounds.Min)
+		if !crop.In(bounds) {
+			return src, 0, 0, fmt.Errorf("裁剪区域超出图像范围 %dx%d", bounds.Dx(), bounds.Dy())
+		}
+		src = crop
+	}
+	sw, sh := float64(src.Dx()), float64(src.Dy())
+	width, height := opts.Width, opts.Height
+	switch {
+	case width == 0 && height == 0:
+		width, height = src.Dx(), src.Dy()
+	case height == 0:
+		height = int(math.Round(sh * float64(width) / sw))
+	case width == 0:
+		width = int(math.Round(sw * float64(height) / sh))
+	case opts.Fit == FitContain:
+		scale := math.Min(float64(width)/sw, float64(height)/sh)
+		width, height = int(math.Round(sw*scale)), int(math.Round(sh*scale))
+	case opts.Fit == FitCover:
+		scale := math.Max(float64(width)/sw, float64(height)/sh)
+		cw, ch := int(math.Round(float64(width)/scale)), int(math.Round(float64(height)/scale))
+		x := src.Min.X + (src.Dx()-cw)/2
+		y := src.Min.Y + (src.Dy()-ch)/2
+		src = image.Rect(x, y, x+cw, y+ch).Intersect(src)
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+	if width > r.cfg.MaxWidth || height > r.cfg.MaxHeight {
+		return src, 0, 0, fmt.Errorf("输出尺寸 %dx%d 超过上限 %dx%d", width, height, r.cfg.MaxWidth, r.cfg.MaxHeight)
+	}
+	return src, width, height, nil
+}
+
+// 渲染原图数据
+func (r *renderer) render(data []byte, opts *RenderOptions) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图像失败: %v", err)
+	}
+	src, width, height, err := r.layout(img.Bounds(), opts)
+	if err != nil {
+		return nil, err
+	}
+	var dst image.Image = img
+	if src != img.Bounds() || width != src.Dx() || height != src.Dy() {
+		rgba := image.NewRGBA(image.Rect(0, 0, width, height))
+		if width == src.Dx() && height == src.Dy() {
+			draw.Copy(rgba, image.Point{}, img, src, draw.Src, nil)
+		} else {
+			draw.BiLinear.Scale(rgba, rgba.Bounds(), img, src, draw.Src, nil)
+		}
+		dst = rgba
+	}
+
+	var buf bytes.Buffer
+	if opts.Format == FormatPNG {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: opts.Quality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("编码图像失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// 按参数渲染帧，cached 表示结果来自缓存
+func (s *MQTTService) RenderImage(ctx context.Context, frameKey string, opts RenderOptions) (data []byte, contentType string, cached bool, err error) {
+	if err := opts.normalize(s.renderCfg); err != nil {
+		return nil, "", false, err
+	}
+	key := opts.cacheKey(frameKey)
+	if data, ok := s.renderer.cache.Get(key); ok {
+		return data, opts.ContentType(), true, nil
+	}
+	original, err := model.ReadFrame(ctx, s.storage, frameKey)
+	if err != nil {
+		return nil, "", false, fmt.Errorf("读取图像失败: %v", err)
+	}
+	if data, err = s.renderer.render(original, &opts); err != nil {
+		return nil, "", false, err
+	}
+	s.renderer.cache.Add(key, data)
+	return data, opts.ContentType(), false, nil
+}
+
+// 按字节数限制容量的 LRU 缓存，并发安全
+type lruCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	order    *list.List // 最近使用的在前
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value []byte
+}
+
+func newLRUCache(capacity int64) *lruCache {
+	return &lruCache{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+// 加入缓存，超出容量时淘汰最久未使用的项；比整个缓存还大的值不缓存
+func (c *lruCache) Add(key string, value []byte) {
+	n := int64(len(value))
+	if n > c.capacity {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.size += n - int64(len(e.Value.(*lruEntry).value))
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+	} else {
+		c.items[key] = c.order.PushFront(&lruEntry{key: key, value: value})
+		c.size += n
+	}
+	for c.size > c.capacity {
+		e := c.order.Back()
+		entry := e.Value.(*lruEntry)
+		c.order.Remove(e)
+		delete(c.items, entry.key)
+		c.size -= int64(len(entry.value))
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"image"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLRUCache(t *testing.T) {
+	// 操作序列："+key=n" 加入 n 字节，"?key" 读取
+	tests := []struct {
+		name     string
+		capacity int64
+		ops      []string
+		keys     []string // 剩余的键，最近使用的在前
+		size     int64
+	}{
+		{"未超出容量", 10, []string{"+a=3", "+b=3", "+c=4"}, []string{"c", "b", "a"}, 10},
+		{"淘汰最久未使用", 10, []string{"+a=4", "+b=4", "+c=4"}, []string{"c", "b"}, 8},
+		{"读取后不被淘汰", 10, []string{"+a=4", "+b=4", "?a", "+c=4"}, []string{"c", "a"}, 8},
+		{"一次淘汰多项", 10, []string{"+a=3", "+b=3", "+c=3", "+d=9"}, []string{"d"}, 9},
+		{"比容量大的值不缓存", 10, []string{"+a=3", "+b=11"}, []string{"a"}, 3},
+		{"等于容量的值可以缓存", 10, []string{"+a=3", "+b=10"}, []string{"b"}, 10},
+		{"覆盖时更新大小", 10, []string{"+a=3", "+b=3", "+a=6"}, []string{"a", "b"}, 9},
+		{"覆盖变大时淘汰其他项", 10, []string{"+a=3", "+b=3", "+a=8"}, []string{"a"}, 8},
+		{"读取不存在的键", 10, []string{"+a=3", "?b"}, []string{"a"}, 3},
+		{"容量为0", 0, []string{"+a=1", "+b=0"}, []string{"b"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newLRUCache(tt.capacity)
+			added := make(map[string][]byte)
+			for _, op := range tt.ops {
+				switch op[0] {
+				case '+':
+					key, size, _ := strings.Cut(op[1:], "=")
+					n, err := strconv.Atoi(size)
+					if err != nil {
+						t.Fatal(err)
+					}
+					value := []byte(strings.Repeat(key, n))
+					c.Add(key, value)
+					added[key] = value
+				case '?':
+					key := op[1:]
+					value, ok := c.Get(key)
+					if want, wantOk := added[key]; ok && (!wantOk || !reflect.DeepEqual(value, want)) {
+						t.Errorf("Get(%q) = %q，应为 %q", key, value, want)
+					}
+				}
+			}
+			var keys []string
+			for e := c.order.Front(); e != nil; e = e.Next() {
+				keys = append(keys, e.Value.(*lruEntry).key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("缓存中的键为 %v，应为 %v", keys, tt.keys)
+			}
+			if c.size != tt.size {
+				t.Errorf("缓存大小为 %d，应为 %d", c.size, tt.size)
+			}
+			if len(c.items) != len(tt.keys) {
+				t.Errorf("索引中有 %d 项，链表中有 %d 项", len(c.items), len(tt.keys))
+			}
+			for _, key := range tt.keys {
+				if value, ok := c.Get(key); !ok || !reflect.DeepEqual(value, added[key]) {
+					t.Errorf("Get(%q) = %q, %v，应为 %q", key, value, ok, added[key])
+				}
+			}
+		})
+	}
+}
+
+func TestParseCrop(t *testing.T) {
+	tests := []struct {
+		s    string
+		want image.Rectangle
+		ok   bool
+	}{
+		{"", image.Rectangle{}, true},
+		{"0,0,100,50", image.Rect(0, 0, 100, 50), true},
+		{"10, 20, 30, 40", image.Rect(10, 20, 40, 60), true},
+		{"10,20,30", image.Rectangle{}, false},
+		{"10,20,30,40,50", image.Rectangle{}, false},
+		{"-1,0,10,10", image.Rectangle{}, false},
+		{"0,0,0,10", image.Rectangle{}, false},
+		{"0,0,10,0", image.Rectangle{}, false},
+		{"a,0,10,10", image.Rectangle{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseCrop(tt.s)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseCrop(%q) = %v, %v，应为 %v，是否成功应为 %v", tt.s, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRendererLayout(t *testing.T) {
+	r := newRenderer(&RenderConfig{MaxWidth: 1000, MaxHeight: 800})
+	bounds := image.Rect(0, 0, 640, 480)
+	tests := []struct {
+		name          string
+		bounds        image.Rectangle
+		opts          RenderOptions
+		src           image.Rectangle
+		width, height int
+		ok            bool
+	}{
+		{"原尺寸", bounds, RenderOptions{Fit: FitContain}, bounds, 640, 480, true},
+		{"只指定宽度", bounds, RenderOptions{Width: 320, Fit: FitContain}, bounds, 320, 240, true},
+		{"只指定高度", bounds, RenderOptions{Height: 240, Fit: FitContain}, bounds, 320, 240, true},
+		{"contain 保持比例", bounds, RenderOptions{Width: 320, Height: 320, Fit: FitContain}, bounds, 320, 240, true},
+		{"fill 拉伸", bounds, RenderOptions{Width: 320, Height: 320, Fit: FitFill}, bounds, 320, 320, true},
+		{"cover 居中裁剪", bounds, RenderOptions{Width: 320, Height: 320, Fit: FitCover}, image.Rect(80, 0, 560, 480), 320, 320, true},
+		{"cover 纵向裁剪", bounds, RenderOptions{Width: 640, Height: 160, Fit: FitCover}, image.Rect(0, 160, 640, 320), 640, 160, true},
+		{"裁剪", bounds, RenderOptions{Crop: image.Rect(100, 50, 300, 150), Fit: FitContain}, image.Rect(100, 50, 300, 150), 200, 100, true},
+		{"裁剪后缩放", bounds, RenderOptions{Crop: image.Rect(100, 50, 300, 150), Width: 100, Fit: FitContain}, image.Rect(100, 50, 300, 150), 100, 50, true},
+		{"裁剪区域相对图像原点", image.Rect(10, 20, 650, 500), RenderOptions{Crop: image.Rect(0, 0, 100, 100), Fit: FitContain}, image.Rect(10, 20, 110, 120), 100, 100, true},
+		{"最小为1像素", image.Rect(0, 0, 640, 10), RenderOptions{Width: 1, Fit: FitContain}, image.Rect(0, 0, 640, 10), 1, 1, true},
+		{"等于上限", bounds, RenderOptions{Width: 1000, Fit: FitContain}, bounds, 1000, 750, true},
+
+		{name: "裁剪区域超出图像", bounds: bounds, opts: RenderOptions{Crop: image.Rect(600, 0, 700, 100), Fit: FitContain}},
+		{name: "指定宽度超过上限", bounds: bounds, opts: RenderOptions{Width: 1001, Fit: FitContain}},
+		{name: "按比例算出的宽度超过上限", bounds: bounds, opts: RenderOptions{Height: 800, Fit: FitContain}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			src, width, height, err := r.layout(tt.bounds, &opts)
+			if (err == nil) != tt.ok {
+				t.Fatalf("layout 返回 %v，是否成功应为 %v", err, tt.ok)
+			}
+			if !tt.ok {
+				return
+			}
+			if src != tt.src || width != tt.width || height != tt.height {
+				t.Errorf("layout = %v, %dx%d，应为 %v, %dx%d", src, width, height, tt.src, tt.width, tt.height)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ReplayOptions 回放参数
+type ReplayOptions struct {
+	Speed    float64       // 回放速度：1 为原始速度，大于1时加速，为0时不等待
+	KeepTime bool          // 使用录制时的接收时间，默认使用回放时的当前时间
+	Filter   string        // 只回放匹配的主题，可使用 + 和 #，为空时回放全部
+	MaxGap   time.Duration // 两条消息之间的最长等待时间，为0时不限制
+}
+
+// ReplayStats 回放结果
+type ReplayStats struct {
+	Files    int           `json:"files"`
+	Total    int           `json:"total"`    // 读取的消息数
+	Replayed int           `json:"replayed"` // 回放的消息数
+	Skipped  int           `json:"skipped"`  // 被主题过滤跳过的消息数
+	Failed   int           `json:"failed"`   // 发布失败的消息数
+	Elapsed  time.Duration `json:"elapsed"`
+}
+
+// Replayer 把录制文件中的消息重新送入接收管道或MQTT服务器
+type Replayer struct {
+	service *MQTTService // 送入接收管道时使用的离线服务
+	client  mqttClient   // 发布到MQTT服务器时使用的客户端
+	deliver func(*inboundMessage) error
+}
+
+// 离线客户端：回放到接收管道时不连接MQTT服务器，所有发布都失败
+type offlineClient struct{}
+
+func (offlineClient) Publish(topic string, qos byte, retained bool, payload []byte) (*uint16, error) {
+	return nil, fmt.Errorf("回放模式下不连接MQTT服务器")
+}
+
+func (offlineClient) Disconnect() {}
+
+// 创建回放到接收管道的回放器：消息按当前配置的主题规则分发，与在线接收的处理流程相同，
+// 但不连接MQTT服务器，也不录制、不启动后台任务
+func NewIngestReplayer(ctx context.Context) (*Replayer, error) {
+	s, err := loadMQTTService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 回放不连接服务器，没有心跳超时的问题；队列满时一直等待，不丢弃录制的消息
+	s.ingestCfg.Overflow, s.ingestCfg.BlockTimeout = OverflowBlock, 0
+	if err := s.setup(); err != nil {
+		return nil, err
+	}
+	s.client = offlineClient{}
+	r := &Replayer{service: s}
+	r.deliver = func(msg *inboundMessage) error {
+		s.messageHandler(msg)
+		return nil
+	}
+	return r, nil
+}
+
+// 创建发布到MQTT服务器的回放器：使用 mqtt 配置中的连接参数，broker 不为空时覆盖服务器地址，
+// 只发布不订阅，消息由服务器转发给正在运行的服务
+func NewPublishReplayer(ctx context.Context, broker string) (*Replayer, error) {
+	cfg, err := LoadMQTTConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	replayCfg := *cfg
+	if broker != "" {
+		replayCfg.Broker = broker
+	}
+	replayCfg.SubscribeTopics = nil
+	replayCfg.TopicRules = []TopicRule{}
+	replayCfg.Session = SessionConfig{}
+	replayCfg.ClientIdPrefix = cfg.ClientIdPrefix + "replay-"
+
+	var client mqttClient
+	if replayCfg.ProtocolVersion == 5 {
+		client, err = newClientV5(&replayCfg, func(*inboundMessage) {})
+	} else {
+		client, err = newClientV3(&replayCfg, func(*inboundMessage) {})
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("回放到MQTT服务器: %s, 协议版本: %d", replayCfg.Broker, replayCfg.ProtocolVersion)
+
+	r := &Replayer{client: client}
+	r.deliver = func(msg *inboundMessage) error {
+		// 录制中的保留标记表示消息来自服务器的保留存储，回放时不再设置保留，避免覆盖服务器上的保留消息
+		_, err := client.Publish(msg.Topic, msg.Qos, false, msg.Payload)
+		return err
+	}
+	return r, nil
+}
+
+// 回放录制文件，path 可以是单个文件或录制目录
+func (r *Replayer) Replay(path string, opts ReplayOptions) (*ReplayStats, error) {
+	if opts.Speed < 0 {
+		return nil, fmt.Errorf("回放速度不能为负数")
+	}
+	if opts.Filter != "" {
+		if err := validateTopicFilter(opts.Filter); err != nil {
+			return nil, fmt.Errorf("主题过滤器 '%s' 非法: %v", opts.Filter, err)
+		}
+	}
+	files, err := ListCaptureFiles(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取录制文件失败: %v", err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s 中没有录制文件", path)
+	}
+
+	stats := &ReplayStats{Files: len(files)}
+	started := time.Now()
+	// 按录制时间间隔调度：target 为当前消息应当送出的时刻
+	var last time.Time
+	target := started
+	for _, file := range files {
+		log.Printf("开始回放录制文件: %s", file)
+		err := readCaptureFile(file, func(msg *inboundMessage) error {
+			stats.Total++
+			if opts.Filter != "" && !topicMatchesFilter(opts.Filter, msg.Topic) {
+				stats.Skipped++
+				return nil
+			}
+			if opts.Speed > 0 && !last.IsZero() {
+				gap := msg.ReceivedAt.Sub(last)
+				if gap < 0 {
+					gap = 0
+				}
+				if opts.MaxGap > 0 && gap > opts.MaxGap {
+					gap = opts.MaxGap
+				}
+				target = target.Add(time.Duration(float64(gap) / opts.Speed))
+				if wait := time.Until(target); wait > 0 {
+					time.Sleep(wait)
+				}
+			}
+			last = msg.ReceivedAt
+			if !opts.KeepTime {
+				msg.ReceivedAt = time.Now()
+			}
+
+			if err := r.deliver(msg); err != nil {
+				stats.Failed++
+				log.Printf("回放消息失败，主题: %s, 错误: %v", msg.Topic, err)
+				return nil
+			}
+			stats.Replayed++
+			return nil
+		})
+		if err != nil {
+			return stats, fmt.Errorf("回放录制文件 %s 失败: %v", file, err)
+		}
+	}
+	stats.Elapsed = time.Since(started)
+	return stats, nil
+}
+
+// 结束回放：等待接收管道处理完剩余消息，或断开MQTT连接
+func (r *Replayer) Close() {
+	if r.service != nil {
+		r.service.pipeline.Close()
+		// 后台在线检测没有运行，回放结束后按最终状态检查一次
+		r.service.presence.checkAll()
+		stats := r.service.IngestStats()
+		log.Printf("接收管道已处理 %d 条消息，丢弃 %d 条", stats.Processed, stats.DroppedOldest+stats.DroppedNewest+stats.DroppedBlocked)
+	}
+	if r.client != nil {
+		r.client.Disconnect()
+	}
+}
@@ -0,0 +1,309 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// RetentionConfig 对应 config.yaml 中的 retention 配置段，限制为0时不限制
+type RetentionConfig struct {
+	Enabled    bool  `json:"enabled"`    // 是否启动定期清理
+	MaxAgeDays int   `json:"maxAgeDays"` // 帧的最长保留天数
+	MaxBytes   int64 `json:"maxBytes"`   // 每台设备帧的最大总字节数
+	MaxFrames  int   `json:"maxFrames"`  // 每台设备帧的最大数量
+	Interval   int   `json:"interval"`   // 清理间隔（秒）
+	BatchSize  int   `json:"batchSize"`  // 每批处理的帧数
+}
+
+// 预览时最多返回的对象键数
+const retentionSampleSize = 100
+
+func defaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		Interval:  3600,
+		BatchSize: 500,
+	}
+}
+
+// 读取保留策略配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadRetentionConfig(ctx context.Context) (*RetentionConfig, error) {
+	cfg := defaultRetentionConfig()
+
+	v, err := g.Cfg().Get(ctx, "retention")
+	if err != nil {
+		return nil, fmt.Errorf("读取retention配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析retention配置失败: %v", err)
+		}
+	}
+
+	if err := envBool("RETENTION_ENABLED", &cfg.Enabled); err != nil {
+		return nil, err
+	}
+	if err := envInt("RETENTION_MAX_AGE_DAYS", &cfg.MaxAgeDays); err != nil {
+		return nil, err
+	}
+	if err := envInt("RETENTION_MAX_FRAMES", &cfg.MaxFrames); err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxAgeDays < 0 || cfg.MaxBytes < 0 || cfg.MaxFrames < 0 {
+		return nil, fmt.Errorf("retention 的 maxAgeDays、maxBytes、maxFrames 不能为负数")
+	}
+	if cfg.Interval <= 0 {
+		return nil, fmt.Errorf("retention.interval 必须大于0，当前为 %d", cfg.Interval)
+	}
+	if cfg.BatchSize <= 0 {
+		return nil, fmt.Errorf("retention.batchSize 必须大于0，当前为 %d", cfg.BatchSize)
+	}
+	return &cfg, nil
+}
+
+// RetentionPolicy 一台设备实际生效的保留策略，为0时不限制
+type RetentionPolicy struct {
+	MaxAgeDays int   `json:"maxAgeDays"`
+	MaxBytes   int64 `json:"maxBytes"`
+	MaxFrames  int   `json:"maxFrames"`
+}
+
+// 是否没有任何限制
+func (p RetentionPolicy) Unlimited() bool {
+	return p.MaxAgeDays == 0 && p.MaxBytes == 0 && p.MaxFrames == 0
+}
+
+// 合并设备配置与全局配置：设备为0时使用全局值，为-1时不限制
+func (c *RetentionConfig) PolicyFor(device *model.DeviceModel) RetentionPolicy {
+	policy := RetentionPolicy{MaxAgeDays: c.MaxAgeDays, MaxBytes: c.MaxBytes, MaxFrames: c.MaxFrames}
+	if device == nil {
+		return policy
+	}
+	if device.RetentionDays != 0 {
+		policy.MaxAgeDays = device.RetentionDays
+	}
+	if device.RetentionMaxBytes != 0 {
+		policy.MaxBytes = device.RetentionMaxBytes
+	}
+	if device.RetentionMaxFrames != 0 {
+		policy.MaxFrames = device.RetentionMaxFrames
+	}
+	// -1 表示不限制
+	if policy.MaxAgeDays < 0 {
+		policy.MaxAgeDays = 0
+	}
+	if policy.MaxBytes < 0 {
+		policy.MaxBytes = 0
+	}
+	if policy.MaxFrames < 0 {
+		policy.MaxFrames = 0
+	}
+	return policy
+}
+
+// RetentionPlan 一台设备的清理结果，预览时为将要删除的帧
+type RetentionPlan struct {
+	DeviceId     string          `json:"deviceId"`
+	Policy       RetentionPolicy `json:"policy"`
+	Frames       int             `json:"frames"`       // 清理前的帧数
+	Bytes        int64           `json:"bytes"`        // 清理前的总字节数
+	PurgeFrames  int             `json:"purgeFrames"`  // 删除的帧数
+	PurgeBytes   int64           `json:"purgeBytes"`   // 删除的字节数
+	OldestPurged *time.Time      `json:"oldestPurged"` // 删除的最早一帧的时间
+	NewestPurged *time.Time      `json:"newestPurged"` // 删除的最晚一帧的时间
+	Sample       []string        `json:"sample"`       // 删除的帧的对象键，最多返回 retentionSampleSize 个
+	Failed       int             `json:"failed"`       // 删除失败的帧数
+}
+
+func (p *RetentionPlan) add(image *model.ImageModel) {
+	p.PurgeFrames++
+	p.PurgeBytes += image.Size
+	t := image.FrameTime
+	if p.OldestPurged == nil {
+		p.OldestPurged = &t
+	}
+	p.NewestPurged = &t
+	if len(p.Sample) < retentionSampleSize {
+		p.Sample = append(p.Sample, image.StorageKey)
+	}
+}
+
+// 清理用到的图像索引操作，由 model.Image 实现
+type retentionIndex interface {
+	Usage(ctx g.Ctx, deviceId string) (count int, bytes int64, err error)
+	Oldest(ctx g.Ctx, deviceId string, after *model.ImageModel, limit int) ([]model.ImageModel, error)
+	DeleteKeys(ctx g.Ctx, keys []string) error
+}
+
+// 定期清理：按保留策略从最旧的帧开始删除，帧通过图像索引查找
+type janitor struct {
+	cfg            *RetentionConfig
+	storage        storage.Storage
+	index          retentionIndex
+	thumbnailSizes []int // 删除帧时一并删除的缩略图尺寸
+}
+
+func newJanitor(cfg *RetentionConfig, st storage.Storage, thumbnailSizes []int) *janitor {
+	return &janitor{cfg: cfg, storage: st, index: model.Image, thumbnailSizes: thumbnailSizes}
+}
+
+func (j *janitor) run() {
+	ticker := time.NewTicker(time.Duration(j.cfg.Interval) * time.Second)
+	defer ticker.Stop()
+	for {
+		j.purgeAll()
+		<-ticker.C
+	}
+}
+
+// 清理全部设备
+func (j *janitor) purgeAll() {
+	ctx := context.Background()
+	plans, err := j.planAll(ctx, false)
+	if err != nil {
+		log.Printf("清理过期图像失败: %v", err)
+		return
+	}
+	frames, bytes := 0, int64(0)
+	for _, plan := range plans {
+		frames += plan.PurgeFrames
+		bytes += plan.PurgeBytes
+	}
+	if frames > 0 {
+		log.Printf("本次共清理 %d 台设备的 %d 帧，释放 %d 字节", len(plans), frames, bytes)
+	}
+}
+
+// 对全部有图像的设备执行清理或预览，只返回有帧需要删除的设备
+func (j *janitor) planAll(ctx context.Context, dryRun bool) ([]*RetentionPlan, error) {
+	deviceIds, err := model.Image.Devices(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取设备列表失败: %v", err)
+	}
+	devices, err := model.Device.All(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("获取设备列表失败: %v", err)
+	}
+	byId := make(map[string]*model.DeviceModel, len(devices))
+	for i := range devices {
+		byId[devices[i].Id] = &devices[i]
+	}
+
+	plans := make([]*RetentionPlan, 0)
+	for _, deviceId := range deviceIds {
+		plan, err := j.plan(ctx, deviceId, j.cfg.PolicyFor(byId[deviceId]), dryRun)
+		if err != nil {
+			log.Printf("清理设备 %s 的图像失败: %v", deviceId, err)
+			continue
+		}
+		if plan.PurgeFrames > 0 {
+			plans = append(plans, plan)
+		}
+	}
+	return plans, nil
+}
+
+// 按策略从最旧的帧开始检查，直到剩余的帧满足全部限制；dryRun 为 false 时删除这些帧
+func (j *janitor) plan(ctx context.Context, deviceId string, policy RetentionPolicy, dryRun bool) (*RetentionPlan, error) {
+	count, bytes, err := j.index.Usage(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	plan := &RetentionPlan{DeviceId: deviceId, Policy: policy, Frames: count, Bytes: bytes, Sample: make([]string, 0)}
+	if policy.Unlimited() || count == 0 {
+		return plan, nil
+	}
+	var cutoff time.Time
+	if policy.MaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -policy.MaxAgeDays)
+	}
+
+	var after *model.ImageModel
+	for {
+		batch, err := j.index.Oldest(ctx, deviceId, after, j.cfg.BatchSize)
+		if err != nil {
+			return plan, err
+		}
+		var purge []model.ImageModel
+		satisfied := false
+		for i := range batch {
+			image := &batch[i]
+			expired := !cutoff.IsZero() && image.FrameTime.Before(cutoff)
+			tooMany := policy.MaxFrames > 0 && count > policy.MaxFrames
+			tooLarge := policy.MaxBytes > 0 && bytes > policy.MaxBytes
+			if !expired && !tooMany && !tooLarge {
+				// 之后的帧更新，不会过期，剩余的数量和字节数也已满足限制
+				satisfied = true
+				break
+			}
+			purge = append(purge, *image)
+			plan.add(image)
+			count--
+			bytes -= image.Size
+		}
+		if !dryRun {
+			plan.Failed += j.delete(ctx, deviceId, purge)
+		}
+		if satisfied || len(batch) < j.cfg.BatchSize {
+			break
+		}
+		after = &batch[len(batch)-1]
+	}
+	return plan, nil
+}
+
+// 删除帧、元数据、缩略图和图像索引，返回删除失败的帧数
+func (j *janitor) delete(ctx context.Context, deviceId string, images []model.ImageModel) int {
+	failed := 0
+	keys := make([]string, 0, len(images))
+	for _, image := range images {
+		if err := j.storage.Delete(ctx, image.StorageKey); err != nil {
+			failed++
+			log.Printf("删除设备 %s 的帧 %s 失败: %v", deviceId, image.StorageKey, err)
+			continue
+		}
+		if err := j.storage.Delete(ctx, model.MetaKey(image.StorageKey)); err != nil {
+			log.Printf("删除设备 %s 的帧元数据 %s 失败: %v", deviceId, model.MetaKey(image.StorageKey), err)
+		}
+		for _, size := range j.thumbnailSizes {
+			if err := j.storage.Delete(ctx, model.ThumbnailKey(image.StorageKey, size)); err != nil {
+				log.Printf("删除设备 %s 的缩略图 %s 失败: %v", deviceId, model.ThumbnailKey(image.StorageKey, size), err)
+			}
+		}
+		keys = append(keys, image.StorageKey)
+		log.Printf("已清理设备 %s 的帧 %s（%s，%d 字节）",
+			deviceId, image.StorageKey, image.FrameTime.Format("2006-01-02 15:04:05.000"), image.Size)
+	}
+	if err := j.index.DeleteKeys(ctx, keys); err != nil {
+		log.Printf("删除设备 %s 的图像索引失败: %v", deviceId, err)
+	}
+	return failed
+}
+
+// 预览保留策略将要删除的帧，deviceId 为空时预览全部设备
+func (s *MQTTService) RetentionPreview(ctx context.Context, deviceId string) ([]*RetentionPlan, error) {
+	j := newJanitor(s.retentionCfg, s.storage, s.thumbnailCfg.Sizes)
+	if deviceId == "" {
+		return j.planAll(ctx, true)
+	}
+	device, err := model.Device.Get(ctx, deviceId)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := j.plan(ctx, deviceId, s.retentionCfg.PolicyFor(device), true)
+	if err != nil {
+		return nil, err
+	}
+	return []*RetentionPlan{plan}, nil
+}
+
+// 获取保留策略配置
+func (s *MQTTService) RetentionConfig() *RetentionConfig {
+	return s.retentionCfg
+}
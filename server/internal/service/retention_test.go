@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 内存中的图像索引
+type memoryIndex struct {
+	images []model.ImageModel
+}
+
+func (m *memoryIndex) Usage(ctx g.Ctx, deviceId string) (count int, bytes int64, err error) {
+	for _, image := range m.images {
+		if image.DeviceId == deviceId {
+			count++
+			bytes += image.Size
+		}
+	}
+	return count, bytes, nil
+}
+
+func (m *memoryIndex) Oldest(ctx g.Ctx, deviceId string, after *model.ImageModel, limit int) ([]model.ImageModel, error) {
+	var images []model.ImageModel
+	for _, image := range m.images {
+		if image.DeviceId != deviceId {
+			continue
+		}
+		if after != nil && (image.FrameTime.Before(after.FrameTime) ||
+			(image.FrameTime.Equal(after.FrameTime) && image.Id <= after.Id)) {
+			continue
+		}
+		images = append(images, image)
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if !images[i].FrameTime.Equal(images[j].FrameTime) {
+			return images[i].FrameTime.Before(images[j].FrameTime)
+		}
+		return images[i].Id < images[j].Id
+	})
+	if len(images) > limit {
+		images = images[:limit]
+	}
+	return images, nil
+}
+
+func (m *memoryIndex) DeleteKeys(ctx g.Ctx, keys []string) error {
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		deleted[key] = true
+	}
+	images := m.images[:0]
+	for _, image := range m.images {
+		if !deleted[image.StorageKey] {
+			images = append(images, image)
+		}
+	}
+	m.images = images
+	return nil
+}
+
+func (m *memoryIndex) keys() []string {
+	keys := make([]string, 0, len(m.images))
+	for _, image := range m.images {
+		keys = append(keys, image.StorageKey)
+	}
+	return keys
+}
+
+func TestJanitorPlan(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	// 五帧，每帧100字节，分别为10、8、5、2、0天前
+	ages := []int{10, 8, 5, 2, 0}
+	keys := make([]string, len(ages))
+	newImages := func() []model.ImageModel {
+		images := make([]model.ImageModel, len(ages))
+		for i, days := range ages {
+			keys[i] = "cam01/frame" + string(rune('1'+i)) + ".jpg"
+			images[i] = model.ImageModel{
+				Id:         int64(i + 1),
+				DeviceId:   "cam01",
+				StorageKey: keys[i],
+				FrameTime:  now.AddDate(0, 0, -days),
+				Size:       100,
+			}
+		}
+		// 其他设备的帧不受影响
+		return append(images, model.ImageModel{Id: 6, DeviceId: "cam02", StorageKey: "cam02/frame1.jpg", FrameTime: now.AddDate(0, 0, -30), Size: 100})
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		purged int // 从最旧的帧开始删除的帧数
+	}{
+		{"不限制", RetentionPolicy{}, 0},
+		{"都满足限制", RetentionPolicy{MaxAgeDays: 30, MaxFrames: 5, MaxBytes: 500}, 0},
+		{"按天数", RetentionPolicy{MaxAgeDays: 7}, 2},
+		{"按帧数", RetentionPolicy{MaxFrames: 2}, 3},
+		{"按字节数", RetentionPolicy{MaxBytes: 250}, 3},
+		{"按字节数刚好满足", RetentionPolicy{MaxBytes: 300}, 2},
+		{"多个限制取删除最多的", RetentionPolicy{MaxAgeDays: 3, MaxFrames: 4}, 3},
+		{"全部删除", RetentionPolicy{MaxAgeDays: 7, MaxFrames: 0, MaxBytes: 50}, 5},
+	}
+	for _, tt := range tests {
+		for _, dryRun := range []bool{true, false} {
+			name := tt.name
+			if dryRun {
+				name += "/预览"
+			}
+			t.Run(name, func(t *testing.T) {
+				st, err := storage.NewLocal(t.TempDir())
+				if err != nil {
+					t.Fatal(err)
+				}
+				index := &memoryIndex{images: newImages()}
+				for _, key := range index.keys() {
+					if err := st.Put(ctx, key, []byte("jpeg")); err != nil {
+						t.Fatal(err)
+					}
+					if err := st.Put(ctx, model.MetaKey(key), []byte("{}")); err != nil {
+						t.Fatal(err)
+					}
+					if err := st.Put(ctx, model.ThumbnailKey(key, 160), []byte("jpeg")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				// 每批两帧，覆盖分批读取
+				j := &janitor{cfg: &RetentionConfig{BatchSize: 2}, storage: st, index: index, thumbnailSizes: []int{160}}
+
+				plan, err := j.plan(ctx, "cam01", tt.policy, dryRun)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if plan.Frames != 5 || plan.Bytes != 500 {
+					t.Errorf("清理前为 %d 帧、%d 字节，应为 5 帧、500 字节", plan.Frames, plan.Bytes)
+				}
+				if plan.PurgeFrames != tt.purged || plan.PurgeBytes != int64(tt.purged)*100 {
+					t.Errorf("删除 %d 帧、%d 字节，应为 %d 帧、%d 字节", plan.PurgeFrames, plan.PurgeBytes, tt.purged, tt.purged*100)
+				}
+				if want := append([]string{}, keys[:tt.purged]...); !reflect.DeepEqual(plan.Sample, want) {
+					t.Errorf("删除的帧为 %v，应为 %v", plan.Sample, want)
+				}
+				if tt.purged > 0 {
+					oldest, newest := now.AddDate(0, 0, -ages[0]), now.AddDate(0, 0, -ages[tt.purged-1])
+					if plan.OldestPurged == nil || !plan.OldestPurged.Equal(oldest) || plan.NewestPurged == nil || !plan.NewestPurged.Equal(newest) {
+						t.Errorf("删除的帧时间为 %v - %v，应为 %v - %v", plan.OldestPurged, plan.NewestPurged, oldest, newest)
+					}
+				} else if plan.OldestPurged != nil || plan.NewestPurged != nil {
+					t.Errorf("没有删除帧时不应有删除时间")
+				}
+				if plan.Failed != 0 {
+					t.Errorf("删除失败 %d 帧", plan.Failed)
+				}
+
+				// 预览不删除；清理时删除帧、元数据、缩略图和索引
+				remaining := keys[tt.purged:]
+				if dryRun {
+					remaining = keys
+				}
+				if want := append(append([]string{}, remaining...), "cam02/frame1.jpg"); !reflect.DeepEqual(index.keys(), want) {
+					t.Errorf("剩余的索引为 %v，应为 %v", index.keys(), want)
+				}
+				for i, key := range keys {
+					exists := dryRun || i >= tt.purged
+					for _, k := range []string{key, model.MetaKey(key), model.ThumbnailKey(key, 160)} {
+						if _, err := st.Stat(ctx, k); (err == nil) != exists {
+							t.Errorf("%s 是否存在为 %v，应为 %v", k, err == nil, exists)
+						}
+					}
+				}
+			})
+		}
+	}
+}
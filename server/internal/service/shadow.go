@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"video-platform/internal/model"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// ShadowConfig 对应 config.yaml 中的 shadow 配置段
+type ShadowConfig struct {
+	DesiredTopic string `json:"desiredTopic"` // 期望状态发布主题模板，{deviceId} 替换为设备ID
+	Qos          int    `json:"qos"`          // 发布使用的QoS
+}
+
+// 分辨率格式，例如 1920x1080
+var resolutionPattern = regexp.MustCompile(`^[1-9][0-9]{0,4}x[1-9][0-9]{0,4}$`)
+
+func defaultShadowConfig() ShadowConfig {
+	return ShadowConfig{
+		DesiredTopic: "device/{deviceId}/shadow/desired",
+		Qos:          1,
+	}
+}
+
+// 读取设备影子配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadShadowConfig(ctx context.Context) (*ShadowConfig, error) {
+	cfg := defaultShadowConfig()
+
+	v, err := g.Cfg().Get(ctx, "shadow")
+	if err != nil {
+		return nil, fmt.Errorf("读取shadow配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析shadow配置失败: %v", err)
+		}
+	}
+
+	envString("SHADOW_DESIRED_TOPIC", &cfg.DesiredTopic)
+
+	if !strings.Contains(cfg.DesiredTopic, "{deviceId}") {
+		return nil, fmt.Errorf("shadow.desiredTopic 必须包含 {deviceId}，当前为 '%s'", cfg.DesiredTopic)
+	}
+	if cfg.Qos < 0 || cfg.Qos > 2 {
+		return nil, fmt.Errorf("shadow.qos 必须为 0、1 或 2，当前为 %d", cfg.Qos)
+	}
+	return &cfg, nil
+}
+
+// 发布到设备的期望状态
+type shadowDesiredMessage struct {
+	Version int64                  `json:"version"`
+	State   map[string]interface{} `json:"state"`
+	Ts      int64                  `json:"ts"` // 更新时间，Unix毫秒
+}
+
+// 校验期望状态中已知字段的取值，其余字段原样下发
+func validateShadowState(state map[string]interface{}) error {
+	for key, value := range state {
+		if value == nil {
+			continue
+		}
+		switch key {
+		case "resolution":
+			s, ok := value.(string)
+			if !ok || !resolutionPattern.MatchString(s) {
+				return fmt.Errorf("resolution 必须为 宽x高 格式，例如 1920x1080")
+			}
+		case "captureInterval":
+			n, ok := shadowInt(value)
+			if !ok || n <= 0 {
+				return fmt.Errorf("captureInterval 必须为正整数（秒）")
+			}
+		case "jpegQuality":
+			n, ok := shadowInt(value)
+			if !ok || n < 1 || n > 100 {
+				return fmt.Errorf("jpegQuality 必须为 1-100 之间的整数")
+			}
+		}
+	}
+	return nil
+}
+
+// 将JSON数值转换为整数，非整数时返回 false
+func shadowInt(value interface{}) (int64, bool) {
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case json.Number:
+		n, err := v.Int64()
+		return n, err == nil
+	default:
+		return 0, false
+	}
+	if f != math.Trunc(f) {
+		return 0, false
+	}
+	return int64(f), true
+}
+
+// 更新期望状态：merge 为 false 时整体替换，为 true 时按字段合并，值为 null 的字段被删除。
+// 保存后以保留消息发布到设备的期望状态主题，设备重新上线时也能收到最新配置
+func (s *MQTTService) UpdateShadowDesired(ctx context.Context, deviceId string, state map[string]interface{}, merge bool) (*model.ShadowDocument, error) {
+	// 设备ID会拼入主题，含 + # / 时会发布到通配或其他设备的主题
+	if !validDeviceId(deviceId) {
+		return nil, fmt.Errorf("设备ID非法: '%s'", deviceId)
+	}
+	if err := validateShadowState(state); err != nil {
+		return nil, err
+	}
+	device, err := model.Device.Get(ctx, deviceId)
+	if err != nil {
+		return nil, fmt.Errorf("获取设备信息失败: %v", err)
+	}
+	if device == nil {
+		return nil, fmt.Errorf("设备不存在")
+	}
+
+	var desired map[string]interface{}
+	version, err := model.Shadow.UpdateDesired(ctx, deviceId, func(current map[string]interface{}) error {
+		if !merge {
+			for key := range current {
+				delete(current, key)
+			}
+		}
+		for key, value := range state {
+			if value == nil {
+				delete(current, key)
+				continue
+			}
+			current[key] = value
+		}
+		desired = current
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存期望状态失败: %v", err)
+	}
+	// 并发更新时发布顺序可能与版本顺序不同，设备应忽略版本号小于已应用版本的消息
+	payload, err := json.Marshal(shadowDesiredMessage{Version: version, State: desired, Ts: time.Now().UnixMilli()})
+	if err != nil {
+		return nil, err
+	}
+	topic := s.shadowDesiredTopic(deviceId)
+	if _, err := s.client.Publish(topic, byte(s.shadowCfg.Qos), true, payload); err != nil {
+		return nil, fmt.Errorf("期望状态已保存（版本 %d），但发布失败: %v", version, err)
+	}
+	log.Printf("已发布设备 %s 的期望状态，版本: %d，主题: %s", deviceId, version, topic)
+
+	shadow, err := model.Shadow.Get(ctx, deviceId)
+	if err != nil || shadow == nil {
+		return nil, fmt.Errorf("获取设备影子失败: %v", err)
+	}
+	return shadow.Document(), nil
+}
+
+// 删除设备影子，并以空的保留消息清除服务器上的期望状态，以免之后添加的同名设备收到旧配置
+func (s *MQTTService) DeleteShadow(ctx context.Context, deviceId string) error {
+	if err := model.Shadow.Delete(ctx, deviceId); err != nil {
+		return err
+	}
+	if !validDeviceId(deviceId) {
+		return nil
+	}
+	topic := s.shadowDesiredTopic(deviceId)
+	if _, err := s.client.Publish(topic, byte(s.shadowCfg.Qos), true, nil); err != nil {
+		return fmt.Errorf("清除保留的期望状态失败: %v", err)
+	}
+	log.Printf("已清除设备 %s 保留的期望状态，主题: %s", deviceId, topic)
+	return nil
+}
+
+func (s *MQTTService) shadowDesiredTopic(deviceId string) string {
+	return strings.ReplaceAll(s.shadowCfg.DesiredTopic, "{deviceId}", deviceId)
+}
+
+// 处理设备上报的实际状态，负载为 {"state":{...}}，也兼容直接上报状态对象
+func (s *MQTTService) handleShadowReported(msg *inboundMessage, match *TopicMatch) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(msg.Payload, &doc); err != nil {
+		log.Printf("设备 %s 的上报状态格式错误: %v", match.DeviceId, err)
+		return
+	}
+	reported := doc
+	if state, ok := doc["state"].(map[string]interface{}); ok {
+		reported = state
+	}
+
+	ctx := context.Background()
+	version, err := model.Shadow.SaveReported(ctx, match.DeviceId, reported)
+	if err != nil {
+		log.Printf("保存设备 %s 的上报状态失败: %v", match.DeviceId, err)
+		return
+	}
+	log.Printf("设备 %s 上报状态已更新，版本: %d", match.DeviceId, version)
+
+	if shadow, err := model.Shadow.Get(ctx, match.DeviceId); err == nil && shadow != nil {
+		if delta := shadow.Document().Delta; len(delta) > 0 {
+			log.Printf("设备 %s 尚未应用的期望状态: %v", match.DeviceId, delta)
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SimulatorOptions 设备模拟参数
+type SimulatorOptions struct {
+	Broker       string        // MQTT服务器地址，为空时使用 mqtt.broker 配置
+	Devices      int           // 虚拟摄像头数量
+	DevicePrefix string        // 设备ID前缀，设备ID为前缀加4位序号
+	ImageDir     string        // 图像目录，按文件名顺序循环发布其中的 JPEG
+	MaxImages    int           // 最多加载的图像数，为0时不限制
+	Topic        string        // 主题模板，{deviceId} 替换为设备ID
+	Rate         float64       // 每台设备每秒发布的帧数
+	Jitter       float64       // 发布间隔的随机抖动比例，0-1
+	Qos          byte          // 发布使用的QoS
+	Raw          bool          // 发布裸 JPEG，默认使用带序号和采集时间的信封格式
+	Duration     time.Duration // 运行时长，为0时一直运行到 ctx 取消
+	Count        int           // 每台设备发布的帧数，为0时不限制
+	Verify       bool          // 同时订阅发布的主题，统计丢失率和端到端延迟
+	Report       time.Duration // 周期报告间隔，为0时只在结束时报告
+}
+
+// LatencyStats 延迟分布，单位为毫秒
+type LatencyStats struct {
+	Count int     `json:"count"`
+	Avg   float64 `json:"avg"`
+	P50   float64 `json:"p50"`
+	P95   float64 `json:"p95"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func (l LatencyStats) String() string {
+	return fmt.Sprintf("avg %.1fms, p50 %.1fms, p95 %.1fms, p99 %.1fms, max %.1fms", l.Avg, l.P50, l.P95, l.P99, l.Max)
+}
+
+// SimulatorReport 模拟结果
+type SimulatorReport struct {
+	Elapsed        time.Duration `json:"elapsed"`
+	Published      uint64        `json:"published"` // 发布成功的消息数
+	Failed         uint64        `json:"failed"`    // 发布失败的消息数
+	Bytes          uint64        `json:"bytes"`     // 发布成功的字节数
+	PublishLatency LatencyStats  `json:"publishLatency"`
+	Received       uint64        `json:"received"` // 校验订阅收到的消息数，未开启校验时为0
+	Loss           float64       `json:"loss"`     // 丢失率，未开启校验时只计算发布失败
+	EndToEnd       LatencyStats  `json:"endToEnd"` // 从发布到校验订阅收到的延迟
+}
+
+// 延迟采样
+type latencyRecorder struct {
+	mu      sync.Mutex
+	samples []float64
+}
+
+func (l *latencyRecorder) Add(d time.Duration) {
+	l.mu.Lock()
+	l.samples = append(l.samples, float64(d)/float64(time.Millisecond))
+	l.mu.Unlock()
+}
+
+func (l *latencyRecorder) Stats() LatencyStats {
+	l.mu.Lock()
+	samples := append([]float64(nil), l.samples...)
+	l.mu.Unlock()
+	if len(samples) == 0 {
+		return LatencyStats{}
+	}
+	sort.Float64s(samples)
+	sum := 0.0
+	for _, v := range samples {
+		sum += v
+	}
+	percentile := func(p float64) float64 {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+	return LatencyStats{
+		Count: len(samples),
+		Avg:   sum / float64(len(samples)),
+		P50:   percentile(0.50),
+		P95:   percentile(0.95),
+		P99:   percentile(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// Simulator 虚拟摄像头：每台设备使用独立的MQTT连接，按设定速率发布图像
+type Simulator struct {
+	opts      SimulatorOptions
+	cfg       MQTTConfig
+	images    [][]byte
+	clients   []mqttClient
+	deviceIds []string
+	verifier  mqttClient
+
+	published      uint64
+	failed         uint64
+	bytes          uint64
+	received       uint64
+	publishLatency latencyRecorder
+	endToEnd       latencyRecorder
+
+	seenMu sync.Mutex
+	seen   map[string]bool // 校验订阅已收到的 主题#序号，用于去重
+}
+
+func defaultSimulatorOptions(opts *SimulatorOptions) {
+	if opts.DevicePrefix == "" {
+		opts.DevicePrefix = "sim"
+	}
+	if opts.Topic == "" {
+		opts.Topic = "device/{deviceId}/image"
+	}
+}
+
+// 创建模拟器：加载图像并为每台设备建立连接，连接参数使用 mqtt 配置
+func NewSimulator(ctx context.Context, opts SimulatorOptions) (*Simulator, error) {
+	defaultSimulatorOptions(&opts)
+	if opts.Devices <= 0 {
+		return nil, fmt.Errorf("设备数量必须大于0")
+	}
+	if opts.Rate <= 0 {
+		return nil, fmt.Errorf("发布速率必须大于0")
+	}
+	if opts.Jitter < 0 || opts.Jitter > 1 {
+		return nil, fmt.Errorf("抖动比例必须在 0-1 之间")
+	}
+	if opts.Qos > 2 {
+		return nil, fmt.Errorf("QoS 必须为 0、1 或 2")
+	}
+	if !strings.Contains(opts.Topic, "{deviceId}") {
+		return nil, fmt.Errorf("主题模板必须包含 {deviceId}")
+	}
+	if opts.Count < 0 {
+		return nil, fmt.Errorf("每台设备的帧数不能为负数")
+	}
+
+	cfg, err := LoadMQTTConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sim := &Simulator{opts: opts, cfg: *cfg, seen: make(map[string]bool)}
+	if opts.Broker != "" {
+		sim.cfg.Broker = opts.Broker
+	}
+	sim.cfg.SubscribeTopics = nil
+	sim.cfg.TopicRules = []TopicRule{}
+	sim.cfg.Session = SessionConfig{}
+	sim.cfg.Qos = int(opts.Qos)
+	// 大量连接时 MQTT 3.1.1 客户端的调试日志会淹没报告
+	sim.cfg.DebugLog = false
+
+	if sim.images, err = loadSimulatorImages(opts.ImageDir, opts.MaxImages); err != nil {
+		return nil, err
+	}
+	log.Printf("已加载 %d 张图像，MQTT服务器: %s，协议版本: %d", len(sim.images), sim.cfg.Broker, sim.cfg.ProtocolVersion)
+
+	if opts.Verify {
+		verifyCfg := sim.cfg
+		verifyCfg.ClientIdPrefix = opts.DevicePrefix + "-verify-"
+		verifyCfg.SubscribeTopics = []string{strings.ReplaceAll(opts.Topic, "{deviceId}", "+")}
+		if sim.verifier, err = sim.newClient(&verifyCfg, sim.onVerify); err != nil {
+			sim.Close()
+			return nil, err
+		}
+	}
+	for i := 1; i <= opts.Devices; i++ {
+		deviceId := fmt.Sprintf("%s%04d", opts.DevicePrefix, i)
+		deviceCfg := sim.cfg
+		deviceCfg.ClientIdPrefix = deviceId + "-"
+		client, err := sim.newClient(&deviceCfg, func(*inboundMessage) {})
+		if err != nil {
+			sim.Close()
+			return nil, fmt.Errorf("创建设备 %s 的连接失败: %v", deviceId, err)
+		}
+		sim.clients = append(sim.clients, client)
+		sim.deviceIds = append(sim.deviceIds, deviceId)
+	}
+	return sim, nil
+}
+
+func (s *Simulator) newClient(cfg *MQTTConfig, handler func(*inboundMessage)) (mqttClient, error) {
+	if cfg.ProtocolVersion == 5 {
+		return newClientV5(cfg, handler)
+	}
+	return newClientV3(cfg, handler)
+}
+
+// 按文件名顺序加载目录（包括按小时分区的子目录）中的 JPEG
+func loadSimulatorImages(dir string, max int) ([][]byte, error) {
+	var images [][]byte
+	err := filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".jpg" && ext != ".jpeg") {
+			return nil
+		}
+		if max > 0 && len(images) >= max {
+			return filepath.SkipAll
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("读取图像失败: %v", err)
+		}
+		images = append(images, data)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取图像目录失败: %v", err)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("目录 %s 中没有 JPEG 图像", dir)
+	}
+	return images, nil
+}
+
+// 运行模拟，直到 ctx 取消、达到运行时长或每台设备都发布完指定帧数
+func (s *Simulator) Run(ctx context.Context) *SimulatorReport {
+	if s.opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.Duration)
+		defer cancel()
+	}
+	started := time.Now()
+
+	var wg sync.WaitGroup
+	for i := range s.clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.runDevice(ctx, i)
+		}(i)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	var ticker <-chan time.Time
+	if s.opts.Report > 0 {
+		t := time.NewTicker(s.opts.Report)
+		defer t.Stop()
+		ticker = t.C
+	}
+	var lastPublished uint64
+	lastReport := started
+loop:
+	for {
+		select {
+		case <-done:
+			break loop
+		case now := <-ticker:
+			published := atomic.LoadUint64(&s.published)
+			rate := float64(published-lastPublished) / now.Sub(lastReport).Seconds()
+			lastPublished, lastReport = published, now
+			log.Printf("已发布 %d 条，失败 %d 条，校验收到 %d 条，当前速率 %.1f 条/秒，发布延迟 %s",
+				published, atomic.LoadUint64(&s.failed), atomic.LoadUint64(&s.received), rate, s.publishLatency.Stats())
+		}
+	}
+
+	// 等待在途消息到达校验订阅
+	if s.verifier != nil {
+		time.Sleep(2 * time.Second)
+	}
+	return s.report(time.Since(started))
+}
+
+// 单台设备的发布循环
+func (s *Simulator) runDevice(ctx context.Context, index int) {
+	deviceId := s.deviceIds[index]
+	client := s.clients[index]
+	topic := strings.ReplaceAll(s.opts.Topic, "{deviceId}", deviceId)
+	interval := time.Duration(float64(time.Second) / s.opts.Rate)
+	rng := rand.New(rand.NewSource(time.Now().UnixNano() + int64(index)))
+
+	// 随机错开各设备的首帧，避免所有设备同时发布
+	next := time.Now().Add(time.Duration(rng.Int63n(int64(interval) + 1)))
+	image := index % len(s.images)
+	for seq := int64(1); s.opts.Count == 0 || seq <= int64(s.opts.Count); seq++ {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		payload := s.images[image]
+		image = (image + 1) % len(s.images)
+		sent := time.Now()
+		if !s.opts.Raw {
+			seq := seq
+			capturedAt := json.RawMessage(strconv.FormatInt(sent.UnixMilli(), 10))
+			var err error
+			payload, err = EncodeEnvelope(EnvelopeHeader{CapturedAt: capturedAt, Seq: &seq}, payload)
+			if err != nil {
+				log.Printf("生成设备 %s 的信封失败: %v", deviceId, err)
+				return
+			}
+		}
+		if _, err := client.Publish(topic, s.opts.Qos, false, payload); err != nil {
+			atomic.AddUint64(&s.failed, 1)
+			log.Printf("设备 %s 发布失败: %v", deviceId, err)
+		} else {
+			atomic.AddUint64(&s.published, 1)
+			atomic.AddUint64(&s.bytes, uint64(len(payload)))
+			s.publishLatency.Add(time.Since(sent))
+		}
+
+		step := interval
+		if s.opts.Jitter > 0 {
+			step = time.Duration(float64(interval) * (1 + s.opts.Jitter*(2*rng.Float64()-1)))
+		}
+		next = next.Add(step)
+		// 发布耗时超过间隔时不补发积压的帧
+		if now := time.Now(); next.Before(now) {
+			next = now
+		}
+	}
+}
+
+// 校验订阅收到消息：按主题和序号去重，根据信封中的采集时间计算端到端延迟
+func (s *Simulator) onVerify(msg *inboundMessage) {
+	env, err := parseEnvelope(msg.Payload)
+	if err != nil {
+		return
+	}
+	if env.Header.Seq != nil {
+		key := fmt.Sprintf("%s#%d", msg.Topic, *env.Header.Seq)
+		s.seenMu.Lock()
+		duplicate := s.seen[key]
+		s.seen[key] = true
+		s.seenMu.Unlock()
+		if duplicate {
+			return
+		}
+	}
+	atomic.AddUint64(&s.received, 1)
+	if env.CapturedAt != nil {
+		s.endToEnd.Add(msg.ReceivedAt.Sub(*env.CapturedAt))
+	}
+}
+
+func (s *Simulator) report(elapsed time.Duration) *SimulatorReport {
+	r := &SimulatorReport{
+		Elapsed:        elapsed,
+		Published:      atomic.LoadUint64(&s.published),
+		Failed:         atomic.LoadUint64(&s.failed),
+		Bytes:          atomic.LoadUint64(&s.bytes),
+		PublishLatency: s.publishLatency.Stats(),
+		Received:       atomic.LoadUint64(&s.received),
+		EndToEnd:       s.endToEnd.Stats(),
+	}
+	attempted := r.Published + r.Failed
+	if attempted > 0 {
+		lost := r.Failed
+		if s.verifier != nil && r.Received < attempted {
+			lost = attempted - r.Received
+		}
+		r.Loss = float64(lost) / float64(attempted)
+	}
+	return r
+}
+
+// 断开所有连接
+func (s *Simulator) Close() {
+	for _, client := range s.clients {
+		client.Disconnect()
+	}
+	if s.verifier != nil {
+		s.verifier.Disconnect()
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+)
+
+// 读取存储配置：配置文件 -> 环境变量覆盖 -> 校验，本地驱动未配置目录时使用 imageDir
+func LoadStorageConfig(ctx context.Context, imageDir string) (*storage.Config, error) {
+	cfg := storage.Config{Driver: storage.DriverLocal}
+
+	v, err := g.Cfg().Get(ctx, "storage")
+	if err != nil {
+		return nil, fmt.Errorf("读取storage配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析storage配置失败: %v", err)
+		}
+	}
+
+	envString("STORAGE_DRIVER", &cfg.Driver)
+	envString("STORAGE_LOCAL_DIR", &cfg.Local.Dir)
+	envString("STORAGE_S3_ENDPOINT", &cfg.S3.Endpoint)
+	envString("STORAGE_S3_REGION", &cfg.S3.Region)
+	envString("STORAGE_S3_BUCKET", &cfg.S3.Bucket)
+	envString("STORAGE_S3_PREFIX", &cfg.S3.Prefix)
+	envString("STORAGE_S3_ACCESS_KEY", &cfg.S3.AccessKey)
+	envString("STORAGE_S3_SECRET_KEY", &cfg.S3.SecretKey)
+	if err := envBool("STORAGE_S3_USE_SSL", &cfg.S3.UseSSL); err != nil {
+		return nil, err
+	}
+	if err := envBool("STORAGE_S3_PATH_STYLE", &cfg.S3.PathStyle); err != nil {
+		return nil, err
+	}
+
+	if cfg.Local.Dir == "" {
+		cfg.Local.Dir = imageDir
+	}
+	switch cfg.Driver {
+	case storage.DriverLocal:
+	case storage.DriverS3:
+		if cfg.S3.Endpoint == "" || cfg.S3.Bucket == "" {
+			return nil, fmt.Errorf("storage.s3.endpoint 和 storage.s3.bucket 不能为空")
+		}
+	default:
+		return nil, fmt.Errorf("storage.driver 必须为 local 或 s3，当前为 '%s'", cfg.Driver)
+	}
+	return &cfg, nil
+}
+
+// 根据配置创建图像存储，S3 驱动会检查存储桶是否可以访问
+func OpenStorage(ctx context.Context, cfg *storage.Config) (storage.Storage, error) {
+	st, err := storage.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	switch s := st.(type) {
+	case *storage.Local:
+		log.Printf("图像存储: 本地目录 %s", s.Root())
+	case *storage.S3:
+		if err := s.Check(ctx); err != nil {
+			return nil, err
+		}
+		log.Printf("图像存储: S3 %s/%s", cfg.S3.Endpoint, cfg.S3.Bucket)
+	}
+	return st, nil
+}
+
+// 读取 mqtt 和 storage 配置并创建图像存储，供子命令使用
+func LoadStorage(ctx context.Context) (storage.Storage, error) {
+	mqttCfg, err := LoadMQTTConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadStorageConfig(ctx, mqttCfg.ImageDir)
+	if err != nil {
+		return nil, err
+	}
+	return OpenStorage(ctx, cfg)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+	"video-platform/internal/model"
+)
+
+// 指标名称：嵌套对象的字段以 "." 连接，例如 modem.rssi
+var metricNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// 单条遥测消息最多接受的指标数
+const maxTelemetryMetrics = 64
+
+// 解析遥测消息，返回采样时间和各指标的值
+//
+// 负载为JSON对象，例如 {"ts":1742131385,"temperature":51.3,"signal":-71,"diskFree":1048576,"uptime":3600}，
+// 指标也可以放在 metrics 字段中。ts 可选，支持Unix秒、毫秒和RFC3339；
+// 嵌套对象展开为 a.b 形式，布尔值记为 0/1，其余非数值字段忽略
+func parseTelemetry(payload []byte) (*time.Time, map[string]float64, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+
+	var ts *time.Time
+	if raw, ok := doc["ts"]; ok {
+		t, err := parseDeviceTime(fmt.Sprint(raw))
+		if err != nil {
+			return nil, nil, fmt.Errorf("无效的时间戳 '%v'", raw)
+		}
+		ts = &t
+		delete(doc, "ts")
+	}
+	if metrics, ok := doc["metrics"].(map[string]interface{}); ok {
+		doc = metrics
+	}
+
+	values := make(map[string]float64)
+	flattenTelemetry("", doc, values)
+	if len(values) == 0 {
+		return nil, nil, fmt.Errorf("没有数值类型的指标")
+	}
+	if len(values) > maxTelemetryMetrics {
+		return nil, nil, fmt.Errorf("指标数量 %d 超过上限 %d", len(values), maxTelemetryMetrics)
+	}
+	return ts, values, nil
+}
+
+func flattenTelemetry(prefix string, doc map[string]interface{}, values map[string]float64) {
+	for key, raw := range doc {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		switch v := raw.(type) {
+		case json.Number:
+			if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+				values[name] = f
+			}
+		case bool:
+			if v {
+				values[name] = 1
+			} else {
+				values[name] = 0
+			}
+		case map[string]interface{}:
+			flattenTelemetry(name, v, values)
+		}
+	}
+}
+
+// 处理设备上报的遥测数据
+func (s *MQTTService) handleTelemetry(msg *inboundMessage, match *TopicMatch) {
+	deviceId := match.DeviceId
+	capturedAt, values, err := parseTelemetry(msg.Payload)
+	if err != nil {
+		log.Printf("设备 %s 的遥测数据格式错误: %v", deviceId, err)
+		return
+	}
+
+	// 设备时间偏差过大时使用接收时间
+	ts := msg.ReceivedAt
+	if capturedAt != nil {
+		if skew := capturedAt.Sub(msg.ReceivedAt); skew < model.MaxClockSkew && skew > -model.MaxClockSkew {
+			ts = capturedAt.In(time.Local)
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	samples := make([]model.TelemetryModel, 0, len(values))
+	for _, name := range names {
+		if !metricNamePattern.MatchString(name) {
+			log.Printf("忽略设备 %s 的非法指标名称: '%s'", deviceId, name)
+			continue
+		}
+		samples = append(samples, model.TelemetryModel{DeviceId: deviceId, Metric: name, Value: values[name], Ts: ts})
+	}
+	if err := model.Telemetry.Add(context.Background(), samples); err != nil {
+		log.Printf("保存设备 %s 的遥测数据失败: %v", deviceId, err)
+		return
+	}
+	log.Printf("已保存设备 %s 的 %d 项遥测数据", deviceId, len(samples))
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"sort"
+	"strconv"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/image/draw"
+)
+
+// ThumbnailConfig 对应 config.yaml 中的 thumbnail 配置段
+type ThumbnailConfig struct {
+	Enabled bool  `json:"enabled"` // 接收图像时生成缩略图，关闭时缩略图在首次请求时生成
+	Sizes   []int `json:"sizes"`   // 缩略图宽度（像素），高度按原图比例计算
+	Quality int   `json:"quality"` // JPEG 质量，1-100
+}
+
+// 缩略图宽度上限，再大就失去缩略图的意义
+const maxThumbnailSize = 1920
+
+func defaultThumbnailConfig() ThumbnailConfig {
+	return ThumbnailConfig{
+		Enabled: true,
+		Sizes:   []int{160, 320},
+		Quality: 75,
+	}
+}
+
+// 读取缩略图配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadThumbnailConfig(ctx context.Context) (*ThumbnailConfig, error) {
+	cfg := defaultThumbnailConfig()
+
+	v, err := g.Cfg().Get(ctx, "thumbnail")
+	if err != nil {
+		return nil, fmt.Errorf("读取thumbnail配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析thumbnail配置失败: %v", err)
+		}
+	}
+
+	if err := envBool("THUMBNAIL_ENABLED", &cfg.Enabled); err != nil {
+		return nil, err
+	}
+	if v, ok := os.LookupEnv("THUMBNAIL_SIZES"); ok {
+		cfg.Sizes = nil
+		for _, item := range splitList(v) {
+			size, err := strconv.Atoi(item)
+			if err != nil {
+				return nil, fmt.Errorf("环境变量 THUMBNAIL_SIZES 中的 '%s' 不是合法整数", item)
+			}
+			cfg.Sizes = append(cfg.Sizes, size)
+		}
+	}
+	if err := envInt("THUMBNAIL_QUALITY", &cfg.Quality); err != nil {
+		return nil, err
+	}
+
+	if len(cfg.Sizes) == 0 {
+		return nil, fmt.Errorf("thumbnail.sizes 不能为空")
+	}
+	seen := make(map[int]bool)
+	for _, size := range cfg.Sizes {
+		if size <= 0 || size > maxThumbnailSize {
+			return nil, fmt.Errorf("thumbnail.sizes 中的 %d 必须在 1-%d 之间", size, maxThumbnailSize)
+		}
+		if seen[size] {
+			return nil, fmt.Errorf("thumbnail.sizes 中的 %d 重复", size)
+		}
+		seen[size] = true
+	}
+	sort.Ints(cfg.Sizes)
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return nil, fmt.Errorf("thumbnail.quality 必须在 1-100 之间，当前为 %d", cfg.Quality)
+	}
+	return &cfg, nil
+}
+
+// 是否为配置的缩略图宽度
+func (c *ThumbnailConfig) HasSize(size int) bool {
+	for _, s := range c.Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// 缩略图生成：缩略图与原图存放在同一目录，见 model.ThumbnailKey
+type thumbnailer struct {
+	cfg     *ThumbnailConfig
+	storage storage.Storage
+}
+
+func newThumbnailer(cfg *ThumbnailConfig, st storage.Storage) *thumbnailer {
+	return &thumbnailer{cfg: cfg, storage: st}
+}
+
+// 为帧生成全部尺寸的缩略图。原图只解码一次，较小的尺寸从上一个较大的缩略图缩放，减少计算量
+func (t *thumbnailer) generate(ctx context.Context, frameKey string, data []byte) error {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("解码图像失败: %v", err)
+	}
+	for i := len(t.cfg.Sizes) - 1; i >= 0; i-- {
+		size := t.cfg.Sizes[i]
+		src = resize(src, size)
+		thumbnail, err := t.encode(src)
+		if err != nil {
+			return err
+		}
+		if err := t.storage.Put(ctx, model.ThumbnailKey(frameKey, size), thumbnail); err != nil {
+			return fmt.Errorf("保存 %d 像素宽的缩略图失败: %v", size, err)
+		}
+	}
+	return nil
+}
+
+// 读取帧的缩略图，不存在时（例如开启缩略图之前收到的帧）从原图生成并保存
+func (t *thumbnailer) get(ctx context.Context, frameKey string, size int) ([]byte, error) {
+	key := model.ThumbnailKey(frameKey, size)
+	data, err := t.storage.Get(ctx, key)
+	if err == nil || !storage.IsNotExist(err) {
+		return data, err
+	}
+
+	original, err := model.ReadFrame(ctx, t.storage, frameKey)
+	if err != nil {
+		return nil, err
+	}
+	src, err := jpeg.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("解码图像失败: %v", err)
+	}
+	data, err = t.encode(resize(src, size))
+	if err != nil {
+		return nil, err
+	}
+	if err := t.storage.Put(ctx, key, data); err != nil {
+		return nil, fmt.Errorf("保存缩略图失败: %v", err)
+	}
+	return data, nil
+}
+
+// 按宽度等比缩放，原图不比缩略图宽时原样返回
+func resize(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size {
+		return src
+	}
+	height = (height*size + width/2) / width
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, size, height))
+	draw.BiLinear.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// 编码为 JPEG
+func (t *thumbnailer) encode(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: t.cfg.Quality}); err != nil {
+		return nil, fmt.Errorf("编码缩略图失败: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// 获取帧的缩略图，size 为0时使用最小的尺寸
+func (s *MQTTService) Thumbnail(ctx context.Context, frameKey string, size int) ([]byte, error) {
+	if size == 0 {
+		size = s.thumbnailCfg.Sizes[0]
+	}
+	if !s.thumbnailCfg.HasSize(size) {
+		return nil, fmt.Errorf("不支持的缩略图尺寸 %d，可用尺寸: %v", size, s.thumbnailCfg.Sizes)
+	}
+	return s.thumbnails.get(ctx, frameKey, size)
+}
@@ -0,0 +1,595 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"video-platform/internal/avi"
+	"video-platform/internal/model"
+	"video-platform/internal/storage"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"golang.org/x/image/draw"
+)
+
+// TimelapseConfig 对应 config.yaml 中的 timelapse 配置段
+type TimelapseConfig struct {
+	Dir          string `json:"dir"`          // 任务记录和生成文件的保存目录
+	Workers      int    `json:"workers"`      // 同时运行的任务数
+	QueueSize    int    `json:"queueSize"`    // 等待中的任务数上限
+	MaxFrames    int    `json:"maxFrames"`    // 单个视频的最大帧数
+	MaxGifFrames int    `json:"maxGifFrames"` // GIF 的最大帧数，GIF 需要在内存中保存全部帧
+	MaxFps       int    `json:"maxFps"`       // 最大帧率
+	GifWidth     int    `json:"gifWidth"`     // 未指定时 GIF 的宽度
+}
+
+func defaultTimelapseConfig() TimelapseConfig {
+	return TimelapseConfig{
+		Dir:          "timelapse",
+		Workers:      1,
+		QueueSize:    100,
+		MaxFrames:    5000,
+		MaxGifFrames: 600,
+		MaxFps:       60,
+		GifWidth:     320,
+	}
+}
+
+// 读取延时视频配置：配置文件 -> 环境变量覆盖 -> 校验
+func LoadTimelapseConfig(ctx context.Context) (*TimelapseConfig, error) {
+	cfg := defaultTimelapseConfig()
+
+	v, err := g.Cfg().Get(ctx, "timelapse")
+	if err != nil {
+		return nil, fmt.Errorf("读取timelapse配置失败: %v", err)
+	}
+	if !v.IsNil() {
+		if err := v.Scan(&cfg); err != nil {
+			return nil, fmt.Errorf("解析timelapse配置失败: %v", err)
+		}
+	}
+
+	envString("TIMELAPSE_DIR", &cfg.Dir)
+	if err := envInt("TIMELAPSE_WORKERS", &cfg.Workers); err != nil {
+		return nil, err
+	}
+
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("timelapse.dir 不能为空")
+	}
+	if cfg.Workers <= 0 {
+		return nil, fmt.Errorf("timelapse.workers 必须大于0，当前为 %d", cfg.Workers)
+	}
+	if cfg.QueueSize <= 0 {
+		return nil, fmt.Errorf("timelapse.queueSize 必须大于0，当前为 %d", cfg.QueueSize)
+	}
+	if cfg.MaxFrames <= 0 || cfg.MaxGifFrames <= 0 {
+		return nil, fmt.Errorf("timelapse.maxFrames 和 timelapse.maxGifFrames 必须大于0")
+	}
+	if cfg.MaxFps <= 0 {
+		return nil, fmt.Errorf("timelapse.maxFps 必须大于0，当前为 %d", cfg.MaxFps)
+	}
+	if cfg.GifWidth <= 0 || cfg.GifWidth > maxThumbnailSize {
+		return nil, fmt.Errorf("timelapse.gifWidth 必须在 1-%d 之间，当前为 %d", maxThumbnailSize, cfg.GifWidth)
+	}
+	return &cfg, nil
+}
+
+// 任务状态
+const (
+	TimelapsePending = "pending"
+	TimelapseRunning = "running"
+	TimelapseDone    = "done"
+	TimelapseFailed  = "failed"
+)
+
+// 生成文件格式
+const (
+	TimelapseAVI = "avi"
+	TimelapseGIF = "gif"
+)
+
+// TimelapseRequest 创建延时视频任务的参数
+type TimelapseRequest struct {
+	DeviceId string
+	Start    time.Time // 包含
+	End      time.Time // 不包含
+	Fps      int       // 帧率，为0时使用10
+	Skip     int       // 每取一帧后跳过的帧数
+	Gif      bool      // 同时生成 GIF
+	GifWidth int       // GIF 宽度，为0时使用 timelapse.gifWidth
+}
+
+// TimelapseJob 延时视频任务，保存为 {id}.json，生成的文件为 {id}.avi 和 {id}.gif
+type TimelapseJob struct {
+	Id         string     `json:"id"`
+	DeviceId   string     `json:"deviceId"`
+	StartTime  time.Time  `json:"startTime"`
+	EndTime    time.Time  `json:"endTime"`
+	Fps        int        `json:"fps"`
+	Skip       int        `json:"skip"`
+	Gif        bool       `json:"gif"`
+	GifWidth   int        `json:"gifWidth"`
+	Status     string     `json:"status"` // pending/running/done/failed
+	Error      string     `json:"error"`
+	Total      int        `json:"total"`      // 预计的帧数
+	Frames     int        `json:"frames"`     // 已写入的帧数
+	Missing    int        `json:"missing"`    // 读取失败而跳过的帧数
+	Mismatched int        `json:"mismatched"` // 尺寸与第一帧不同而跳过的帧数
+	AviSize    int64      `json:"aviSize"`
+	GifSize    int64      `json:"gifSize"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	StartedAt  *time.Time `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt"`
+}
+
+// 任务ID：时间戳加随机后缀，API中只接受该格式，防止路径穿越
+var timelapseIdPattern = regexp.MustCompile(`^\d{8}_\d{6}\.\d{3}_[0-9a-f]{8}$`)
+
+// 每写入多少帧保存一次任务进度
+const timelapseProgressInterval = 50
+
+// Timelapse 延时视频任务队列，由固定数量的工作协程依次处理
+type Timelapse struct {
+	cfg     *TimelapseConfig
+	storage storage.Storage
+	queue   chan string
+
+	mu      sync.Mutex
+	cancels map[string]context.CancelFunc // 运行中的任务，删除任务时取消
+}
+
+func newTimelapse(cfg *TimelapseConfig, st storage.Storage) (*Timelapse, error) {
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建延时视频目录失败: %v", err)
+	}
+	return &Timelapse{
+		cfg:     cfg,
+		storage: st,
+		queue:   make(chan string, cfg.QueueSize),
+		cancels: make(map[string]context.CancelFunc),
+	}, nil
+}
+
+// 启动工作协程，上次退出时未完成的任务重新排队
+func (t *Timelapse) start() {
+	jobs, err := t.List("")
+	if err != nil {
+		log.Printf("读取延时视频任务失败: %v", err)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.Before(jobs[j].CreatedAt) })
+	for i := range jobs {
+		job := &jobs[i]
+		if job.Status != TimelapsePending && job.Status != TimelapseRunning {
+			continue
+		}
+		select {
+		case t.queue <- job.Id:
+			log.Printf("延时视频任务 %s 重新排队", job.Id)
+		default:
+			t.fail(context.Background(), job, fmt.Errorf("服务重启后任务队列已满"))
+		}
+	}
+	for i := 0; i < t.cfg.Workers; i++ {
+		go t.work()
+	}
+}
+
+// 创建任务并排队，帧数超出限制时返回错误
+func (t *Timelapse) Submit(ctx context.Context, req TimelapseRequest) (*TimelapseJob, error) {
+	if req.DeviceId == "" {
+		return nil, fmt.Errorf("设备ID不能为空")
+	}
+	if !req.End.After(req.Start) {
+		return nil, fmt.Errorf("结束时间必须晚于开始时间")
+	}
+	if req.Fps == 0 {
+		req.Fps = 10
+	}
+	if req.Fps < 0 || req.Fps > t.cfg.MaxFps {
+		return nil, fmt.Errorf("帧率必须在 1-%d 之间", t.cfg.MaxFps)
+	}
+	if req.Skip < 0 {
+		return nil, fmt.Errorf("跳过的帧数不能为负数")
+	}
+	if req.GifWidth == 0 {
+		req.GifWidth = t.cfg.GifWidth
+	}
+	if req.GifWidth < 0 || req.GifWidth > maxThumbnailSize {
+		return nil, fmt.Errorf("GIF 宽度必须在 1-%d 之间", maxThumbnailSize)
+	}
+
+	sizes, err := model.Image.Sizes(ctx, req.DeviceId, req.Start, req.End)
+	if err != nil {
+		return nil, fmt.Errorf("统计帧数失败: %v", err)
+	}
+	if len(sizes) == 0 {
+		return nil, fmt.Errorf("时间范围内没有帧")
+	}
+	// 与生成时相同，每 Skip+1 帧取一帧
+	total, bytes := 0, int64(0)
+	for i := 0; i < len(sizes); i += req.Skip + 1 {
+		total++
+		bytes += sizes[i]
+	}
+	if total > t.cfg.MaxFrames {
+		return nil, fmt.Errorf("共 %d 帧，超过视频帧数上限 %d，请缩小时间范围或增加跳帧", total, t.cfg.MaxFrames)
+	}
+	// 超过 AVI 大小上限的任务会在读完大部分帧后失败，提交时按索引中的大小提前拒绝
+	if size := avi.FileSize(total, bytes); size > avi.MaxFileSize {
+		return nil, fmt.Errorf("共 %d 帧、%d MB，超过 AVI 文件 %d MB 的上限，请缩小时间范围或增加跳帧",
+			total, size>>20, avi.MaxFileSize>>20)
+	}
+	if req.Gif && total > t.cfg.MaxGifFrames {
+		return nil, fmt.Errorf("共 %d 帧，超过 GIF 帧数上限 %d，请缩小时间范围或增加跳帧", total, t.cfg.MaxGifFrames)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	job := &TimelapseJob{
+		Id:        now.Format("20060102_150405.000") + "_" + hex.EncodeToString(suffix),
+		DeviceId:  req.DeviceId,
+		StartTime: req.Start,
+		EndTime:   req.End,
+		Fps:       req.Fps,
+		Skip:      req.Skip,
+		Gif:       req.Gif,
+		GifWidth:  req.GifWidth,
+		Status:    TimelapsePending,
+		Total:     total,
+		CreatedAt: now,
+	}
+	if err := t.save(context.Background(), job); err != nil {
+		return nil, err
+	}
+	select {
+	case t.queue <- job.Id:
+	default:
+		_ = os.Remove(t.jobPath(job.Id))
+		return nil, fmt.Errorf("任务队列已满，请稍后再试")
+	}
+	log.Printf("已创建延时视频任务 %s: 设备 %s，%d 帧", job.Id, job.DeviceId, job.Total)
+	return job, nil
+}
+
+// 列出任务，deviceId 为空时返回全部，按创建时间倒序
+func (t *Timelapse) List(deviceId string) ([]TimelapseJob, error) {
+	files, err := filepath.Glob(filepath.Join(t.cfg.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]TimelapseJob, 0, len(files))
+	for _, file := range files {
+		job, err := t.read(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			log.Printf("读取延时视频任务失败: %s, %v", file, err)
+			continue
+		}
+		if deviceId != "" && job.DeviceId != deviceId {
+			continue
+		}
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// 获取任务
+func (t *Timelapse) Get(id string) (*TimelapseJob, error) {
+	if !timelapseIdPattern.MatchString(id) {
+		return nil, fmt.Errorf("无效的任务ID: '%s'", id)
+	}
+	return t.read(id)
+}
+
+// 生成文件的路径，任务未完成或没有该格式时返回错误
+func (t *Timelapse) Artifact(id string, format string) (string, error) {
+	job, err := t.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if job.Status != TimelapseDone {
+		return "", fmt.Errorf("任务尚未完成，当前状态: %s", job.Status)
+	}
+	switch format {
+	case "", TimelapseAVI:
+		return t.artifactPath(id, TimelapseAVI), nil
+	case TimelapseGIF:
+		if !job.Gif {
+			return "", fmt.Errorf("任务没有生成 GIF")
+		}
+		return t.artifactPath(id, TimelapseGIF), nil
+	}
+	return "", fmt.Errorf("不支持的格式 '%s'，可用: avi、gif", format)
+}
+
+// 删除任务及生成的文件，运行中的任务会被取消。
+// 取消和删除记录在同一把锁内完成，运行中的任务此后不会再写出记录，见 save
+func (t *Timelapse) Delete(id string) error {
+	if _, err := t.Get(id); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if cancel, ok := t.cancels[id]; ok {
+		cancel()
+	}
+	for _, format := range []string{TimelapseAVI, TimelapseGIF} {
+		if err := os.Remove(t.artifactPath(id, format)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Remove(t.jobPath(id))
+}
+
+func (t *Timelapse) work() {
+	for id := range t.queue {
+		ctx, cancel := context.WithCancel(context.Background())
+		job, err := t.claim(id, cancel)
+		if err != nil {
+			// 排队期间被删除
+			cancel()
+			continue
+		}
+
+		started := time.Now()
+		job.Status, job.StartedAt = TimelapseRunning, &started
+		job.Frames, job.Missing, job.Mismatched, job.Error = 0, 0, 0, ""
+		if err := t.save(ctx, job); err != nil {
+			log.Printf("保存延时视频任务 %s 失败: %v", id, err)
+		}
+		err = t.run(ctx, job)
+		switch {
+		case ctx.Err() != nil:
+			// 任务已被删除，清除运行期间可能生成的文件
+			t.removeArtifacts(id)
+		case err != nil:
+			t.fail(ctx, job, err)
+		default:
+			finished := time.Now()
+			job.Status, job.FinishedAt = TimelapseDone, &finished
+			if err := t.save(ctx, job); err != nil {
+				log.Printf("保存延时视频任务 %s 失败: %v", id, err)
+			}
+			log.Printf("延时视频任务 %s 完成: %d 帧，跳过 %d 帧，尺寸不一致 %d 帧，耗时 %s",
+				id, job.Frames, job.Missing, job.Mismatched, finished.Sub(started).Round(time.Millisecond))
+		}
+
+		t.mu.Lock()
+		delete(t.cancels, id)
+		t.mu.Unlock()
+		cancel()
+	}
+}
+
+// 读取排队的任务并登记取消函数；与 Delete 在同一把锁内，任务要么已被删除，要么删除时能被取消
+func (t *Timelapse) claim(id string, cancel context.CancelFunc) (*TimelapseJob, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	job, err := t.read(id)
+	if err != nil {
+		return nil, err
+	}
+	t.cancels[id] = cancel
+	return job, nil
+}
+
+// 生成视频：从索引按时间顺序读取帧，每 Skip+1 帧取一帧写入 AVI，需要时同时缩小后加入 GIF
+func (t *Timelapse) run(ctx context.Context, job *TimelapseJob) error {
+	aviTmp := t.artifactPath(job.Id, TimelapseAVI) + ".tmp"
+	file, err := os.Create(aviTmp)
+	if err != nil {
+		return fmt.Errorf("创建视频文件失败: %v", err)
+	}
+	defer func() {
+		file.Close()
+		os.Remove(aviTmp)
+	}()
+
+	var (
+		writer    *avi.Writer
+		animation gif.GIF
+		after     *model.ImageModel
+		n         int
+		width     int // 第一帧的尺寸
+		height    int
+	)
+	delay := (100 + job.Fps/2) / job.Fps // GIF 的帧间隔单位为 1/100 秒
+	if delay < 2 {
+		// 小于 2 时多数浏览器会按 10 处理
+		delay = 2
+	}
+	for {
+		batch, err := model.Image.RangeAfter(ctx, job.DeviceId, job.StartTime, job.EndTime, after, exportBatchSize)
+		if err != nil {
+			return fmt.Errorf("查询帧失败: %v", err)
+		}
+		for i := range batch {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			n++
+			if (n-1)%(job.Skip+1) != 0 {
+				continue
+			}
+			data, err := model.ReadFrame(ctx, t.storage, batch[i].StorageKey)
+			if err != nil {
+				log.Printf("延时视频任务 %s 读取帧 %s 失败: %v", job.Id, batch[i].StorageKey, err)
+				job.Missing++
+				continue
+			}
+			config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				log.Printf("延时视频任务 %s 跳过无法解析的帧 %s: %v", job.Id, batch[i].StorageKey, err)
+				job.Missing++
+				continue
+			}
+			if writer == nil {
+				// 视频尺寸使用第一帧的尺寸
+				if writer, err = avi.NewWriter(file, config.Width, config.Height, float64(job.Fps)); err != nil {
+					return err
+				}
+				width, height = config.Width, config.Height
+			} else if config.Width != width || config.Height != height {
+				// 帧直接封装不转码，尺寸不同的帧无法放入同一个视频，GIF 也要求帧尺寸一致
+				if job.Mismatched == 0 {
+					log.Printf("延时视频任务 %s 的帧 %s 尺寸为 %dx%d，与第一帧的 %dx%d 不同，跳过尺寸不一致的帧",
+						job.Id, batch[i].StorageKey, config.Width, config.Height, width, height)
+				}
+				job.Mismatched++
+				continue
+			}
+			if err := writer.WriteFrame(data); err != nil {
+				return fmt.Errorf("写入视频失败: %v", err)
+			}
+			if job.Gif {
+				frame, err := gifFrame(data, job.GifWidth)
+				if err != nil {
+					return err
+				}
+				animation.Image = append(animation.Image, frame)
+				animation.Delay = append(animation.Delay, delay)
+			}
+			job.Frames++
+			if job.Frames%timelapseProgressInterval == 0 {
+				if err := t.save(ctx, job); err != nil {
+					log.Printf("保存延时视频任务 %s 的进度失败: %v", job.Id, err)
+				}
+			}
+		}
+		if len(batch) < exportBatchSize {
+			break
+		}
+		after = &batch[len(batch)-1]
+	}
+	if writer == nil {
+		return fmt.Errorf("时间范围内没有可用的帧")
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("写入视频失败: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("写入视频失败: %v", err)
+	}
+	if job.Gif {
+		if job.GifSize, err = t.writeGIF(job.Id, &animation); err != nil {
+			return err
+		}
+	}
+	info, err := os.Stat(aviTmp)
+	if err != nil {
+		return err
+	}
+	job.AviSize = info.Size()
+	return os.Rename(aviTmp, t.artifactPath(job.Id, TimelapseAVI))
+}
+
+// 解码并缩小一帧，用 Plan 9 调色板抖动为 GIF 帧
+func gifFrame(data []byte, width int) (*image.Paletted, error) {
+	src, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("解码图像失败: %v", err)
+	}
+	src = resize(src, width)
+	frame := image.NewPaletted(src.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(frame, frame.Bounds(), src, src.Bounds().Min)
+	return frame, nil
+}
+
+// 写出 GIF，返回文件大小
+func (t *Timelapse) writeGIF(id string, animation *gif.GIF) (int64, error) {
+	path := t.artifactPath(id, TimelapseGIF)
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		return 0, fmt.Errorf("创建 GIF 文件失败: %v", err)
+	}
+	defer os.Remove(path + ".tmp")
+	if err := gif.EncodeAll(file, animation); err != nil {
+		file.Close()
+		return 0, fmt.Errorf("写入 GIF 失败: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return 0, fmt.Errorf("写入 GIF 失败: %v", err)
+	}
+	info, err := os.Stat(path + ".tmp")
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), os.Rename(path+".tmp", path)
+}
+
+func (t *Timelapse) fail(ctx context.Context, job *TimelapseJob, err error) {
+	log.Printf("延时视频任务 %s 失败: %v", job.Id, err)
+	t.removeArtifacts(job.Id)
+	finished := time.Now()
+	job.Status, job.Error, job.FinishedAt = TimelapseFailed, err.Error(), &finished
+	if err := t.save(ctx, job); err != nil {
+		log.Printf("保存延时视频任务 %s 失败: %v", job.Id, err)
+	}
+}
+
+func (t *Timelapse) removeArtifacts(id string) {
+	for _, format := range []string{TimelapseAVI, TimelapseGIF} {
+		_ = os.Remove(t.artifactPath(id, format))
+	}
+}
+
+// 先写临时文件再重命名，读取方不会读到写了一半的记录。
+// ctx 为任务的运行上下文，任务已被删除（ctx 已取消）时不再写出，以免重新创建记录
+func (t *Timelapse) save(ctx context.Context, job *TimelapseJob) error {
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tmp := t.jobPath(job.Id) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.jobPath(job.Id))
+}
+
+func (t *Timelapse) read(id string) (*TimelapseJob, error) {
+	data, err := os.ReadFile(t.jobPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("任务不存在: %s", id)
+		}
+		return nil, err
+	}
+	var job TimelapseJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func (t *Timelapse) jobPath(id string) string {
+	return filepath.Join(t.cfg.Dir, id+".json")
+}
+
+func (t *Timelapse) artifactPath(id string, format string) string {
+	return filepath.Join(t.cfg.Dir, id+"."+format)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 消息类型
+const (
+	KindImage          = "image"           // 图像帧
+	KindCommandAck     = "cmd_ack"         // 命令确认
+	KindShadowReported = "shadow_reported" // 设备影子上报状态
+	KindStatus         = "status"          // 设备在线状态（含遗嘱消息）
+	KindTelemetry      = "telemetry"       // 设备遥测数据
+)
+
+// 已支持的消息类型
+var knownKinds = map[string]bool{
+	KindImage:          true,
+	KindCommandAck:     true,
+	KindShadowReported: true,
+	KindStatus:         true,
+	KindTelemetry:      true,
+}
+
+// 合法的设备ID：设备ID会作为目录名使用，只允许安全字符
+var deviceIdPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// 设备ID是否合法，"." 和 ".." 作为目录名有特殊含义
+func validDeviceId(deviceId string) bool {
+	return deviceIdPattern.MatchString(deviceId) && deviceId != "." && deviceId != ".."
+}
+
+// TopicRule 主题映射规则，对应 mqtt.topicRules 配置项
+//
+// 模式按 "/" 分级，每一级可以是：
+//   - 普通字符串，必须完全相同
+//   - {name} 命名占位符，匹配任意一级并以 name 提取，{deviceId} 必须出现
+//   - {kind} 特殊占位符，提取值作为消息类型
+//   - + 匿名单级通配符；# 多级通配符，只能位于最后
+type TopicRule struct {
+	Pattern string `json:"pattern"` // 例如 device/{deviceId}/{channel}/image
+	Kind    string `json:"kind"`    // 消息类型，模式中包含 {kind} 时可省略
+
+	levels []string
+}
+
+// TopicMatch 主题匹配结果
+type TopicMatch struct {
+	DeviceId string            // 设备ID
+	Kind     string            // 消息类型
+	Vars     map[string]string // 其余命名占位符的值，例如 channel
+	Pattern  string            // 命中的规则
+}
+
+// 默认主题规则：新固件使用 device/{deviceId}/image，旧固件使用 image_topic/{deviceId}
+func defaultTopicRules() []TopicRule {
+	return []TopicRule{
+		{Pattern: "device/{deviceId}/image", Kind: KindImage},
+		{Pattern: "device/{deviceId}/{channel}/image", Kind: KindImage},
+		{Pattern: "image_topic/{deviceId}", Kind: KindImage},
+		{Pattern: "device/{deviceId}/cmd/ack", Kind: KindCommandAck},
+		{Pattern: "device/{deviceId}/shadow/reported", Kind: KindShadowReported},
+		{Pattern: "device/{deviceId}/status", Kind: KindStatus},
+		{Pattern: "device/{deviceId}/telemetry", Kind: KindTelemetry},
+	}
+}
+
+// 解析并校验规则
+func (r *TopicRule) compile() error {
+	if r.Pattern == "" {
+		return fmt.Errorf("模式为空")
+	}
+	r.levels = strings.Split(r.Pattern, "/")
+	names := make(map[string]bool)
+	for i, level := range r.levels {
+		switch {
+		case level == "#":
+			if i != len(r.levels)-1 {
+				return fmt.Errorf("'#' 只能位于最后一级")
+			}
+		case level == "+":
+		case strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}"):
+			name := level[1 : len(level)-1]
+			if name == "" {
+				return fmt.Errorf("占位符名称为空")
+			}
+			if names[name] {
+				return fmt.Errorf("占位符 {%s} 重复", name)
+			}
+			names[name] = true
+		case strings.ContainsAny(level, "+#{}"):
+			return fmt.Errorf("非法的主题级别 '%s'", level)
+		}
+	}
+	if !names["deviceId"] {
+		return fmt.Errorf("缺少 {deviceId} 占位符")
+	}
+	if names["kind"] {
+		if r.Kind != "" {
+			return fmt.Errorf("已包含 {kind} 占位符时不能再配置 kind")
+		}
+	} else {
+		if r.Kind == "" {
+			r.Kind = KindImage
+		}
+		if !knownKinds[r.Kind] {
+			return fmt.Errorf("未知的消息类型 '%s'", r.Kind)
+		}
+	}
+	return nil
+}
+
+// 规则对应的订阅主题，占位符替换为 +
+func (r *TopicRule) Filter() string {
+	levels := make([]string, len(r.levels))
+	for i, level := range r.levels {
+		if strings.HasPrefix(level, "{") {
+			levels[i] = "+"
+		} else {
+			levels[i] = level
+		}
+	}
+	return strings.Join(levels, "/")
+}
+
+// 匹配主题，成功时返回提取出的设备ID、消息类型和其余占位符
+func (r *TopicRule) Match(topic string) (*TopicMatch, bool) {
+	parts := strings.Split(topic, "/")
+	m := &TopicMatch{Kind: r.Kind, Vars: make(map[string]string), Pattern: r.Pattern}
+	for i, level := range r.levels {
+		if level == "#" {
+			return m, m.valid()
+		}
+		if i >= len(parts) {
+			return nil, false
+		}
+		switch {
+		case level == "+":
+		case strings.HasPrefix(level, "{"):
+			name := level[1 : len(level)-1]
+			switch name {
+			case "deviceId":
+				m.DeviceId = parts[i]
+			case "kind":
+				m.Kind = parts[i]
+			default:
+				m.Vars[name] = parts[i]
+			}
+		case level != parts[i]:
+			return nil, false
+		}
+	}
+	if len(parts) != len(r.levels) {
+		return nil, false
+	}
+	return m, m.valid()
+}
+
+func (m *TopicMatch) valid() bool {
+	return validDeviceId(m.DeviceId) && knownKinds[m.Kind]
+}
+
+// 主题路由：按配置顺序匹配，第一条命中的规则生效
+type topicRouter struct {
+	rules []TopicRule
+}
+
+func newTopicRouter(rules []TopicRule) (*topicRouter, error) {
+	router := &topicRouter{rules: make([]TopicRule, len(rules))}
+	copy(router.rules, rules)
+	for i := range router.rules {
+		if err := router.rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("mqtt.topicRules 第%d条规则 '%s' 非法: %v", i+1, router.rules[i].Pattern, err)
+		}
+	}
+	return router, nil
+}
+
+func (t *topicRouter) Match(topic string) (*TopicMatch, bool) {
+	for i := range t.rules {
+		if m, ok := t.rules[i].Match(topic); ok {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// 所有规则对应的订阅主题
+func (t *topicRouter) Filters() []string {
+	filters := make([]string, 0, len(t.rules))
+	for i := range t.rules {
+		filters = append(filters, t.rules[i].Filter())
+	}
+	return filters
+}
+
+// 判断主题是否匹配订阅过滤器，过滤器中可以使用 + 和 #
+func topicMatchesFilter(filter string, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+		if i >= len(topicLevels) {
+			return false
+		}
+		if level != "+" && level != topicLevels[i] {
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
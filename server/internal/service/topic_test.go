@@ -0,0 +1,157 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTopicRouterMatch(t *testing.T) {
+	router, err := newTopicRouter(append(defaultTopicRules(),
+		TopicRule{Pattern: "site/{site}/{deviceId}/{kind}"},
+		TopicRule{Pattern: "raw/+/{deviceId}/#", Kind: KindImage},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		topic    string
+		ok       bool
+		deviceId string
+		kind     string
+		vars     map[string]string
+		pattern  string
+	}{
+		{"device/cam01/image", true, "cam01", KindImage, map[string]string{}, "device/{deviceId}/image"},
+		{"device/cam01/ch2/image", true, "cam01", KindImage, map[string]string{"channel": "ch2"}, "device/{deviceId}/{channel}/image"},
+		{"image_topic/cam01", true, "cam01", KindImage, map[string]string{}, "image_topic/{deviceId}"},
+		{"device/cam01/cmd/ack", true, "cam01", KindCommandAck, map[string]string{}, "device/{deviceId}/cmd/ack"},
+		{"device/cam01/shadow/reported", true, "cam01", KindShadowReported, map[string]string{}, "device/{deviceId}/shadow/reported"},
+		{"device/cam01/status", true, "cam01", KindStatus, map[string]string{}, "device/{deviceId}/status"},
+		{"device/cam01/telemetry", true, "cam01", KindTelemetry, map[string]string{}, "device/{deviceId}/telemetry"},
+		{"site/north/cam01/image", true, "cam01", KindImage, map[string]string{"site": "north"}, "site/{site}/{deviceId}/{kind}"},
+		{"site/north/cam01/telemetry", true, "cam01", KindTelemetry, map[string]string{"site": "north"}, "site/{site}/{deviceId}/{kind}"},
+		{"raw/x/cam01", true, "cam01", KindImage, map[string]string{}, "raw/+/{deviceId}/#"},
+		{"raw/x/cam01/a/b", true, "cam01", KindImage, map[string]string{}, "raw/+/{deviceId}/#"},
+
+		// 级数不同
+		{topic: "device/cam01"},
+		{topic: "device/cam01/ch2/ch3/image"},
+		{topic: "image_topic/cam01/extra"},
+		// 普通级别不同
+		{topic: "device/cam01/video"},
+		{topic: "other/cam01/image"},
+		// {kind} 提取出未知的消息类型
+		{topic: "site/north/cam01/video"},
+		// 非法的设备ID
+		{topic: "device/../image"},
+		{topic: "device/./image"},
+		{topic: "device//image"},
+		{topic: "device/cam 01/image"},
+		{topic: "image_topic/" + strings.Repeat("a", 65)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.topic, func(t *testing.T) {
+			m, ok := router.Match(tt.topic)
+			if ok != tt.ok {
+				t.Fatalf("Match(%q) ok = %v，应为 %v", tt.topic, ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if m.DeviceId != tt.deviceId || m.Kind != tt.kind || m.Pattern != tt.pattern {
+				t.Errorf("Match(%q) = {%s %s %s}，应为 {%s %s %s}",
+					tt.topic, m.DeviceId, m.Kind, m.Pattern, tt.deviceId, tt.kind, tt.pattern)
+			}
+			if !reflect.DeepEqual(m.Vars, tt.vars) {
+				t.Errorf("Match(%q) Vars = %v，应为 %v", tt.topic, m.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestTopicRouterOrder(t *testing.T) {
+	// 两条规则都能匹配时，先配置的规则生效
+	router, err := newTopicRouter([]TopicRule{
+		{Pattern: "device/{deviceId}/{kind}"},
+		{Pattern: "device/{deviceId}/image", Kind: KindImage},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := router.Match("device/cam01/image")
+	if !ok || m.Pattern != "device/{deviceId}/{kind}" {
+		t.Errorf("Match 命中了 %+v，应为第一条规则", m)
+	}
+}
+
+func TestTopicRouterFilters(t *testing.T) {
+	router, err := newTopicRouter([]TopicRule{
+		{Pattern: "device/{deviceId}/image"},
+		{Pattern: "site/{site}/{deviceId}/{kind}"},
+		{Pattern: "raw/+/{deviceId}/#", Kind: KindImage},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"device/+/image", "site/+/+/+", "raw/+/+/#"}
+	if got := router.Filters(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Filters() = %v，应为 %v", got, want)
+	}
+}
+
+func TestTopicRuleCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule TopicRule
+		ok   bool
+		kind string
+	}{
+		{"默认类型为图像", TopicRule{Pattern: "device/{deviceId}/image"}, true, KindImage},
+		{"指定类型", TopicRule{Pattern: "device/{deviceId}/snapshot", Kind: KindImage}, true, KindImage},
+		{"kind 占位符", TopicRule{Pattern: "device/{deviceId}/{kind}"}, true, ""},
+		{"多级通配符在最后", TopicRule{Pattern: "device/{deviceId}/#"}, true, KindImage},
+		{"模式为空", TopicRule{}, false, ""},
+		{"缺少设备ID", TopicRule{Pattern: "device/+/image"}, false, ""},
+		{"多级通配符不在最后", TopicRule{Pattern: "device/#/{deviceId}"}, false, ""},
+		{"占位符名称为空", TopicRule{Pattern: "device/{deviceId}/{}"}, false, ""},
+		{"占位符重复", TopicRule{Pattern: "{deviceId}/{deviceId}"}, false, ""},
+		{"非法的级别", TopicRule{Pattern: "device/{deviceId}/img+"}, false, ""},
+		{"kind 占位符与类型同时配置", TopicRule{Pattern: "device/{deviceId}/{kind}", Kind: KindImage}, false, ""},
+		{"未知类型", TopicRule{Pattern: "device/{deviceId}/video", Kind: "video"}, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.rule
+			err := rule.compile()
+			if (err == nil) != tt.ok {
+				t.Fatalf("compile(%q) 返回 %v，是否成功应为 %v", tt.rule.Pattern, err, tt.ok)
+			}
+			if tt.ok && rule.Kind != tt.kind {
+				t.Errorf("compile(%q) 后 Kind = %q，应为 %q", tt.rule.Pattern, rule.Kind, tt.kind)
+			}
+		})
+	}
+}
+
+func TestTopicMatchesFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"device/cam01/image", "device/cam01/image", true},
+		{"device/+/image", "device/cam01/image", true},
+		{"device/+/image", "device/cam01/status", false},
+		{"device/#", "device/cam01/image", true},
+		{"device/#", "device", true}, // # 也匹配父级
+		{"#", "device/cam01/image", true},
+		{"device/+", "device/cam01/image", false},
+		{"device/+/image/+", "device/cam01/image", false},
+	}
+	for _, tt := range tests {
+		if got := topicMatchesFilter(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("topicMatchesFilter(%q, %q) = %v，应为 %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+)
+
+// ValidationConfig 对应 ingest.validation 配置段
+type ValidationConfig struct {
+	MinBytes  int `json:"minBytes"`  // 最小字节数
+	MaxBytes  int `json:"maxBytes"`  // 最大字节数
+	MaxWidth  int `json:"maxWidth"`  // 最大宽度（像素）
+	MaxHeight int `json:"maxHeight"` // 最大高度（像素）
+}
+
+func defaultValidationConfig() ValidationConfig {
+	return ValidationConfig{
+		MinBytes:  128,
+		MaxBytes:  10 * 1024 * 1024,
+		MaxWidth:  8192,
+		MaxHeight: 8192,
+	}
+}
+
+func (c *ValidationConfig) validate() error {
+	if c.MinBytes < 0 {
+		return fmt.Errorf("ingest.validation.minBytes 不能小于0，当前为 %d", c.MinBytes)
+	}
+	if c.MaxBytes <= c.MinBytes {
+		return fmt.Errorf("ingest.validation.maxBytes 必须大于 minBytes，当前为 %d", c.MaxBytes)
+	}
+	if c.MaxWidth <= 0 || c.MaxHeight <= 0 {
+		return fmt.Errorf("ingest.validation.maxWidth/maxHeight 必须大于0")
+	}
+	return nil
+}
+
+var (
+	jpegSOI = []byte{0xFF, 0xD8, 0xFF}
+	jpegEOI = []byte{0xFF, 0xD9}
+)
+
+// 校验JPEG图像，返回图像尺寸
+func validateJPEG(data []byte, cfg *ValidationConfig) (width, height int, err error) {
+	if len(data) < cfg.MinBytes {
+		return 0, 0, fmt.Errorf("图像过小: %d字节，最小 %d字节", len(data), cfg.MinBytes)
+	}
+	if len(data) > cfg.MaxBytes {
+		return 0, 0, fmt.Errorf("图像过大: %d字节，最大 %d字节", len(data), cfg.MaxBytes)
+	}
+	if !bytes.HasPrefix(data, jpegSOI) {
+		return 0, 0, fmt.Errorf("缺少JPEG起始标记(SOI)")
+	}
+	// 部分编码器会在EOI之后填充0字节
+	if !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), jpegEOI) {
+		return 0, 0, fmt.Errorf("缺少JPEG结束标记(EOI)，图像可能被截断")
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, fmt.Errorf("解析图像头失败: %v", err)
+	}
+	if format != "jpeg" {
+		return 0, 0, fmt.Errorf("不支持的图像格式: %s", format)
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return 0, 0, fmt.Errorf("图像尺寸无效: %dx%d", config.Width, config.Height)
+	}
+	if config.Width > cfg.MaxWidth || config.Height > cfg.MaxHeight {
+		return 0, 0, fmt.Errorf("图像尺寸 %dx%d 超出限制 %dx%d", config.Width, config.Height, cfg.MaxWidth, cfg.MaxHeight)
+	}
+	return config.Width, config.Height, nil
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config S3 兼容驱动配置，可用于 MinIO、AWS S3 等
+type S3Config struct {
+	Endpoint  string `json:"endpoint"`  // 服务地址，例如 127.0.0.1:9000，不带协议
+	Region    string `json:"region"`    // 区域，MinIO 可留空
+	Bucket    string `json:"bucket"`    // 存储桶
+	Prefix    string `json:"prefix"`    // 对象键前缀，例如 images/
+	AccessKey string `json:"accessKey"` // 访问密钥
+	SecretKey string `json:"secretKey"` // 私有密钥
+	UseSSL    bool   `json:"useSSL"`    // 使用 HTTPS
+	PathStyle bool   `json:"pathStyle"` // 使用路径形式的存储桶地址，MinIO 需要开启
+}
+
+// S3 S3 兼容驱动
+type S3 struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(cfg *S3Config) (*S3, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("storage.s3.endpoint 不能为空")
+	}
+	if strings.Contains(cfg.Endpoint, "://") {
+		return nil, fmt.Errorf("storage.s3.endpoint 不能包含协议，请使用 useSSL 选择 HTTPS")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("storage.s3.bucket 不能为空")
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		if err := validateKey(prefix); err != nil {
+			return nil, fmt.Errorf("storage.s3.prefix 非法: %v", err)
+		}
+		prefix += "/"
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       cfg.UseSSL,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建S3客户端失败: %v", err)
+	}
+	return &S3{client: client, bucket: cfg.Bucket, prefix: prefix}, nil
+}
+
+// 检查存储桶是否存在，用于启动时尽早发现配置错误
+func (s *S3) Check(ctx context.Context) error {
+	exists, err := s.client.BucketExists(ctx, s.bucket)
+	if err != nil {
+		return fmt.Errorf("访问存储桶 %s 失败: %v", s.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("存储桶 %s 不存在", s.bucket)
+	}
+	return nil
+}
+
+func (s *S3) object(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	return s.prefix + key, nil
+}
+
+func isNoSuchKey(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3) Put(ctx context.Context, key string, data []byte) error {
+	name, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	opts := minio.PutObjectOptions{}
+	if strings.HasSuffix(key, ".jpg") {
+		opts.ContentType = "image/jpeg"
+	} else if strings.HasSuffix(key, ".json") {
+		opts.ContentType = "application/json"
+	}
+	_, err = s.client.PutObject(ctx, s.bucket, name, bytes.NewReader(data), int64(len(data)), opts)
+	return err
+}
+
+func (s *S3) Get(ctx context.Context, key string) ([]byte, error) {
+	name, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+	// GetObject 不发送请求，对象不存在的错误在读取时返回
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotExist)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, ObjectInfo{
+			Key:     strings.TrimPrefix(obj.Key, s.prefix),
+			Size:    obj.Size,
+			ModTime: obj.LastModified,
+		})
+	}
+	// S3 按键的 UTF-8 字节顺序返回，已经有序
+	return objects, nil
+}
+
+func (s *S3) ListDirs(ctx context.Context) ([]string, error) {
+	var names []string
+	// 非递归列出时，下一级的公共前缀以 "/" 结尾返回
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix,
+		Recursive: false,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		if !strings.HasSuffix(obj.Key, "/") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(obj.Key, s.prefix), "/")
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	name, err := s.object(key)
+	if err != nil {
+		return err
+	}
+	err = s.client.RemoveObject(ctx, s.bucket, name, minio.RemoveObjectOptions{})
+	if err != nil && isNoSuchKey(err) {
+		return nil
+	}
+	return err
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	name, err := s.object(key)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.client.StatObject(ctx, s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, fmt.Errorf("%s: %w", key, ErrNotExist)
+		}
+		return nil, err
+	}
+	return &ObjectInfo{Key: key, Size: info.Size, ModTime: info.LastModified}, nil
+}
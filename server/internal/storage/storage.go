@@ -0,0 +1,88 @@
+// Package storage 图像存储后端。对象使用 "/" 分隔的键访问，例如 0610/2025/03/16/21/20250316_212305.123_000.jpg，
+// 本地驱动把键映射为目录下的文件，S3 驱动把键映射为存储桶中的对象。
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("对象不存在")
+
+// ObjectInfo 对象信息
+type ObjectInfo struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Storage 图像存储接口
+type Storage interface {
+	// 写入对象，已存在时覆盖
+	Put(ctx context.Context, key string, data []byte) error
+	// 读取对象，不存在时返回 ErrNotExist
+	Get(ctx context.Context, key string) ([]byte, error)
+	// 列出键以 prefix 开头的对象，按键升序排列；prefix 以 "/" 结尾时表示目录
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// 列出根下第一级目录的名称，按名称升序排列，不遍历目录中的对象
+	ListDirs(ctx context.Context) ([]string, error)
+	// 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+	// 获取对象信息，不存在时返回 ErrNotExist
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+// 驱动名称
+const (
+	DriverLocal = "local"
+	DriverS3    = "s3"
+)
+
+// Config 对应 config.yaml 中的 storage 配置段
+type Config struct {
+	Driver string      `json:"driver"` // local 或 s3
+	Local  LocalConfig `json:"local"`
+	S3     S3Config    `json:"s3"`
+}
+
+// 根据配置创建存储
+func New(cfg *Config) (Storage, error) {
+	switch cfg.Driver {
+	case DriverLocal:
+		return NewLocal(cfg.Local.Dir)
+	case DriverS3:
+		return NewS3(&cfg.S3)
+	}
+	return nil, fmt.Errorf("不支持的存储驱动: '%s'", cfg.Driver)
+}
+
+// 判断错误是否表示对象不存在
+func IsNotExist(err error) bool {
+	return errors.Is(err, ErrNotExist)
+}
+
+// 拼接对象键
+func Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// 校验对象键：不能为空、不能以 "/" 开头，也不能包含 "." 或 ".." 路径段
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("对象键为空")
+	}
+	if strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("非法的对象键 '%s'", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("非法的对象键 '%s'", key)
+		}
+	}
+	return nil
+}
@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"video-platform/internal/controller"
 	"video-platform/internal/middleware"
 	"video-platform/internal/model"
@@ -27,8 +30,42 @@ func initDatabase() error {
 	return err
 }
 
+// 初始化数据库表
+func initTables(ctx context.Context) error {
+	if err := model.Device.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化数据库表失败: %v", err)
+	}
+	if err := model.Command.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化命令表失败: %v", err)
+	}
+	if err := model.Shadow.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化设备影子表失败: %v", err)
+	}
+	if err := model.StatusHistory.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化设备状态历史表失败: %v", err)
+	}
+	if err := model.Telemetry.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化设备遥测表失败: %v", err)
+	}
+	if err := model.PublishAudit.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化发布记录表失败: %v", err)
+	}
+	if err := model.Image.InitTable(ctx); err != nil {
+		return fmt.Errorf("初始化图像索引表失败: %v", err)
+	}
+	return nil
+}
+
 func main() {
 	ctx := context.Background()
+
+	// 子命令
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(ctx, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("执行命令 %s 失败: %v", os.Args[1], err)
+		}
+		return
+	}
 	
 	// 初始化数据库
 	if err := initDatabase(); err != nil {
@@ -36,12 +73,21 @@ func main() {
 	}
 	
 	// 初始化数据库表
-	if err := model.Device.InitTable(ctx); err != nil {
-		log.Fatalf("初始化数据库表失败: %v", err)
+	if err := initTables(ctx); err != nil {
+		log.Fatalf("%v", err)
 	}
 
 	// 初始化MQTT服务
-	service.GetMQTTService()
+	if err := service.InitMQTTService(ctx); err != nil {
+		log.Fatalf("初始化MQTT服务失败: %v", err)
+	}
+	adminCfg, err := service.LoadAdminConfig(ctx)
+	if err != nil {
+		log.Fatalf("读取管理配置失败: %v", err)
+	}
+	if adminCfg.Token == "" {
+		log.Printf("警告: 未配置 admin.token，管理接口不可用")
+	}
 
 	s := g.Server()
 
@@ -55,21 +101,54 @@ func main() {
 			group.PUT("/devices/:deviceId", controller.DeviceController.Update)
 			group.DELETE("/devices/:deviceId", controller.DeviceController.Delete)
 			group.GET("/devices/:deviceId/status", controller.DeviceController.GetStatus)
+			group.GET("/devices/:deviceId/status/history", controller.DeviceController.GetStatusHistory)
 			
 			// 设备图像路由
 			group.GET("/devices/:deviceId/realtime", controller.DeviceController.GetRealtimeImage)
 			group.GET("/devices/:deviceId/images", controller.DeviceController.GetHistoryImages)
+			group.GET("/devices/:deviceId/images/:imageId/thumbnail", controller.ImageController.Thumbnail)
+			group.GET("/devices/:deviceId/images/:imageId/render", controller.ImageController.Render)
+			group.GET("/images/export", controller.ImageController.Export)
+
+			// 设备命令路由，下发命令需要管理员令牌
+			group.GET("/devices/:deviceId/commands", controller.CommandController.List)
+			group.GET("/devices/:deviceId/commands/:commandId", controller.CommandController.Get)
+
+			// 设备遥测路由
+			group.GET("/devices/:deviceId/telemetry", controller.TelemetryController.Query)
+
+			// 设备影子路由，修改期望状态需要管理员令牌
+			group.GET("/devices/:deviceId/shadow", controller.ShadowController.Get)
+			group.GET("/devices/:deviceId/shadow/delta", controller.ShadowController.Delta)
+			group.GET("/shadows/delta", controller.ShadowController.DeltaList)
+
+			// 隔离区路由，批量清理需要管理员令牌
+			group.GET("/quarantine", controller.QuarantineController.List)
+			group.GET("/quarantine/:id", controller.QuarantineController.Get)
+			group.DELETE("/quarantine/:id", controller.QuarantineController.Delete)
+
+			// 图像保留策略
+			group.GET("/retention/preview", controller.RetentionController.Preview)
+
+			// 延时视频
+			group.POST("/timelapse", controller.TimelapseController.Create)
+			group.GET("/timelapse", controller.TimelapseController.List)
+			group.GET("/timelapse/:id", controller.TimelapseController.Get)
+			group.GET("/timelapse/:id/download", controller.TimelapseController.Download)
+			group.DELETE("/timelapse/:id", controller.TimelapseController.Delete)
+
+			// MQTT接收管道统计
+			group.GET("/mqtt/ingest/stats", controller.MQTTController.IngestStats)
 
-			// 测试MQTT消息发布
-			group.GET("/test/mqtt/:deviceId", func(r *ghttp.Request) {
-				deviceId := r.Get("deviceId").String()
-				testData := []byte("test image data")
-				if err := service.GetMQTTService().TestPublish(deviceId, testData); err != nil {
-					r.Response.WriteStatus(500)
-					r.Response.WriteJson(g.Map{"error": err.Error()})
-					return
-				}
-				r.Response.WriteJson(g.Map{"message": "测试消息已发送"})
+			// 管理接口，需要管理员令牌
+			group.Group("/", func(group *ghttp.RouterGroup) {
+				group.Middleware(middleware.AdminAuth(adminCfg.Token))
+				group.POST("/mqtt/publish", controller.MQTTController.Publish)
+				group.GET("/mqtt/publish/audit", controller.MQTTController.PublishAudit)
+				group.POST("/devices/:deviceId/commands", controller.CommandController.Send)
+				group.PUT("/devices/:deviceId/shadow/desired", controller.ShadowController.UpdateDesired)
+				group.PATCH("/devices/:deviceId/shadow/desired", controller.ShadowController.PatchDesired)
+				group.DELETE("/quarantine", controller.QuarantineController.Purge)
 			})
 		})
 	})
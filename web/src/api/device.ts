@@ -58,19 +58,138 @@ export function getRealtimeImage(deviceId: string) {
 export function getHistoryImages(
   deviceId: string,
   startTime?: string,
-  endTime?: string
+  endTime?: string,
+  noData?: boolean
 ) {
   return request<
-    ApiResponse<{
-      images: { id: string; timestamp: string; imageData: string }[];
-    }>
+    ApiResponse<{ id: number; timestamp: string; imageData: string }[]>
   >({
     url: `/devices/${deviceId}/images`,
     method: "get",
-    params: { startTime, endTime },
+    params: { startTime, endTime, noData },
   });
 }
 
+// 获取图像缩略图地址，imageId 为 "latest" 时为设备最新的一帧，size 为缩略图宽度
+export function getThumbnailUrl(
+  deviceId: string,
+  imageId: number | string,
+  size?: number
+) {
+  const query = size ? `?size=${size}` : "";
+  return `/api/v1/devices/${deviceId}/images/${imageId}/thumbnail${query}`;
+}
+
+export interface RenderOptions {
+  width?: number;
+  height?: number;
+  fit?: "contain" | "cover" | "fill";
+  crop?: string; // x,y,宽,高
+  quality?: number;
+  format?: "jpeg" | "png";
+}
+
+// 获取按参数渲染的图像地址，不传参数时为原图
+export function getRenderUrl(
+  deviceId: string,
+  imageId: number | string,
+  options: RenderOptions = {}
+) {
+  const params = new URLSearchParams();
+  Object.entries(options).forEach(([key, value]) => {
+    if (value !== undefined && value !== "") {
+      params.append(key, String(value));
+    }
+  });
+  const query = params.toString() ? `?${params.toString()}` : "";
+  return `/api/v1/devices/${deviceId}/images/${imageId}/render${query}`;
+}
+
+// 获取图像导出地址，下载一段时间内原始图像的 ZIP（附带清单）
+export function getExportUrl(
+  deviceIds: string[],
+  startTime: string,
+  endTime: string
+) {
+  const params = new URLSearchParams({
+    deviceIds: deviceIds.join(","),
+    startTime,
+    endTime,
+  });
+  return `/api/v1/images/export?${params.toString()}`;
+}
+
+export interface TimelapseJob {
+  id: string;
+  deviceId: string;
+  startTime: string;
+  endTime: string;
+  fps: number;
+  skip: number;
+  gif: boolean;
+  gifWidth: number;
+  status: "pending" | "running" | "done" | "failed";
+  error: string;
+  total: number;
+  frames: number;
+  missing: number;
+  mismatched: number;
+  aviSize: number;
+  gifSize: number;
+  createdAt: string;
+  startedAt: string | null;
+  finishedAt: string | null;
+}
+
+export interface TimelapseForm {
+  deviceId: string;
+  startTime: string;
+  endTime: string;
+  fps?: number;
+  skip?: number;
+  gif?: boolean;
+  gifWidth?: number;
+}
+
+// 创建延时视频任务
+export function createTimelapse(form: TimelapseForm) {
+  return request<ApiResponse<TimelapseJob>>({
+    url: "/timelapse",
+    method: "post",
+    data: form,
+  });
+}
+
+// 获取延时视频任务列表
+export function getTimelapseJobs(deviceId?: string) {
+  return request<ApiResponse<TimelapseJob[]>>({
+    url: "/timelapse",
+    method: "get",
+    params: { deviceId },
+  });
+}
+
+// 获取延时视频任务详情
+export function getTimelapseJob(id: string) {
+  return request<ApiResponse<TimelapseJob>>({
+    url: `/timelapse/${id}`,
+    method: "get",
+  });
+}
+
+// 删除延时视频任务
+export function deleteTimelapseJob(id: string) {
+  return request<ApiResponse<null>>({
+    url: `/timelapse/${id}`,
+    method: "delete",
+  });
+}
+
+// 延时视频下载地址
+export function getTimelapseDownloadUrl(id: string, format: "avi" | "gif" = "avi") {
+  return `/api/v1/timelapse/${id}/download?format=${format}`;
+}
+
 // 获取单个设备信息
 export function getDevice(deviceId: string) {
   return request<ApiResponse<Device>>({